@@ -1,69 +1,292 @@
-package main
-
-import (
-	"context"
-	"fmt"
-	"log"
-	"os"
-	"time"
-
-	mongo_repo "github.com/burp_junior/internal/repository/mongo"
-	"github.com/burp_junior/internal/rest/routers"
-	"github.com/burp_junior/usecase/request"
-	"github.com/joho/godotenv"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-)
-
-var (
-	DotenvPath       = "../.env"
-	MongoHostEnv     = "MONGO_HOST"
-	MongoPortEnv     = "MONGO_PORT"
-	MongoUsernameEnv = "MONGO_INITDB_ROOT_USERNAME"
-	MongoPasswordEnv = "MONGO_INITDB_ROOT_PASSWORD"
-)
-
-func mountRouters() {
-	if err := godotenv.Load(); err != nil {
-		log.Println("unable to read .env file")
-		return
-	}
-
-	connString := fmt.Sprintf(
-		"mongodb://%s:%s@%s:%s",
-		os.Getenv(MongoUsernameEnv),
-		os.Getenv(MongoPasswordEnv),
-		os.Getenv(MongoHostEnv),
-		os.Getenv(MongoPortEnv),
-	)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connString))
-	if err != nil {
-		log.Println("err connecting to mongo: ", err)
-		return
-	}
-
-	reqColl := client.Database("burp_junior").Collection("request")
-	resColl := client.Database("burp_junior").Collection("response")
-
-	reqRepo := mongo_repo.NewRequestsRepo(reqColl)
-	resRepo := mongo_repo.NewResponsesRepo(resColl)
-
-	rs, err := request.NewRequestService(reqRepo, resRepo)
-	if err != nil {
-		log.Println("err creating request service: ", err)
-		return
-	}
-
-	go func() {
-		routers.MountProxyRouter(rs)
-	}()
-
-	routers.MountAPIRouter(rs)
-}
-
-func main() {
-	mountRouters()
-}
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/burp_junior/internal/config"
+	mongo_repo "github.com/burp_junior/internal/repository/mongo"
+	rest_proxy "github.com/burp_junior/internal/rest/proxy"
+	"github.com/burp_junior/internal/rest/routers"
+	"github.com/burp_junior/usecase/ca"
+	"github.com/burp_junior/usecase/clientcert"
+	"github.com/burp_junior/usecase/health"
+	"github.com/burp_junior/usecase/intercept"
+	"github.com/burp_junior/usecase/network"
+	"github.com/burp_junior/usecase/passthrough"
+	"github.com/burp_junior/usecase/proxyuser"
+	"github.com/burp_junior/usecase/request"
+	"github.com/burp_junior/usecase/rules"
+	"github.com/burp_junior/usecase/scope"
+	"github.com/burp_junior/usecase/search"
+	"github.com/burp_junior/usecase/upstream"
+	"github.com/burp_junior/usecase/websocket"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// healthcheckTimeout bounds the request of the healthcheck command
+const healthcheckTimeout = 5 * time.Second
+
+func mountRouters(cfg *config.Config) {
+	// The whole shutdown shares one deadline, counted from when it starts, so that it fits
+	// in the grace period of the container: servers, tunnels and the database alike
+	shutdownCtx, cutOff := context.WithCancel(context.Background())
+	defer cutOff()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.MongoConnect)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.Mongo.URI()))
+	if err != nil {
+		log.Println("err connecting to mongo: ", err)
+		return
+	}
+
+	// Runs last, once every request, tunnel and scan is finished and its writes are done
+	defer func() {
+		err := client.Disconnect(shutdownCtx)
+		if err != nil {
+			log.Println("err disconnecting from mongo: ", err)
+			return
+		}
+
+		log.Println("Disconnected from mongo")
+	}()
+
+	db := client.Database(cfg.Mongo.Database)
+	reqColl := db.Collection("request")
+	resColl := db.Collection("response")
+	ruleColl := db.Collection("rule")
+	scopeColl := db.Collection("scope")
+	wsColl := db.Collection("websocket_message")
+	upstreamColl := db.Collection("upstream_proxy")
+	passthroughColl := db.Collection("passthrough")
+	tunnelColl := db.Collection("passthrough_tunnel")
+	clientCertColl := db.Collection("client_certificate")
+	networkColl := db.Collection("network_profile")
+	proxyUserColl := db.Collection("proxy_user")
+
+	reqRepo := mongo_repo.NewRequestsRepo(reqColl)
+	resRepo := mongo_repo.NewResponsesRepo(resColl)
+	ruleRepo := mongo_repo.NewRulesRepo(ruleColl)
+	scopeRepo := mongo_repo.NewScopesRepo(scopeColl)
+	wsRepo := mongo_repo.NewWebSocketMessagesRepo(wsColl)
+	upstreamRepo := mongo_repo.NewUpstreamProxiesRepo(upstreamColl)
+	passthroughRepo := mongo_repo.NewPassthroughSettingsRepo(passthroughColl)
+	tunnelRepo := mongo_repo.NewPassthroughTunnelsRepo(tunnelColl)
+	clientCertRepo := mongo_repo.NewClientCertificatesRepo(clientCertColl)
+	networkRepo := mongo_repo.NewNetworkProfilesRepo(networkColl)
+	proxyUserRepo := mongo_repo.NewProxyUsersRepo(proxyUserColl)
+	exchangeRepo := mongo_repo.NewExchangesRepo(reqColl, resColl)
+
+	err = reqRepo.EnsureIndexes(ctx)
+	if err != nil {
+		log.Println("err creating request indexes: ", err)
+		return
+	}
+
+	err = resRepo.EnsureIndexes(ctx)
+	if err != nil {
+		log.Println("err creating response indexes: ", err)
+		return
+	}
+
+	ss, err := scope.NewScopeService(ctx, scopeRepo)
+	if err != nil {
+		log.Println("err creating scope service: ", err)
+		return
+	}
+
+	us, err := upstream.NewUpstreamService(ctx, upstreamRepo, cfg.Timeouts.UpstreamDial)
+	if err != nil {
+		log.Println("err creating upstream service: ", err)
+		return
+	}
+
+	cas, err := ca.NewCAService(cfg.CA.CertPath, cfg.CA.KeyPath)
+	if err != nil {
+		log.Println("err creating ca service: ", err)
+		return
+	}
+
+	ccs, err := clientcert.NewClientCertService(ctx, clientCertRepo)
+	if err != nil {
+		log.Println("err creating client certificate service: ", err)
+		return
+	}
+
+	rs, err := request.NewRequestService(reqRepo, resRepo, ss, us, cas, ccs, request.Config{
+		WildcardCerts:      cfg.CA.WildcardCerts,
+		CaptureLimit:       cfg.Capture.BodyLimit,
+		ScanConcurrency:    cfg.Scanner.Concurrency,
+		ScanRequestTimeout: cfg.Scanner.RequestTimeout,
+	})
+	if err != nil {
+		log.Println("err creating request service: ", err)
+		return
+	}
+
+	is := intercept.NewInterceptService()
+
+	rls, err := rules.NewRulesService(ctx, ruleRepo)
+	if err != nil {
+		log.Println("err creating rules service: ", err)
+		return
+	}
+
+	wss := websocket.NewWebSocketService(rs, wsRepo)
+
+	ps, err := passthrough.NewPassthroughService(ctx, passthroughRepo, tunnelRepo)
+	if err != nil {
+		log.Println("err creating passthrough service: ", err)
+		return
+	}
+
+	ns, err := network.NewNetworkService(ctx, networkRepo)
+	if err != nil {
+		log.Println("err creating network service: ", err)
+		return
+	}
+
+	pus, err := proxyuser.NewProxyUserService(ctx, proxyUserRepo)
+	if err != nil {
+		log.Println("err creating proxy user service: ", err)
+		return
+	}
+
+	srs := search.NewSearchService(exchangeRepo, ss)
+
+	hs := health.NewHealthService(mongo_repo.NewDatabasePinger(client))
+
+	proxyHandler := rest_proxy.NewProxyHandler(rs, is, rls, wss, ps, cas, ns, pus)
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveCtx, stopServing := context.WithCancel(context.Background())
+	defer stopServing()
+
+	// Readiness goes down before the servers stop taking connections
+	shutdown := sync.OnceFunc(func() {
+		log.Println("Shutting down")
+		hs.SetShuttingDown()
+		stopServing()
+		time.AfterFunc(cfg.Timeouts.Shutdown, cutOff)
+	})
+
+	go func() {
+		<-sigCtx.Done()
+		shutdown()
+	}()
+
+	wg := &sync.WaitGroup{}
+
+	// Requests saved before the search index get their words while the proxy already runs
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		err := exchangeRepo.IndexSearchWords(serveCtx)
+		if err != nil {
+			log.Println("err indexing requests for search: ", err)
+		}
+	}()
+
+	for _, mount := range []func(){
+		func() { routers.MountProxyRouter(serveCtx, shutdownCtx, cfg, proxyHandler) },
+		func() { routers.MountSOCKSProxyRouter(serveCtx, cfg, proxyHandler) },
+		func() { routers.MountTransparentProxyRouter(serveCtx, shutdownCtx, cfg, proxyHandler) },
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mount()
+		}()
+	}
+
+	// Tunnels are drained along with the servers, idle ones are closed right away
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-serveCtx.Done()
+
+		err := proxyHandler.Shutdown(shutdownCtx)
+		if err != nil {
+			log.Println("proxy tunnels closed before finishing: ", err)
+		}
+	}()
+
+	routers.MountAPIRouter(serveCtx, shutdownCtx, cfg, hs, rs, is, rls, ss, wss, us, ps, cas, ccs, ns, pus, srs)
+
+	// The API also returns when it fails to serve, then the proxies are stopped as well
+	shutdown()
+
+	wg.Wait()
+}
+
+// healthcheck requests the readiness endpoint of the API, so docker can check
+// the image, which has neither a shell nor curl
+func healthcheck(cfg *config.Config) (err error) {
+	host, port, err := net.SplitHostPort(cfg.API.Addr)
+	if err != nil {
+		return
+	}
+
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+
+	client := &http.Client{Timeout: healthcheckTimeout}
+	scheme := "http"
+	if cfg.API.TLSCert != "" {
+		// The certificate of the API is not necessarily issued for localhost
+		scheme = "https"
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+
+	resp, err := client.Get(scheme + "://" + net.JoinHostPort(host, port) + "/readyz")
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("not ready: %s", resp.Status)
+		return
+	}
+
+	return
+}
+
+func main() {
+	// "app healthcheck [flags]" checks a running instance configured the same way
+	args := os.Args[1:]
+	check := len(args) > 0 && args[0] == "healthcheck"
+	if check {
+		args = args[1:]
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if check {
+		err = healthcheck(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	mountRouters(cfg)
+}
@@ -0,0 +1,15 @@
+package domain
+
+// Formats the CA certificate can be exported in
+const (
+	CAFormatPEM    = "pem"
+	CAFormatDER    = "der"
+	CAFormatPKCS12 = "p12"
+)
+
+// CAExport is the CA certificate encoded for download
+type CAExport struct {
+	Data        []byte
+	ContentType string
+	FileName    string
+}
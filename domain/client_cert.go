@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+// ClientCertificate is presented to servers matching HostPattern (a glob, empty matches
+// every host) that ask for a client certificate. CertPEM holds the certificate chain.
+type ClientCertificate struct {
+	ID          string    `bson:"_id,omitempty"`
+	HostPattern string    `bson:"host_pattern"`
+	CertPEM     string    `bson:"cert_pem"`
+	KeyPEM      string    `bson:"key_pem,omitempty"`
+	Subject     string    `bson:"subject"`
+	NotAfter    time.Time `bson:"not_after"`
+}
+
+// ClientCertificateUpload is a client certificate sent to the API either as CertPEM and KeyPEM
+// or as a PKCS#12 file (base64 in JSON) with its Password
+type ClientCertificateUpload struct {
+	HostPattern string
+	CertPEM     string
+	KeyPEM      string
+	PKCS12      []byte
+	Password    string
+}
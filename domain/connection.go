@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"time"
+)
+
+// ConnectionInfo describes one side of a proxied exchange: the client connection for requests
+// and the upstream connection for responses
+type ConnectionInfo struct {
+	RemoteAddr string   `bson:"remote_addr,omitempty"`
+	TLS        *TLSInfo `bson:"tls,omitempty"`
+}
+
+type TLSInfo struct {
+	Version          string             `bson:"version,omitempty"`
+	CipherSuite      string             `bson:"cipher_suite,omitempty"`
+	ALPN             string             `bson:"alpn,omitempty"`
+	SNI              string             `bson:"sni,omitempty"`
+	PeerCertificates []*CertificateInfo `bson:"peer_certificates,omitempty"`
+}
+
+type CertificateInfo struct {
+	Subject     string    `bson:"subject,omitempty"`
+	Issuer      string    `bson:"issuer,omitempty"`
+	DNSNames    []string  `bson:"dns_names,omitempty"`
+	IPAddresses []string  `bson:"ip_addresses,omitempty"`
+	NotBefore   time.Time `bson:"not_before,omitempty"`
+	NotAfter    time.Time `bson:"not_after,omitempty"`
+	SHA256      string    `bson:"sha256,omitempty"`
+}
+
+// NewConnectionInfo builds connection details from the remote address and, for TLS connections, the negotiated state
+func NewConnectionInfo(remoteAddr string, state *tls.ConnectionState) *ConnectionInfo {
+	info := &ConnectionInfo{
+		RemoteAddr: remoteAddr,
+	}
+
+	if state == nil {
+		return info
+	}
+
+	info.TLS = &TLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+		SNI:         state.ServerName,
+	}
+
+	for _, cert := range state.PeerCertificates {
+		info.TLS.PeerCertificates = append(info.TLS.PeerCertificates, NewCertificateInfo(cert))
+	}
+
+	return info
+}
+
+func NewCertificateInfo(cert *x509.Certificate) *CertificateInfo {
+	fingerprint := sha256.Sum256(cert.Raw)
+
+	info := &CertificateInfo{
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		DNSNames:  cert.DNSNames,
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		SHA256:    hex.EncodeToString(fingerprint[:]),
+	}
+
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+
+	return info
+}
@@ -1,110 +1,255 @@
-package domain
-
-import "sync"
-
-type HTTPRequest struct {
-	ID         string              `bson:"_id,omitempty"`
-	Proto      string              `bson:"proto,omitempty"`
-	Scheme     string              `bson:"scheme,omitempty"`
-	Method     string              `bson:"method,omitempty"`
-	Host       string              `bson:"host,omitempty"`
-	Port       string              `bson:"port,omitempty"`
-	Path       string              `bson:"path,omitempty"`
-	Headers    map[string][]string `bson:"headers,omitempty"`
-	GetParams  map[string][]string `bson:"get_params,omitempty"`
-	PostParams map[string][]string `bson:"post_params,omitempty"`
-	Cookies    map[string]string   `bson:"cookies,omitempty"`
-	Body       []byte              `bson:"body,omitempty"`
-}
-
-type SafeByteArr struct {
-	Buf []byte
-	Mu  *sync.RWMutex
-}
-
-type SafeStringArrMap struct {
-	Sam map[string][]string
-	Mu  *sync.RWMutex
-}
-
-type SafeStringMap struct {
-	Sm map[string]string
-	Mu *sync.RWMutex
-}
-
-type SafeHTTPRequest struct {
-	ID         string           `bson:"_id,omitempty"`
-	Proto      string           `bson:"proto,omitempty"`
-	Scheme     string           `bson:"scheme,omitempty"`
-	Method     string           `bson:"method,omitempty"`
-	Host       string           `bson:"host,omitempty"`
-	Port       string           `bson:"port,omitempty"`
-	Path       string           `bson:"path,omitempty"`
-	Headers    SafeStringArrMap `bson:"headers,omitempty"`
-	GetParams  SafeStringArrMap `bson:"get_params,omitempty"`
-	PostParams SafeStringArrMap `bson:"post_params,omitempty"`
-	Cookies    SafeStringMap    `bson:"cookies,omitempty"`
-	Body       SafeByteArr      `bson:"body,omitempty"`
-}
-
-func MakeSafeHTTPRequest(req *HTTPRequest) *SafeHTTPRequest {
-	return &SafeHTTPRequest{
-		ID:     req.ID,
-		Proto:  req.Proto,
-		Scheme: req.Scheme,
-		Method: req.Method,
-		Host:   req.Host,
-		Port:   req.Port,
-		Path:   req.Path,
-		Headers: SafeStringArrMap{
-			Sam: req.Headers,
-			Mu:  &sync.RWMutex{},
-		},
-		GetParams: SafeStringArrMap{
-			Sam: req.GetParams,
-			Mu:  &sync.RWMutex{},
-		},
-		PostParams: SafeStringArrMap{
-			Sam: req.PostParams,
-			Mu:  &sync.RWMutex{},
-		},
-		Cookies: SafeStringMap{
-			Sm: req.Cookies,
-			Mu: &sync.RWMutex{},
-		},
-		Body: SafeByteArr{
-			Buf: req.Body,
-			Mu:  &sync.RWMutex{},
-		},
-	}
-}
-
-func MakeHTTPRequestFromSafe(req *SafeHTTPRequest) *HTTPRequest {
-	return &HTTPRequest{
-		ID:         req.ID,
-		Proto:      req.Proto,
-		Scheme:     req.Scheme,
-		Method:     req.Method,
-		Host:       req.Host,
-		Port:       req.Port,
-		Path:       req.Path,
-		Headers:    req.Headers.Sam,
-		GetParams:  req.GetParams.Sam,
-		PostParams: req.PostParams.Sam,
-		Cookies:    req.Cookies.Sm,
-		Body:       req.Body.Buf,
-	}
-}
-
-func (r *HTTPRequest) GetFullHost() string {
-	return r.Host + ":" + r.Port
-}
-
-type HTTPResponse struct {
-	ID        string              `bson:"_id,omitempty"`
-	RequestID string              `bson:"request_id,omitempty"`
-	Code      int                 `bson:"code,omitempty"`
-	Message   string              `bson:"message,omitempty"`
-	Headers   map[string][]string `bson:"headers,omitempty"`
-	Body      string              `bson:"body,omitempty"`
-}
+package domain
+
+import (
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	ProtoHTTP11 = "HTTP/1.1"
+	ProtoHTTP2  = "HTTP/2.0"
+)
+
+type HTTPRequest struct {
+	ID         string              `bson:"_id,omitempty"`
+	Proto      string              `bson:"proto,omitempty"`
+	Scheme     string              `bson:"scheme,omitempty"`
+	Method     string              `bson:"method,omitempty"`
+	Host       string              `bson:"host,omitempty"`
+	Port       string              `bson:"port,omitempty"`
+	Path       string              `bson:"path,omitempty"`
+	Headers    map[string][]string `bson:"headers,omitempty"`
+	GetParams  map[string][]string `bson:"get_params,omitempty"`
+	PostParams map[string][]string `bson:"post_params,omitempty"`
+	Cookies    map[string]string   `bson:"cookies,omitempty"`
+	Body       []byte              `bson:"body,omitempty"`
+	// Bodies over the capture limit are stored truncated, BodyLength is the full length as received
+	Truncated  bool  `bson:"truncated,omitempty"`
+	BodyLength int64 `bson:"body_length"`
+	// BodyStream is set for truncated bodies of requests being proxied. It yields the whole body
+	// as received from the first byte, BodyLength is final once it has been closed.
+	BodyStream io.ReadCloser `bson:"-" json:"-"`
+	// RequestLine and RawHeaders keep the head of HTTP/1.x requests as it was received,
+	// with header order, casing and duplicates, so the request can be replayed as it was sent
+	RequestLine string   `bson:"request_line,omitempty"`
+	RawHeaders  []string `bson:"raw_headers,omitempty"`
+	// Connection describes how the client reached the proxy
+	Connection *ConnectionInfo `bson:"connection,omitempty"`
+	// Status, ContentType and Timing are copied from the first response so history can be
+	// sorted and filtered by them. ContentType is the media type, without parameters.
+	Status      int     `bson:"status,omitempty"`
+	ContentType string  `bson:"content_type,omitempty"`
+	Timing      *Timing `bson:"timing,omitempty"`
+	// Tester and Project are those of the proxy user who sent the request
+	Tester  string `bson:"tester,omitempty"`
+	Project string `bson:"project,omitempty"`
+	// Response is the first response received for the request, filled in when the request is looked up by ID
+	Response *HTTPResponse `bson:"-"`
+}
+
+type SafeByteArr struct {
+	Buf []byte
+	Mu  *sync.RWMutex
+}
+
+type SafeStringArrMap struct {
+	Sam map[string][]string
+	Mu  *sync.RWMutex
+}
+
+type SafeStringMap struct {
+	Sm map[string]string
+	Mu *sync.RWMutex
+}
+
+type SafeHTTPRequest struct {
+	ID         string           `bson:"_id,omitempty"`
+	Proto      string           `bson:"proto,omitempty"`
+	Scheme     string           `bson:"scheme,omitempty"`
+	Method     string           `bson:"method,omitempty"`
+	Host       string           `bson:"host,omitempty"`
+	Port       string           `bson:"port,omitempty"`
+	Path       string           `bson:"path,omitempty"`
+	Headers    SafeStringArrMap `bson:"headers,omitempty"`
+	GetParams  SafeStringArrMap `bson:"get_params,omitempty"`
+	PostParams SafeStringArrMap `bson:"post_params,omitempty"`
+	Cookies    SafeStringMap    `bson:"cookies,omitempty"`
+	Body       SafeByteArr      `bson:"body,omitempty"`
+	// The raw head is never changed by scans, so it is shared without locking
+	RequestLine string   `bson:"request_line,omitempty"`
+	RawHeaders  []string `bson:"raw_headers,omitempty"`
+}
+
+func MakeSafeHTTPRequest(req *HTTPRequest) *SafeHTTPRequest {
+	return &SafeHTTPRequest{
+		ID:     req.ID,
+		Proto:  req.Proto,
+		Scheme: req.Scheme,
+		Method: req.Method,
+		Host:   req.Host,
+		Port:   req.Port,
+		Path:   req.Path,
+		Headers: SafeStringArrMap{
+			Sam: req.Headers,
+			Mu:  &sync.RWMutex{},
+		},
+		GetParams: SafeStringArrMap{
+			Sam: req.GetParams,
+			Mu:  &sync.RWMutex{},
+		},
+		PostParams: SafeStringArrMap{
+			Sam: req.PostParams,
+			Mu:  &sync.RWMutex{},
+		},
+		Cookies: SafeStringMap{
+			Sm: req.Cookies,
+			Mu: &sync.RWMutex{},
+		},
+		Body: SafeByteArr{
+			Buf: req.Body,
+			Mu:  &sync.RWMutex{},
+		},
+		RequestLine: req.RequestLine,
+		RawHeaders:  req.RawHeaders,
+	}
+}
+
+func MakeHTTPRequestFromSafe(req *SafeHTTPRequest) *HTTPRequest {
+	return &HTTPRequest{
+		ID:          req.ID,
+		Proto:       req.Proto,
+		Scheme:      req.Scheme,
+		Method:      req.Method,
+		Host:        req.Host,
+		Port:        req.Port,
+		Path:        req.Path,
+		Headers:     req.Headers.Sam,
+		GetParams:   req.GetParams.Sam,
+		PostParams:  req.PostParams.Sam,
+		Cookies:     req.Cookies.Sm,
+		Body:        req.Body.Buf,
+		RequestLine: req.RequestLine,
+		RawHeaders:  req.RawHeaders,
+	}
+}
+
+// SetRawHead splits the head of a request as read from the wire into RequestLine and RawHeaders
+func (r *HTTPRequest) SetRawHead(head []byte) {
+	lines := strings.Split(strings.TrimSuffix(string(head), "\r\n\r\n"), "\r\n")
+
+	r.RequestLine = lines[0]
+	r.RawHeaders = lines[1:]
+}
+
+// DelRawHeader removes the lines of header key from RawHeaders
+func (r *HTTPRequest) DelRawHeader(key string) {
+	r.RawHeaders = slices.DeleteFunc(r.RawHeaders, func(line string) bool {
+		name, _, _ := strings.Cut(line, ":")
+		return strings.EqualFold(strings.TrimSpace(name), key)
+	})
+}
+
+// HeaderLines returns the head of the request as "Name: value" lines, as received if it was kept,
+// otherwise built from Headers and Cookies
+func (r *HTTPRequest) HeaderLines() []string {
+	if len(r.RawHeaders) > 0 {
+		return r.RawHeaders
+	}
+
+	lines := HeaderLines(r.Headers)
+	for _, name := range slices.Sorted(maps.Keys(r.Cookies)) {
+		lines = append(lines, "Cookie: "+r.Cookies[name])
+	}
+
+	return lines
+}
+
+// ParamLines returns GetParams and then PostParams as "name=value" lines, sorted by name
+func (r *HTTPRequest) ParamLines() []string {
+	return append(paramLines(r.GetParams), paramLines(r.PostParams)...)
+}
+
+// HeaderLines returns headers as "Name: value" lines, sorted by name
+func HeaderLines(headers map[string][]string) (lines []string) {
+	for _, name := range slices.Sorted(maps.Keys(headers)) {
+		for _, value := range headers[name] {
+			lines = append(lines, name+": "+value)
+		}
+	}
+
+	return
+}
+
+func paramLines(params map[string][]string) (lines []string) {
+	for _, name := range slices.Sorted(maps.Keys(params)) {
+		for _, value := range params[name] {
+			lines = append(lines, name+"="+value)
+		}
+	}
+
+	return
+}
+
+func (r *HTTPRequest) GetFullHost() string {
+	return r.Host + ":" + r.Port
+}
+
+type HTTPResponse struct {
+	ID        string              `bson:"_id,omitempty"`
+	RequestID string              `bson:"request_id,omitempty"`
+	Proto     string              `bson:"proto,omitempty"`
+	Code      int                 `bson:"code,omitempty"`
+	Message   string              `bson:"message,omitempty"`
+	Headers   map[string][]string `bson:"headers,omitempty"`
+	// Body is decoded from ContentEncoding, RawBody holds the bytes as received from the server.
+	// Without ContentEncoding they are the same bytes, which are stored only once.
+	Body            []byte `bson:"body,omitempty"`
+	RawBody         []byte `bson:"raw_body,omitempty"`
+	ContentEncoding string `bson:"content_encoding,omitempty"`
+	Charset         string `bson:"charset,omitempty"`
+	// Bodies over the capture limit are stored truncated, BodyLength is the full length as received
+	Truncated  bool  `bson:"truncated,omitempty"`
+	BodyLength int64 `bson:"body_length"`
+	// BodyStream is set for truncated bodies. It yields the whole body as received from the first
+	// byte and has to be closed, after which BodyLength and Timing are final.
+	BodyStream io.ReadCloser `bson:"-" json:"-"`
+	// Connection describes the upstream connection the response came from
+	Connection *ConnectionInfo `bson:"connection,omitempty"`
+	Timing     *Timing         `bson:"timing,omitempty"`
+}
+
+// ResponseSummary is what a request keeps of its first response
+type ResponseSummary struct {
+	Status      int     `bson:"status,omitempty"`
+	ContentType string  `bson:"content_type,omitempty"`
+	Timing      *Timing `bson:"timing,omitempty"`
+}
+
+// Summary returns the status, media type and timing of r
+func (r *HTTPResponse) Summary() *ResponseSummary {
+	summary := &ResponseSummary{
+		Status: r.Code,
+		Timing: r.Timing,
+	}
+
+	if values := r.Headers["Content-Type"]; len(values) > 0 {
+		summary.ContentType, _, _ = strings.Cut(values[0], ";")
+		summary.ContentType = strings.ToLower(strings.TrimSpace(summary.ContentType))
+	}
+
+	return summary
+}
+
+// IsWebSocketUpgrade reports whether the request is a WebSocket opening handshake
+func (r *HTTPRequest) IsWebSocketUpgrade() bool {
+	for _, value := range r.Headers["Upgrade"] {
+		if strings.EqualFold(strings.TrimSpace(value), "websocket") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"path"
+	"time"
+)
+
+const (
+	InterceptStageRequest  = "request"
+	InterceptStageResponse = "response"
+)
+
+type InterceptSettings struct {
+	Enabled            bool
+	HostPatterns       []string
+	InterceptResponses bool
+}
+
+// MatchesHost reports whether host is covered by the settings.
+// Empty HostPatterns means that every host is intercepted.
+func (s *InterceptSettings) MatchesHost(host string) bool {
+	if len(s.HostPatterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range s.HostPatterns {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+type InterceptedMessage struct {
+	ID        string
+	Stage     string
+	Request   *HTTPRequest
+	Response  *HTTPResponse
+	CreatedAt time.Time
+}
@@ -0,0 +1,33 @@
+package domain
+
+import "time"
+
+// NetworkFault is a failure simulated instead of forwarding a request
+type NetworkFault string
+
+const (
+	NetworkFaultNone  NetworkFault = ""
+	NetworkFaultDrop  NetworkFault = "drop"
+	NetworkFaultReset NetworkFault = "reset"
+	NetworkFaultError NetworkFault = "error"
+)
+
+// NetworkProfile simulates network conditions for hosts matching HostPattern (a glob,
+// empty matches every host). Bandwidth caps bytes per second delivered in each direction
+// and Latency delays them, zero disables either. DropRate, ResetRate and ErrorRate are
+// probabilities of closing the client connection, resetting it or answering with
+// a synthetic ErrorCode response (503 if not set) instead of forwarding a request.
+type NetworkProfile struct {
+	HostPattern string        `bson:"host_pattern,omitempty"`
+	Bandwidth   int64         `bson:"bandwidth,omitempty"`
+	Latency     time.Duration `bson:"latency,omitempty"`
+	DropRate    float64       `bson:"drop_rate,omitempty"`
+	ResetRate   float64       `bson:"reset_rate,omitempty"`
+	ErrorRate   float64       `bson:"error_rate,omitempty"`
+	ErrorCode   int           `bson:"error_code,omitempty"`
+}
+
+// NetworkProfileSettings holds network profiles in priority order, the first matching one is used
+type NetworkProfileSettings struct {
+	Profiles []NetworkProfile `bson:"profiles"`
+}
@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// PassthroughSettings lists hosts whose TLS is relayed untouched instead of being intercepted,
+// e.g. apps pinning certificates. HostPatterns are globs matched against the target host.
+// With Auto enabled a host is added to AutoHosts after AutoFailures consecutive
+// client handshake failures with forged certificates.
+type PassthroughSettings struct {
+	HostPatterns []string `bson:"host_patterns"`
+	Auto         bool     `bson:"auto"`
+	AutoFailures int      `bson:"auto_failures"`
+	AutoHosts    []string `bson:"auto_hosts"`
+}
+
+// PassthroughTunnel is the metadata recorded for a tunnel relayed as raw bytes
+type PassthroughTunnel struct {
+	ID            string        `bson:"_id,omitempty"`
+	Host          string        `bson:"host"`
+	Port          string        `bson:"port"`
+	SNI           string        `bson:"sni,omitempty"`
+	BytesSent     int64         `bson:"bytes_sent"`
+	BytesReceived int64         `bson:"bytes_received"`
+	StartedAt     time.Time     `bson:"started_at"`
+	Duration      time.Duration `bson:"duration"`
+}
@@ -0,0 +1,19 @@
+package domain
+
+// ProxyUser is a set of credentials accepted in Proxy-Authorization. Requests sent
+// with them are tagged with the Tester and Project of the user.
+type ProxyUser struct {
+	ID           string `bson:"_id,omitempty"`
+	Username     string `bson:"username"`
+	PasswordHash string `bson:"password_hash,omitempty"`
+	Tester       string `bson:"tester"`
+	Project      string `bson:"project"`
+}
+
+// ProxyUserUpload is a proxy user sent to the API, Tester defaults to Username
+type ProxyUserUpload struct {
+	Username string
+	Password string
+	Tester   string
+	Project  string
+}
@@ -0,0 +1,43 @@
+package domain
+
+import "time"
+
+// RequestsSortTime orders requests by the time they were captured
+const RequestsSortTime = "time"
+
+// RequestsFilter selects a page of captured requests. Empty fields match anything.
+type RequestsFilter struct {
+	// Host, Method, Status and Tester, Project match exactly, Path and ContentType are substrings,
+	// ContentType is matched regardless of case
+	Host        string
+	Method      string
+	Path        string
+	Status      int
+	ContentType string
+	Tester      string
+	Project     string
+	// From and To bound the capture time, with second precision
+	From time.Time
+	To   time.Time
+	// HasParams keeps only requests with (or without) query or form parameters, if set
+	HasParams *bool
+	// InScope keeps only requests in the current scope, which is resolved into Scope for storages
+	InScope bool
+	Scope   *Scope
+	// SortBy orders requests by RequestsSortTime (the default) or one of the Timing* metrics,
+	// in descending order if SortDesc is set. Requests without timing go last when sorted by a metric.
+	SortBy   string
+	SortDesc bool
+	// Min and Max bound Timing* metrics, requests without timing are left out if any bound is set
+	Min map[string]int64
+	Max map[string]int64
+	// Limit is the page size, Cursor continues from the NextCursor of the previous page
+	Limit  int
+	Cursor string
+}
+
+// RequestsPage is a page of requests, NextCursor is empty on the last one
+type RequestsPage struct {
+	Requests   []*HTTPRequest
+	NextCursor string
+}
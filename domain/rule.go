@@ -0,0 +1,43 @@
+package domain
+
+const (
+	RuleTargetRequestHeader  = "request_header"
+	RuleTargetRequestCookie  = "request_cookie"
+	RuleTargetRequestParam   = "request_param"
+	RuleTargetRequestBody    = "request_body"
+	RuleTargetResponseHeader = "response_header"
+	RuleTargetResponseStatus = "response_status"
+	RuleTargetResponseBody   = "response_body"
+)
+
+// ReplaceRule rewrites a part of proxied traffic.
+// Headers are matched as "Name: value" lines, cookies and params as "name=value" pairs
+// and the status line as "200 OK". For these targets an empty Match adds Replace as
+// a new entry and an entry replaced with an empty string is removed.
+type ReplaceRule struct {
+	ID      string `bson:"_id,omitempty"`
+	Enabled bool   `bson:"enabled"`
+	Target  string `bson:"target"`
+	Match   string `bson:"match,omitempty"`
+	Replace string `bson:"replace,omitempty"`
+	IsRegex bool   `bson:"is_regex"`
+	Comment string `bson:"comment,omitempty"`
+}
+
+func (r *ReplaceRule) IsRequestRule() bool {
+	switch r.Target {
+	case RuleTargetRequestHeader, RuleTargetRequestCookie, RuleTargetRequestParam, RuleTargetRequestBody:
+		return true
+	}
+
+	return false
+}
+
+func (r *ReplaceRule) IsResponseRule() bool {
+	switch r.Target {
+	case RuleTargetResponseHeader, RuleTargetResponseStatus, RuleTargetResponseBody:
+		return true
+	}
+
+	return false
+}
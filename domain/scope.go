@@ -0,0 +1,18 @@
+package domain
+
+// ScopeRule matches requests by target. Empty fields match anything,
+// HostPattern is a glob such as "*.example.com".
+type ScopeRule struct {
+	Scheme      string `bson:"scheme,omitempty"`
+	HostPattern string `bson:"host_pattern,omitempty"`
+	Port        string `bson:"port,omitempty"`
+	PathPrefix  string `bson:"path_prefix,omitempty"`
+	PathRegex   string `bson:"path_regex,omitempty"`
+}
+
+// Scope defines the targets that are recorded and scanned. A request is in scope
+// if it matches any Include rule (or Include is empty) and matches no Exclude rule.
+type Scope struct {
+	Include []ScopeRule `bson:"include"`
+	Exclude []ScopeRule `bson:"exclude"`
+}
@@ -0,0 +1,57 @@
+package domain
+
+// Parts of an exchange that can be searched
+const (
+	SearchFieldPath            = "path"
+	SearchFieldRequestHeaders  = "request_headers"
+	SearchFieldParams          = "params"
+	SearchFieldRequestBody     = "request_body"
+	SearchFieldResponseHeaders = "response_headers"
+	SearchFieldResponseBody    = "response_body"
+)
+
+var SearchFields = []string{
+	SearchFieldPath,
+	SearchFieldRequestHeaders,
+	SearchFieldParams,
+	SearchFieldRequestBody,
+	SearchFieldResponseHeaders,
+	SearchFieldResponseBody,
+}
+
+type SearchQuery struct {
+	// Text is matched as plain text, or as a regular expression (RE2 syntax) if Regex is set
+	Text          string
+	Regex         bool
+	CaseSensitive bool
+	// Fields limits the search to some of the SearchField* parts, all of them are searched if empty
+	Fields []string
+	// Words are the whole words every match of Text contains, exchanges are looked up by them
+	Words []string
+	// Filter narrows the requests searched, its paging and sorting are not used
+	Filter *RequestsFilter
+	// Limit is the number of exchanges returned, Cursor continues from the NextCursor of the previous page
+	Limit  int
+	Cursor string
+}
+
+// SearchSnippet is a match with its surroundings, Text[Start:End] is the matched part
+type SearchSnippet struct {
+	Field string
+	Text  string
+	Start int
+	End   int
+}
+
+// SearchResult is an exchange that matched, ResponseID is empty if the request has no response
+type SearchResult struct {
+	RequestID  string
+	ResponseID string
+	Snippets   []*SearchSnippet
+}
+
+// SearchPage holds exchanges from newest to oldest, NextCursor is empty on the last page
+type SearchPage struct {
+	Results    []*SearchResult
+	NextCursor string
+}
@@ -0,0 +1,58 @@
+package domain
+
+import "time"
+
+const (
+	TimingDNS          = "dns"
+	TimingConnect      = "connect"
+	TimingTLSHandshake = "tls"
+	TimingTTFB         = "ttfb"
+	TimingTotal        = "total"
+	TimingRequestSize  = "request_size"
+	TimingResponseSize = "response_size"
+)
+
+// Timing holds the phases of an exchange and the sizes of the bodies as sent on the wire.
+// Connection phases are zero when the exchange reused an established connection.
+type Timing struct {
+	DNS          time.Duration `bson:"dns"`
+	Connect      time.Duration `bson:"connect"`
+	TLSHandshake time.Duration `bson:"tls_handshake"`
+	TTFB         time.Duration `bson:"ttfb"`
+	Total        time.Duration `bson:"total"`
+	RequestSize  int64         `bson:"request_size"`
+	ResponseSize int64         `bson:"response_size"`
+}
+
+// Value returns the metric named field (one of the Timing* constants), durations in nanoseconds
+func (t *Timing) Value(field string) (value int64, ok bool) {
+	switch field {
+	case TimingDNS:
+		return int64(t.DNS), true
+	case TimingConnect:
+		return int64(t.Connect), true
+	case TimingTLSHandshake:
+		return int64(t.TLSHandshake), true
+	case TimingTTFB:
+		return int64(t.TTFB), true
+	case TimingTotal:
+		return int64(t.Total), true
+	case TimingRequestSize:
+		return t.RequestSize, true
+	case TimingResponseSize:
+		return t.ResponseSize, true
+	}
+
+	return 0, false
+}
+
+// IsTimingField reports whether field names one of the Timing metrics
+func IsTimingField(field string) bool {
+	_, ok := (&Timing{}).Value(field)
+	return ok
+}
+
+// IsTimingDuration reports whether field is a duration rather than a size
+func IsTimingDuration(field string) bool {
+	return field != TimingRequestSize && field != TimingResponseSize
+}
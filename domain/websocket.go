@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+const (
+	WebSocketDirectionClient = "client_to_server"
+	WebSocketDirectionServer = "server_to_client"
+)
+
+// WebSocketMessage is a single message relayed over a WebSocket connection.
+// RequestID links it to the opening handshake request.
+type WebSocketMessage struct {
+	ID        string    `bson:"_id,omitempty"`
+	RequestID string    `bson:"request_id,omitempty"`
+	Direction string    `bson:"direction,omitempty"`
+	Opcode    int       `bson:"opcode"`
+	Payload   []byte    `bson:"payload,omitempty"`
+	Timestamp time.Time `bson:"timestamp"`
+}
@@ -0,0 +1,332 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the settings of the whole application. Values are taken from, in order
+// of increasing precedence: defaults, the YAML config file, environment variables
+// (including those set in the .env file) and command-line flags.
+type Config struct {
+	Proxy       ListenerConfig    `yaml:"proxy"`
+	SOCKS       ListenerConfig    `yaml:"socks"`
+	Transparent TransparentConfig `yaml:"transparent"`
+	API         APIConfig         `yaml:"api"`
+	Mongo       MongoConfig       `yaml:"mongo"`
+	CA          CAConfig          `yaml:"ca"`
+	Capture     CaptureConfig     `yaml:"capture"`
+	Timeouts    TimeoutsConfig    `yaml:"timeouts"`
+	Scanner     ScannerConfig     `yaml:"scanner"`
+}
+
+// ListenerConfig is the bind address of a proxy listener, an empty Addr disables it
+type ListenerConfig struct {
+	Addr string `yaml:"addr"`
+}
+
+// TransparentConfig is the bind address of the transparent proxy. Its clients cannot send
+// credentials, so once proxy users exist they are refused unless AllowUnauthenticated is set.
+type TransparentConfig struct {
+	Addr                 string `yaml:"addr"`
+	AllowUnauthenticated bool   `yaml:"allow_unauthenticated"`
+}
+
+// APIConfig is the bind address of the API, served over TLS if TLSCert and TLSKey are set
+type APIConfig struct {
+	Addr    string `yaml:"addr"`
+	TLSCert string `yaml:"tls_cert"`
+	TLSKey  string `yaml:"tls_key"`
+}
+
+type MongoConfig struct {
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Database string `yaml:"database"`
+}
+
+// CAConfig holds the paths of the CA forged certificates are signed with
+type CAConfig struct {
+	CertPath      string `yaml:"cert_path"`
+	KeyPath       string `yaml:"key_path"`
+	WildcardCerts bool   `yaml:"wildcard_certs"`
+}
+
+// MaxBodyLimit is the largest capture body limit. A response is stored as one MongoDB document
+// of at most 16 MiB, with its body both as received and decoded, each up to the limit.
+const MaxBodyLimit = 7 << 20
+
+// CaptureConfig limits what is stored of proxied traffic, BodyLimit is in bytes
+type CaptureConfig struct {
+	BodyLimit int64 `yaml:"body_limit"`
+}
+
+// TimeoutsConfig holds the timeouts of connections, zero ReadHeader and Idle disable them.
+// Shutdown is how long active requests, tunnels and scans are waited for on exit.
+type TimeoutsConfig struct {
+	MongoConnect time.Duration `yaml:"mongo_connect"`
+	UpstreamDial time.Duration `yaml:"upstream_dial"`
+	ReadHeader   time.Duration `yaml:"read_header"`
+	Idle         time.Duration `yaml:"idle"`
+	Shutdown     time.Duration `yaml:"shutdown"`
+}
+
+// ScannerConfig limits scans: Concurrency is the number of scan requests sent at once,
+// RequestTimeout bounds each of them, zero disables it
+type ScannerConfig struct {
+	Concurrency    int           `yaml:"concurrency"`
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+}
+
+// Default returns the configuration used for settings that are not set anywhere
+func Default() *Config {
+	return &Config{
+		// SOCKS5 and the transparent proxy are only served once given an address
+		Proxy: ListenerConfig{Addr: ":8080"},
+		API:   APIConfig{Addr: ":8000"},
+		Mongo: MongoConfig{
+			Host:     "localhost",
+			Port:     "27017",
+			Database: "burp_junior",
+		},
+		CA: CAConfig{
+			CertPath: "ca.crt",
+			KeyPath:  "ca.key",
+		},
+		Capture: CaptureConfig{BodyLimit: 4 << 20},
+		Timeouts: TimeoutsConfig{
+			MongoConnect: 20 * time.Second,
+			UpstreamDial: 30 * time.Second,
+			ReadHeader:   30 * time.Second,
+			Idle:         2 * time.Minute,
+			Shutdown:     30 * time.Second,
+		},
+		Scanner: ScannerConfig{
+			Concurrency:    16,
+			RequestTimeout: 30 * time.Second,
+		},
+	}
+}
+
+// option is a setting that can be overridden by an environment variable and a flag
+type option struct {
+	flag  string
+	env   string
+	usage string
+	value flag.Value
+}
+
+func options(cfg *Config) []option {
+	return []option{
+		{"proxy-addr", "PROXY_ADDR", "HTTP proxy bind address", (*stringValue)(&cfg.Proxy.Addr)},
+		{"socks-addr", "SOCKS_ADDR", "SOCKS5 proxy bind address, empty disables it", (*stringValue)(&cfg.SOCKS.Addr)},
+		{"transparent-addr", "TRANSPARENT_ADDR", "transparent proxy bind address, empty disables it", (*stringValue)(&cfg.Transparent.Addr)},
+		{"transparent-allow-unauthenticated", "TRANSPARENT_ALLOW_UNAUTHENTICATED", "serve transparent proxy clients without credentials even if proxy users exist", (*boolValue)(&cfg.Transparent.AllowUnauthenticated)},
+		{"api-addr", "API_ADDR", "API bind address", (*stringValue)(&cfg.API.Addr)},
+		{"api-tls-cert", "API_TLS_CERT", "API TLS certificate file", (*stringValue)(&cfg.API.TLSCert)},
+		{"api-tls-key", "API_TLS_KEY", "API TLS key file", (*stringValue)(&cfg.API.TLSKey)},
+		{"mongo-host", "MONGO_HOST", "MongoDB host", (*stringValue)(&cfg.Mongo.Host)},
+		{"mongo-port", "MONGO_PORT", "MongoDB port", (*stringValue)(&cfg.Mongo.Port)},
+		{"mongo-username", "MONGO_INITDB_ROOT_USERNAME", "MongoDB username", (*stringValue)(&cfg.Mongo.Username)},
+		{"mongo-password", "MONGO_INITDB_ROOT_PASSWORD", "MongoDB password", (*stringValue)(&cfg.Mongo.Password)},
+		{"mongo-database", "MONGO_DATABASE", "MongoDB database", (*stringValue)(&cfg.Mongo.Database)},
+		{"ca-cert-path", "CA_CERT_PATH", "CA certificate file", (*stringValue)(&cfg.CA.CertPath)},
+		{"ca-key-path", "CA_KEY_PATH", "CA key file", (*stringValue)(&cfg.CA.KeyPath)},
+		{"wildcard-certs", "WILDCARD_CERTS", "forge one wildcard certificate for sibling subdomains", (*boolValue)(&cfg.CA.WildcardCerts)},
+		{"body-capture-limit", "BODY_CAPTURE_LIMIT", "bytes of request and response bodies stored", (*int64Value)(&cfg.Capture.BodyLimit)},
+		{"mongo-connect-timeout", "MONGO_CONNECT_TIMEOUT", "MongoDB connect timeout", (*durationValue)(&cfg.Timeouts.MongoConnect)},
+		{"upstream-dial-timeout", "UPSTREAM_DIAL_TIMEOUT", "timeout of connections to targets and upstream proxies", (*durationValue)(&cfg.Timeouts.UpstreamDial)},
+		{"read-header-timeout", "READ_HEADER_TIMEOUT", "timeout of reading request headers from clients", (*durationValue)(&cfg.Timeouts.ReadHeader)},
+		{"idle-timeout", "IDLE_TIMEOUT", "timeout of idle keep-alive client connections", (*durationValue)(&cfg.Timeouts.Idle)},
+		{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "time given to active requests, tunnels and scans on exit", (*durationValue)(&cfg.Timeouts.Shutdown)},
+		{"scan-concurrency", "SCAN_CONCURRENCY", "scan requests sent at once", (*intValue)(&cfg.Scanner.Concurrency)},
+		{"scan-request-timeout", "SCAN_REQUEST_TIMEOUT", "timeout of every scan request", (*durationValue)(&cfg.Scanner.RequestTimeout)},
+	}
+}
+
+// Load builds the configuration from args (without the program name), the environment
+// and the config file given by -config or CONFIG_PATH, and validates it
+func Load(args []string) (cfg *Config, err error) {
+	cfg = Default()
+	opts := options(cfg)
+
+	fset := flag.NewFlagSet("burp_junior", flag.ContinueOnError)
+	configPath := fset.String("config", "", "YAML config file (env CONFIG_PATH)")
+	envPath := fset.String("env-file", ".env", "file with environment variables, skipped if missing")
+
+	// Flags are applied last, so they are only collected while parsing
+	type flagValue struct {
+		opt   option
+		value string
+	}
+	var flagValues []flagValue
+	for _, opt := range opts {
+		usage := opt.usage + " (env " + opt.env + ")"
+		fset.Func(opt.flag, usage, func(value string) error {
+			flagValues = append(flagValues, flagValue{opt, value})
+			return nil
+		})
+	}
+
+	err = fset.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// Variables already set in the environment take precedence over the .env file
+	err = godotenv.Load(*envPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("config: loading %s: %w", *envPath, err)
+	}
+
+	if *configPath == "" {
+		*configPath = os.Getenv("CONFIG_PATH")
+	}
+
+	if *configPath != "" {
+		err = loadFile(cfg, *configPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// A variable that is set but empty still applies, e.g. SOCKS_ADDR= disables the listener
+	for _, opt := range opts {
+		value, ok := os.LookupEnv(opt.env)
+		if !ok {
+			continue
+		}
+
+		if err = opt.value.Set(value); err != nil {
+			return nil, fmt.Errorf("config: env %s: %w", opt.env, err)
+		}
+	}
+
+	for _, fv := range flagValues {
+		if err = fv.opt.value.Set(fv.value); err != nil {
+			return nil, fmt.Errorf("config: flag -%s: %w", fv.opt.flag, err)
+		}
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// loadFile sets the values present in the YAML file at path, unknown keys are an error
+func loadFile(cfg *Config, path string) (err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	err = decoder.Decode(cfg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// Validate reports every invalid setting of cfg at once
+func (cfg *Config) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("config: "+format, args...))
+	}
+
+	for _, listener := range []struct {
+		name     string
+		addr     string
+		required bool
+	}{
+		{"proxy.addr", cfg.Proxy.Addr, true},
+		{"socks.addr", cfg.SOCKS.Addr, false},
+		{"transparent.addr", cfg.Transparent.Addr, false},
+		{"api.addr", cfg.API.Addr, true},
+	} {
+		if listener.addr == "" {
+			if listener.required {
+				invalid("%s is required", listener.name)
+			}
+			continue
+		}
+
+		if _, _, err := net.SplitHostPort(listener.addr); err != nil {
+			invalid("%s %q is not a host:port address", listener.name, listener.addr)
+		}
+	}
+
+	if (cfg.API.TLSCert == "") != (cfg.API.TLSKey == "") {
+		invalid("api.tls_cert and api.tls_key must be set together")
+	}
+
+	for _, path := range []string{cfg.API.TLSCert, cfg.API.TLSKey} {
+		if path == "" {
+			continue
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			invalid("api tls: %v", err)
+		}
+	}
+
+	if cfg.Mongo.Host == "" || cfg.Mongo.Port == "" || cfg.Mongo.Database == "" {
+		invalid("mongo.host, mongo.port and mongo.database are required")
+	}
+
+	if cfg.CA.CertPath == "" || cfg.CA.KeyPath == "" {
+		invalid("ca.cert_path and ca.key_path are required")
+	}
+
+	if cfg.Capture.BodyLimit < 0 || cfg.Capture.BodyLimit > MaxBodyLimit {
+		invalid("capture.body_limit must be between 0 and %d", MaxBodyLimit)
+	}
+
+	if cfg.Timeouts.MongoConnect <= 0 || cfg.Timeouts.UpstreamDial <= 0 || cfg.Timeouts.Shutdown <= 0 {
+		invalid("timeouts.mongo_connect, timeouts.upstream_dial and timeouts.shutdown must be positive")
+	}
+
+	if cfg.Timeouts.ReadHeader < 0 || cfg.Timeouts.Idle < 0 || cfg.Scanner.RequestTimeout < 0 {
+		invalid("timeouts must not be negative")
+	}
+
+	if cfg.Scanner.Concurrency < 1 {
+		invalid("scanner.concurrency must be at least 1")
+	}
+
+	return errors.Join(errs...)
+}
+
+// URI returns the connection string of the database
+func (m MongoConfig) URI() string {
+	u := &url.URL{
+		Scheme: "mongodb",
+		Host:   net.JoinHostPort(m.Host, m.Port),
+	}
+
+	if m.Username != "" {
+		u.User = url.UserPassword(m.Username, m.Password)
+	}
+
+	return u.String()
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// clearEnv unsets the variables Load reads for the duration of the test, including
+// those the env file sets, and restores them afterwards
+func clearEnv(t *testing.T) {
+	t.Helper()
+
+	envs := []string{"CONFIG_PATH"}
+	for _, opt := range options(Default()) {
+		envs = append(envs, opt.env)
+	}
+
+	for _, env := range envs {
+		t.Setenv(env, "")
+		os.Unsetenv(env)
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("writing %s: %v", name, err)
+	}
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		fromEnvPath bool
+		dotenv      string
+		env         map[string]string
+		args        []string
+		wantProxy   string
+		wantSOCKS   string
+		wantErr     string
+	}{
+		{
+			name:      "defaults",
+			wantProxy: ":8080",
+			wantSOCKS: "",
+		},
+		{
+			name:      "file over defaults",
+			file:      "proxy:\n  addr: \":9000\"\nsocks:\n  addr: \":1080\"\n",
+			wantProxy: ":9000",
+			wantSOCKS: ":1080",
+		},
+		{
+			name:        "file given by CONFIG_PATH",
+			file:        "proxy:\n  addr: \":9000\"\n",
+			fromEnvPath: true,
+			wantProxy:   ":9000",
+		},
+		{
+			name:      "env over file",
+			file:      "proxy:\n  addr: \":9000\"\n",
+			env:       map[string]string{"PROXY_ADDR": ":9001"},
+			wantProxy: ":9001",
+		},
+		{
+			name:      "flag over env",
+			file:      "proxy:\n  addr: \":9000\"\n",
+			env:       map[string]string{"PROXY_ADDR": ":9001"},
+			args:      []string{"-proxy-addr", ":9002"},
+			wantProxy: ":9002",
+		},
+		{
+			name:      "env set but empty still applies",
+			file:      "socks:\n  addr: \":1080\"\n",
+			env:       map[string]string{"SOCKS_ADDR": ""},
+			wantProxy: ":8080",
+			wantSOCKS: "",
+		},
+		{
+			name:      "env file applies",
+			dotenv:    "SOCKS_ADDR=:1081\n",
+			wantProxy: ":8080",
+			wantSOCKS: ":1081",
+		},
+		{
+			name:      "environment over env file",
+			dotenv:    "SOCKS_ADDR=:1081\n",
+			env:       map[string]string{"SOCKS_ADDR": ":1082"},
+			wantProxy: ":8080",
+			wantSOCKS: ":1082",
+		},
+		{
+			name:    "unknown file keys are rejected",
+			file:    "proxy:\n  adr: \":9000\"\n",
+			wantErr: "field adr not found",
+		},
+		{
+			name:    "invalid env value",
+			env:     map[string]string{"SCAN_CONCURRENCY": "many"},
+			wantErr: "env SCAN_CONCURRENCY",
+		},
+		{
+			name:    "loaded config is validated",
+			args:    []string{"-proxy-addr", ""},
+			wantErr: "proxy.addr is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+
+			args := []string{"-env-file", filepath.Join(t.TempDir(), "missing.env")}
+			if tt.dotenv != "" {
+				args = []string{"-env-file", writeFile(t, ".env", tt.dotenv)}
+			}
+
+			if tt.file != "" {
+				path := writeFile(t, "config.yaml", tt.file)
+				if tt.fromEnvPath {
+					t.Setenv("CONFIG_PATH", path)
+				} else {
+					args = append(args, "-config", path)
+				}
+			}
+
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := Load(append(args, tt.args...))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			if cfg.Proxy.Addr != tt.wantProxy || cfg.SOCKS.Addr != tt.wantSOCKS {
+				t.Errorf("proxy %q socks %q, want proxy %q socks %q", cfg.Proxy.Addr, cfg.SOCKS.Addr, tt.wantProxy, tt.wantSOCKS)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		want   []string
+	}{
+		{
+			name:   "defaults are valid",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name: "optional listeners may be empty but not malformed",
+			modify: func(cfg *Config) {
+				cfg.SOCKS.Addr = "1080"
+			},
+			want: []string{`config: socks.addr "1080" is not a host:port address`},
+		},
+		{
+			name: "every problem is reported at once",
+			modify: func(cfg *Config) {
+				cfg.Proxy.Addr = ""
+				cfg.API.TLSCert = "api.crt"
+				cfg.Capture.BodyLimit = MaxBodyLimit + 1
+				cfg.Scanner.Concurrency = 0
+			},
+			want: []string{
+				"config: proxy.addr is required",
+				"config: api.tls_cert and api.tls_key must be set together",
+				"config: api tls: stat api.crt: no such file or directory",
+				"config: capture.body_limit must be between 0 and 7340032",
+				"config: scanner.concurrency must be at least 1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(cfg)
+
+			var got []string
+			if err := cfg.Validate(); err != nil {
+				got = strings.Split(err.Error(), "\n")
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
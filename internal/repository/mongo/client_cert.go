@@ -0,0 +1,78 @@
+package mongo_repo
+
+import (
+	"context"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ClientCertificates struct {
+	Col *mongo.Collection
+}
+
+func NewClientCertificatesRepo(col *mongo.Collection) (r *ClientCertificates) {
+	return &ClientCertificates{
+		Col: col,
+	}
+}
+
+func (r *ClientCertificates) SaveClientCertificate(ctx context.Context, cert *domain.ClientCertificate) (savedCert *domain.ClientCertificate, err error) {
+	result, err := r.Col.InsertOne(ctx, cert)
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	cert.ID = result.InsertedID.(primitive.ObjectID).Hex()
+	savedCert = cert
+
+	return
+}
+
+func (r *ClientCertificates) GetClientCertificatesList(ctx context.Context) (certs []*domain.ClientCertificate, err error) {
+	certs = make([]*domain.ClientCertificate, 0)
+
+	cursor, err := r.Col.Find(ctx, primitive.M{})
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var cert domain.ClientCertificate
+		err = cursor.Decode(&cert)
+		if err != nil {
+			err = customerrors.ErrInternal
+			return
+		}
+
+		certs = append(certs, &cert)
+	}
+
+	return
+}
+
+func (r *ClientCertificates) DeleteClientCertificate(ctx context.Context, id string) (err error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		err = customerrors.ErrInvalidRequestID
+		return
+	}
+
+	result, err := r.Col.DeleteOne(ctx, primitive.M{"_id": objID})
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	if result.DeletedCount == 0 {
+		err = customerrors.ErrNotFound
+		return
+	}
+
+	return
+}
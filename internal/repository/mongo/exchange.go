@@ -0,0 +1,188 @@
+package mongo_repo
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Exchanges reads requests together with their responses
+type Exchanges struct {
+	Requests  *mongo.Collection
+	Responses *mongo.Collection
+}
+
+func NewExchangesRepo(requests *mongo.Collection, responses *mongo.Collection) (r *Exchanges) {
+	return &Exchanges{
+		Requests:  requests,
+		Responses: responses,
+	}
+}
+
+// exchangeDoc is a request joined with its first response
+type exchangeDoc struct {
+	domain.HTTPRequest `bson:",inline"`
+	Responses          []*domain.HTTPResponse `bson:"responses"`
+}
+
+// EachExchange calls fn for every request matching query.Filter that contains all query.Words,
+// from the newest to the oldest one, starting after the request with ID query.Cursor if it is set.
+// It stops once fn returns false. Requests are looked up by their words in the text index, so fn
+// still has to check that they contain the searched text. Only the parts in query.Fields are read:
+// request bodies for request_body and the first response, in Response, for the response fields.
+// Paging and sorting of the filter are not used.
+func (r *Exchanges) EachExchange(ctx context.Context, query *domain.SearchQuery, fn func(req *domain.HTTPRequest) bool) (err error) {
+	if len(query.Words) == 0 {
+		return customerrors.ErrInvalidRequest
+	}
+
+	// $text has to be part of the first stage of the pipeline
+	conditions := append([]primitive.M{{"$text": primitive.M{"$search": textSearch(query.Words)}}}, requestsQuery(query.Filter)...)
+
+	if query.Cursor != "" {
+		beforeID, err := primitive.ObjectIDFromHex(query.Cursor)
+		if err != nil {
+			return customerrors.ErrInvalidRequest
+		}
+
+		conditions = append(conditions, primitive.M{"_id": primitive.M{"$lt": beforeID}})
+	}
+
+	project := primitive.M{"search_words": 0}
+	if !slices.Contains(query.Fields, domain.SearchFieldRequestBody) {
+		project["body"] = 0
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: primitive.M{"$and": conditions}}},
+		{{Key: "$sort", Value: primitive.D{{Key: "_id", Value: -1}}}},
+		{{Key: "$project", Value: project}},
+	}
+
+	withHeaders := slices.Contains(query.Fields, domain.SearchFieldResponseHeaders)
+	withBody := slices.Contains(query.Fields, domain.SearchFieldResponseBody)
+	if withHeaders || withBody {
+		pipeline = append(pipeline, firstResponseLookup(r.Responses.Name(), withBody))
+	}
+
+	// Requests with common words may not fit in memory to be sorted
+	cursor, err := r.Requests.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return customerrors.ErrInternal
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc exchangeDoc
+		err = cursor.Decode(&doc)
+		if err != nil {
+			return customerrors.ErrInternal
+		}
+
+		req := &doc.HTTPRequest
+		if len(doc.Responses) > 0 {
+			req.Response = doc.Responses[0]
+			fillBody(req.Response)
+		}
+
+		if !fn(req) {
+			return
+		}
+	}
+
+	if cursor.Err() != nil {
+		return customerrors.ErrInternal
+	}
+
+	return
+}
+
+// textSearch returns the $text search for requests containing all words, each one is
+// a phrase, as terms that are not quoted match requests containing any of them
+func textSearch(words []string) string {
+	phrases := make([]string, 0, len(words))
+	for _, word := range words {
+		phrases = append(phrases, `"`+word+`"`)
+	}
+
+	return strings.Join(phrases, " ")
+}
+
+// firstResponseLookup joins the earliest response of each request from the responses
+// collection as "responses", leaving out its bodies unless withBody is set
+func firstResponseLookup(responses string, withBody bool) primitive.D {
+	// Responses refer to requests by the hex of their ID
+	lookup := mongo.Pipeline{
+		{{Key: "$match", Value: primitive.M{"$expr": primitive.M{"$eq": primitive.A{"$request_id", "$$id"}}}}},
+		{{Key: "$sort", Value: primitive.D{{Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: 1}},
+	}
+	if !withBody {
+		lookup = append(lookup, primitive.D{{Key: "$project", Value: primitive.M{"body": 0, "raw_body": 0}}})
+	}
+
+	return primitive.D{{Key: "$lookup", Value: primitive.D{
+		{Key: "from", Value: responses},
+		{Key: "let", Value: primitive.D{{Key: "id", Value: primitive.M{"$toString": "$_id"}}}},
+		{Key: "pipeline", Value: lookup},
+		{Key: "as", Value: "responses"},
+	}}}
+}
+
+// IndexSearchWords stores the search words of requests saved before they were indexed,
+// together with those of their first responses. It returns once all of them are done
+// or ctx is cancelled, which leaves the rest for the next run.
+func (r *Exchanges) IndexSearchWords(ctx context.Context) (err error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: primitive.M{"search_words": primitive.M{"$exists": false}}}},
+		firstResponseLookup(r.Responses.Name(), true),
+	}
+
+	cursor, err := r.Requests.Aggregate(ctx, pipeline)
+	if err != nil {
+		return customerrors.ErrInternal
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc exchangeDoc
+		err = cursor.Decode(&doc)
+		if err != nil {
+			return customerrors.ErrInternal
+		}
+
+		words := requestWords(&doc.HTTPRequest)
+		if len(doc.Responses) > 0 {
+			fillBody(doc.Responses[0])
+			words = append(words, responseWords(doc.Responses[0])...)
+		}
+
+		var objID primitive.ObjectID
+		objID, err = primitive.ObjectIDFromHex(doc.ID)
+		if err != nil {
+			return customerrors.ErrInternal
+		}
+
+		update := primitive.M{"$addToSet": primitive.M{"search_words": primitive.M{"$each": words}}}
+		_, err = r.Requests.UpdateOne(ctx, primitive.M{"_id": objID}, update)
+		if err != nil {
+			break
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	if err != nil || cursor.Err() != nil {
+		return customerrors.ErrInternal
+	}
+
+	return
+}
@@ -0,0 +1,61 @@
+package mongo_repo
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/burp_junior/domain"
+)
+
+func TestTextSearch(t *testing.T) {
+	tests := []struct {
+		name  string
+		words []string
+		want  string
+	}{
+		{
+			name:  "one word",
+			words: []string{"token"},
+			want:  `"token"`,
+		},
+		{
+			name:  "every word is a phrase, so all of them are required",
+			words: []string{"set", "cookie", "sid"},
+			want:  `"set" "cookie" "sid"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := textSearch(tt.words); got != tt.want {
+				t.Errorf("textSearch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestWords(t *testing.T) {
+	req := &domain.HTTPRequest{
+		Path:       "/Login",
+		RawHeaders: []string{"Host: example.com", "X-Token: abc"},
+		GetParams:  map[string][]string{"next": {"/home"}},
+		Body:       []byte("token=abc&pic=\xff\xd8binary"),
+	}
+
+	want := []string{"login", "host", "example", "com", "x", "token", "abc", "next", "home", "pic"}
+	if got := requestWords(req); !slices.Equal(got, want) {
+		t.Errorf("requestWords() = %q, want %q", got, want)
+	}
+}
+
+func TestResponseWords(t *testing.T) {
+	resp := &domain.HTTPResponse{
+		Headers: map[string][]string{"Set-Cookie": {"sid=1"}},
+		Body:    []byte(`{"sid":"2"}`),
+	}
+
+	want := []string{"set", "cookie", "sid", "1", "2"}
+	if got := responseWords(resp); !slices.Equal(got, want) {
+		t.Errorf("responseWords() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,22 @@
+package mongo_repo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+type DatabasePinger struct {
+	Client *mongo.Client
+}
+
+func NewDatabasePinger(client *mongo.Client) (p *DatabasePinger) {
+	return &DatabasePinger{
+		Client: client,
+	}
+}
+
+func (p *DatabasePinger) Ping(ctx context.Context) (err error) {
+	return p.Client.Ping(ctx, readpref.Primary())
+}
@@ -0,0 +1,52 @@
+package mongo_repo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// networkDocID is the _id of the single document holding network profiles
+const networkDocID = "network"
+
+type NetworkProfiles struct {
+	Col *mongo.Collection
+}
+
+func NewNetworkProfilesRepo(col *mongo.Collection) (r *NetworkProfiles) {
+	return &NetworkProfiles{
+		Col: col,
+	}
+}
+
+func (r *NetworkProfiles) GetNetworkProfileSettings(ctx context.Context) (settings *domain.NetworkProfileSettings, err error) {
+	settings = &domain.NetworkProfileSettings{}
+
+	err = r.Col.FindOne(ctx, primitive.M{"_id": networkDocID}).Decode(settings)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = nil
+		return
+	}
+
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	return
+}
+
+func (r *NetworkProfiles) SaveNetworkProfileSettings(ctx context.Context, settings *domain.NetworkProfileSettings) (err error) {
+	_, err = r.Col.ReplaceOne(ctx, primitive.M{"_id": networkDocID}, settings, options.Replace().SetUpsert(true))
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	return
+}
@@ -0,0 +1,100 @@
+package mongo_repo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// passthroughDocID is the _id of the single document holding passthrough settings
+const passthroughDocID = "passthrough"
+
+type PassthroughSettings struct {
+	Col *mongo.Collection
+}
+
+func NewPassthroughSettingsRepo(col *mongo.Collection) (r *PassthroughSettings) {
+	return &PassthroughSettings{
+		Col: col,
+	}
+}
+
+func (r *PassthroughSettings) GetPassthroughSettings(ctx context.Context) (settings *domain.PassthroughSettings, err error) {
+	settings = &domain.PassthroughSettings{}
+
+	err = r.Col.FindOne(ctx, primitive.M{"_id": passthroughDocID}).Decode(settings)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = nil
+		return
+	}
+
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	return
+}
+
+func (r *PassthroughSettings) SavePassthroughSettings(ctx context.Context, settings *domain.PassthroughSettings) (err error) {
+	_, err = r.Col.ReplaceOne(ctx, primitive.M{"_id": passthroughDocID}, settings, options.Replace().SetUpsert(true))
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	return
+}
+
+type PassthroughTunnels struct {
+	Col *mongo.Collection
+}
+
+func NewPassthroughTunnelsRepo(col *mongo.Collection) (r *PassthroughTunnels) {
+	return &PassthroughTunnels{
+		Col: col,
+	}
+}
+
+func (r *PassthroughTunnels) SavePassthroughTunnel(ctx context.Context, tunnel *domain.PassthroughTunnel) (savedTunnel *domain.PassthroughTunnel, err error) {
+	result, err := r.Col.InsertOne(ctx, tunnel)
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	tunnel.ID = result.InsertedID.(primitive.ObjectID).Hex()
+	savedTunnel = tunnel
+
+	return
+}
+
+func (r *PassthroughTunnels) GetPassthroughTunnelsList(ctx context.Context) (tunnels []*domain.PassthroughTunnel, err error) {
+	tunnels = make([]*domain.PassthroughTunnel, 0)
+
+	opts := options.Find().SetSort(primitive.D{{Key: "started_at", Value: -1}})
+	cursor, err := r.Col.Find(ctx, primitive.M{}, opts)
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var tunnel domain.PassthroughTunnel
+		err = cursor.Decode(&tunnel)
+		if err != nil {
+			err = customerrors.ErrInternal
+			return
+		}
+
+		tunnels = append(tunnels, &tunnel)
+	}
+
+	return
+}
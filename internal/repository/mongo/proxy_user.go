@@ -0,0 +1,78 @@
+package mongo_repo
+
+import (
+	"context"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ProxyUsers struct {
+	Col *mongo.Collection
+}
+
+func NewProxyUsersRepo(col *mongo.Collection) (r *ProxyUsers) {
+	return &ProxyUsers{
+		Col: col,
+	}
+}
+
+func (r *ProxyUsers) SaveProxyUser(ctx context.Context, user *domain.ProxyUser) (savedUser *domain.ProxyUser, err error) {
+	result, err := r.Col.InsertOne(ctx, user)
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	user.ID = result.InsertedID.(primitive.ObjectID).Hex()
+	savedUser = user
+
+	return
+}
+
+func (r *ProxyUsers) GetProxyUsersList(ctx context.Context) (users []*domain.ProxyUser, err error) {
+	users = make([]*domain.ProxyUser, 0)
+
+	cursor, err := r.Col.Find(ctx, primitive.M{})
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user domain.ProxyUser
+		err = cursor.Decode(&user)
+		if err != nil {
+			err = customerrors.ErrInternal
+			return
+		}
+
+		users = append(users, &user)
+	}
+
+	return
+}
+
+func (r *ProxyUsers) DeleteProxyUser(ctx context.Context, id string) (err error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		err = customerrors.ErrInvalidRequestID
+		return
+	}
+
+	result, err := r.Col.DeleteOne(ctx, primitive.M{"_id": objID})
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	if result.DeletedCount == 0 {
+		err = customerrors.ErrNotFound
+		return
+	}
+
+	return
+}
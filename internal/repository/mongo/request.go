@@ -1,72 +1,176 @@
-package mongo_repo
-
-import (
-	"context"
-
-	"github.com/burp_junior/customerrors"
-	"github.com/burp_junior/domain"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-)
-
-type Requests struct {
-	Col *mongo.Collection
-}
-
-func NewRequestsRepo(col *mongo.Collection) (r *Requests) {
-	return &Requests{
-		Col: col,
-	}
-}
-
-func (r *Requests) SaveRequest(ctx context.Context, req *domain.HTTPRequest) (savedReq *domain.HTTPRequest, err error) {
-	result, err := r.Col.InsertOne(context.Background(), req)
-	if err != nil {
-		err = customerrors.ErrInternal
-		return
-	}
-
-	req.ID = result.InsertedID.(primitive.ObjectID).Hex()
-	savedReq = req
-
-	return
-}
-
-func (r *Requests) GetRequestsList(ctx context.Context) (reqs []*domain.HTTPRequest, err error) {
-	reqs = make([]*domain.HTTPRequest, 0)
-
-	cursor, err := r.Col.Find(context.Background(), primitive.M{})
-	if err != nil {
-		err = customerrors.ErrInternal
-		return
-	}
-
-	for cursor.Next(context.Background()) {
-		var req domain.HTTPRequest
-		err = cursor.Decode(&req)
-		if err != nil {
-			err = customerrors.ErrInternal
-			return
-		}
-
-		reqs = append(reqs, &req)
-	}
-
-	return
-}
-
-func (r *Requests) GetRequestByID(ctx context.Context, id string) (req *domain.HTTPRequest, err error) {
-	objID, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		err = customerrors.ErrInvalidRequestID
-		return
-	}
-
-	err = r.Col.FindOne(context.Background(), primitive.M{"_id": objID}).Decode(&req)
-	if err != nil {
-		err = customerrors.ErrNotFound
-		return
-	}
-
-	return
-}
+package mongo_repo
+
+import (
+	"context"
+	"strings"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/searchwords"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Requests struct {
+	Col *mongo.Collection
+}
+
+func NewRequestsRepo(col *mongo.Collection) (r *Requests) {
+	return &Requests{
+		Col: col,
+	}
+}
+
+// maxSearchWords bounds the distinct words indexed for each of a request and its response
+const maxSearchWords = 50000
+
+// requestDoc is a request as it is stored, with the words it is found by in the search,
+// the words of its first response are added to them when it is received
+type requestDoc struct {
+	*domain.HTTPRequest `bson:",inline"`
+	SearchWords         []string `bson:"search_words"`
+}
+
+// requestWords returns the words of the searched parts of req
+func requestWords(req *domain.HTTPRequest) []string {
+	words := searchwords.NewSet(maxSearchWords)
+	words.Add([]byte(req.Path))
+	words.Add([]byte(strings.Join(req.HeaderLines(), "\n")))
+	words.Add([]byte(strings.Join(req.ParamLines(), "\n")))
+	words.Add(req.Body)
+
+	return words.Words()
+}
+
+// responseWords returns the words of the searched parts of resp
+func responseWords(resp *domain.HTTPResponse) []string {
+	words := searchwords.NewSet(maxSearchWords)
+	words.Add([]byte(strings.Join(domain.HeaderLines(resp.Headers), "\n")))
+	words.Add(resp.Body)
+
+	return words.Words()
+}
+
+func (r *Requests) SaveRequest(ctx context.Context, req *domain.HTTPRequest) (savedReq *domain.HTTPRequest, err error) {
+	doc := &requestDoc{
+		HTTPRequest: req,
+		SearchWords: requestWords(req),
+	}
+
+	result, err := r.Col.InsertOne(context.Background(), doc)
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	req.ID = result.InsertedID.(primitive.ObjectID).Hex()
+	savedReq = req
+
+	return
+}
+
+// GetRequestsList returns a page of the requests matching filter. Requests sorted by a timing
+// metric are listed in two runs: those with timing by the metric, then those without it by time.
+func (r *Requests) GetRequestsList(ctx context.Context, filter *domain.RequestsFilter) (page *domain.RequestsPage, err error) {
+	return listRequests(ctx, filter, r.find)
+}
+
+// find returns at most limit requests matching all conditions of query
+func (r *Requests) find(ctx context.Context, query []primitive.M, sort primitive.D, limit int) (reqs []*domain.HTTPRequest, err error) {
+	filter := primitive.M{}
+	if len(query) > 0 {
+		filter = primitive.M{"$and": query}
+	}
+
+	opts := options.Find().SetSort(sort).SetLimit(int64(limit))
+
+	cursor, err := r.Col.Find(ctx, filter, opts)
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+	defer cursor.Close(ctx)
+
+	reqs = make([]*domain.HTTPRequest, 0)
+	for cursor.Next(ctx) {
+		var req domain.HTTPRequest
+		err = cursor.Decode(&req)
+		if err != nil {
+			err = customerrors.ErrInternal
+			return
+		}
+
+		reqs = append(reqs, &req)
+	}
+
+	if cursor.Err() != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	return
+}
+
+func (r *Requests) GetRequestByID(ctx context.Context, id string) (req *domain.HTTPRequest, err error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		err = customerrors.ErrInvalidRequestID
+		return
+	}
+
+	err = r.Col.FindOne(context.Background(), primitive.M{"_id": objID}).Decode(&req)
+	if err != nil {
+		err = customerrors.ErrNotFound
+		return
+	}
+
+	return
+}
+
+// SetRequestResponse stores the summary of resp on the request and adds its words to the search words
+// of the request, unless it already has the summary of an earlier response
+func (r *Requests) SetRequestResponse(ctx context.Context, id string, resp *domain.HTTPResponse) (err error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		err = customerrors.ErrInvalidRequestID
+		return
+	}
+
+	filter := primitive.M{"_id": objID, "status": primitive.M{"$exists": false}}
+	update := primitive.M{
+		"$set":      resp.Summary(),
+		"$addToSet": primitive.M{"search_words": primitive.M{"$each": responseWords(resp)}},
+	}
+	_, err = r.Col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	return
+}
+
+// requestIndexes back the filters and sort orders of GetRequestsList and the search.
+// Every list index ends with _id, which breaks ties for pagination.
+var requestIndexes = []mongo.IndexModel{
+	{Keys: primitive.D{{Key: "host", Value: 1}, {Key: "_id", Value: 1}}},
+	{Keys: primitive.D{{Key: "method", Value: 1}, {Key: "_id", Value: 1}}},
+	{Keys: primitive.D{{Key: "status", Value: 1}, {Key: "_id", Value: 1}}},
+	{Keys: primitive.D{{Key: "tester", Value: 1}, {Key: "project", Value: 1}, {Key: "_id", Value: 1}}},
+	{Keys: primitive.D{{Key: "project", Value: 1}, {Key: "_id", Value: 1}}},
+	{Keys: primitive.D{{Key: "timing.total", Value: 1}, {Key: "_id", Value: 1}}},
+	{Keys: primitive.D{{Key: "timing.ttfb", Value: 1}, {Key: "_id", Value: 1}}},
+	{Keys: primitive.D{{Key: "timing.response_size", Value: 1}, {Key: "_id", Value: 1}}},
+	// Exchanges are searched by their words, which are already split and lower-cased
+	{
+		Keys:    primitive.D{{Key: "search_words", Value: "text"}},
+		Options: options.Index().SetDefaultLanguage("none"),
+	},
+}
+
+// EnsureIndexes creates the indexes of the collection that do not exist yet
+func (r *Requests) EnsureIndexes(ctx context.Context) (err error) {
+	_, err = r.Col.Indexes().CreateMany(ctx, requestIndexes)
+	return
+}
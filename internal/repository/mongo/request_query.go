@@ -0,0 +1,321 @@
+package mongo_repo
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// timingFields are the document fields of the Timing* metrics
+var timingFields = map[string]string{
+	domain.TimingDNS:          "timing.dns",
+	domain.TimingConnect:      "timing.connect",
+	domain.TimingTLSHandshake: "timing.tls_handshake",
+	domain.TimingTTFB:         "timing.ttfb",
+	domain.TimingTotal:        "timing.total",
+	domain.TimingRequestSize:  "timing.request_size",
+	domain.TimingResponseSize: "timing.response_size",
+}
+
+// requestsCursor is the position after the last request of a page. Value is the sort
+// metric of that request, nil when sorting by time or once requests without timing are listed.
+// An empty ID starts the listing of requests without timing from the beginning.
+type requestsCursor struct {
+	Value *int64 `json:"v,omitempty"`
+	ID    string `json:"id"`
+}
+
+func encodeCursor(c *requestsCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (c *requestsCursor, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, customerrors.ErrInvalidRequest
+	}
+
+	c = &requestsCursor{}
+	err = json.Unmarshal(data, c)
+	if err != nil || (c.Value != nil && c.ID == "") {
+		return nil, customerrors.ErrInvalidRequest
+	}
+
+	return
+}
+
+// requestsFinder returns at most limit requests matching all conditions of query, in sort order
+type requestsFinder func(ctx context.Context, query []primitive.M, sort primitive.D, limit int) (reqs []*domain.HTTPRequest, err error)
+
+// listRequests builds the queries of the page of filter, which are run by find
+func listRequests(ctx context.Context, filter *domain.RequestsFilter, find requestsFinder) (page *domain.RequestsPage, err error) {
+	page = &domain.RequestsPage{
+		Requests: make([]*domain.HTTPRequest, 0),
+	}
+
+	var cursor *requestsCursor
+	if filter.Cursor != "" {
+		cursor, err = decodeCursor(filter.Cursor)
+		if err != nil {
+			return
+		}
+	}
+
+	var after primitive.ObjectID
+	if cursor != nil && cursor.ID != "" {
+		after, err = primitive.ObjectIDFromHex(cursor.ID)
+		if err != nil {
+			err = customerrors.ErrInvalidRequest
+			return
+		}
+	}
+
+	order, beyond := 1, "$gt"
+	if filter.SortDesc {
+		order, beyond = -1, "$lt"
+	}
+
+	query := requestsQuery(filter)
+	field := timingFields[filter.SortBy]
+
+	if field != "" && (cursor == nil || cursor.Value != nil) {
+		timed := append(slices.Clone(query), primitive.M{field: primitive.M{"$exists": true}})
+		if cursor != nil {
+			timed = append(timed, primitive.M{"$or": []primitive.M{
+				{field: primitive.M{beyond: *cursor.Value}},
+				{field: *cursor.Value, "_id": primitive.M{beyond: after}},
+			}})
+		}
+
+		var reqs []*domain.HTTPRequest
+		reqs, err = find(ctx, timed, primitive.D{{Key: field, Value: order}, {Key: "_id", Value: order}}, filter.Limit+1)
+		if err != nil {
+			return
+		}
+
+		if len(reqs) > filter.Limit {
+			page.Requests = reqs[:filter.Limit]
+			last := page.Requests[filter.Limit-1]
+			value, _ := last.Timing.Value(filter.SortBy)
+			page.NextCursor = encodeCursor(&requestsCursor{Value: &value, ID: last.ID})
+			return
+		}
+
+		page.Requests = reqs
+
+		// Bounds leave out requests without timing
+		if len(filter.Min) > 0 || len(filter.Max) > 0 {
+			return
+		}
+
+		cursor, after = nil, primitive.NilObjectID
+	}
+
+	if field != "" {
+		query = append(query, primitive.M{field: primitive.M{"$exists": false}})
+	}
+
+	if !after.IsZero() {
+		query = append(query, primitive.M{"_id": primitive.M{beyond: after}})
+	}
+
+	rest := filter.Limit - len(page.Requests)
+	reqs, err := find(ctx, query, primitive.D{{Key: "_id", Value: order}}, rest+1)
+	if err != nil {
+		return
+	}
+
+	if len(reqs) > rest {
+		page.Requests = append(page.Requests, reqs[:rest]...)
+
+		next := &requestsCursor{}
+		if rest > 0 {
+			next.ID = page.Requests[len(page.Requests)-1].ID
+		}
+		page.NextCursor = encodeCursor(next)
+		return
+	}
+
+	page.Requests = append(page.Requests, reqs...)
+
+	return
+}
+
+// requestsQuery translates every condition of filter but the cursor
+func requestsQuery(filter *domain.RequestsFilter) (query []primitive.M) {
+	equal := map[string]string{
+		"host":    filter.Host,
+		"method":  filter.Method,
+		"tester":  filter.Tester,
+		"project": filter.Project,
+	}
+	for field, value := range equal {
+		if value != "" {
+			query = append(query, primitive.M{field: value})
+		}
+	}
+
+	if filter.Status != 0 {
+		query = append(query, primitive.M{"status": filter.Status})
+	}
+
+	if filter.Path != "" {
+		query = append(query, primitive.M{"path": primitive.Regex{Pattern: regexp.QuoteMeta(filter.Path)}})
+	}
+
+	if filter.ContentType != "" {
+		query = append(query, primitive.M{"content_type": primitive.Regex{Pattern: regexp.QuoteMeta(filter.ContentType), Options: "i"}})
+	}
+
+	if !filter.From.IsZero() {
+		query = append(query, primitive.M{"_id": primitive.M{"$gte": firstObjectIDAt(filter.From)}})
+	}
+
+	if !filter.To.IsZero() {
+		query = append(query, primitive.M{"_id": primitive.M{"$lt": firstObjectIDAt(filter.To.Add(time.Second))}})
+	}
+
+	if filter.HasParams != nil {
+		params := []primitive.M{
+			{"get_params": primitive.M{"$exists": true}},
+			{"post_params": primitive.M{"$exists": true}},
+		}
+
+		if *filter.HasParams {
+			query = append(query, primitive.M{"$or": params})
+		} else {
+			query = append(query, primitive.M{"$nor": params})
+		}
+	}
+
+	for metric, bound := range filter.Min {
+		query = append(query, primitive.M{timingFields[metric]: primitive.M{"$gte": bound}})
+	}
+
+	for metric, bound := range filter.Max {
+		query = append(query, primitive.M{timingFields[metric]: primitive.M{"$lte": bound}})
+	}
+
+	if filter.Scope != nil {
+		query = append(query, scopeQuery(filter.Scope)...)
+	}
+
+	return
+}
+
+// firstObjectIDAt returns the lowest object ID created in the second of t,
+// object IDs start with the second they were created at
+func firstObjectIDAt(t time.Time) (id primitive.ObjectID) {
+	binary.BigEndian.PutUint32(id[:4], uint32(t.Unix()))
+	return
+}
+
+// scopeQuery matches requests the way the scope service does: any include rule
+// (or there are none) and no exclude rule
+func scopeQuery(scope *domain.Scope) (query []primitive.M) {
+	if len(scope.Include) > 0 {
+		include := make([]primitive.M, 0, len(scope.Include))
+		for _, rule := range scope.Include {
+			include = append(include, scopeRuleQuery(rule))
+		}
+		query = append(query, primitive.M{"$or": include})
+	}
+
+	if len(scope.Exclude) > 0 {
+		exclude := make([]primitive.M, 0, len(scope.Exclude))
+		for _, rule := range scope.Exclude {
+			exclude = append(exclude, scopeRuleQuery(rule))
+		}
+		query = append(query, primitive.M{"$nor": exclude})
+	}
+
+	return
+}
+
+func scopeRuleQuery(rule domain.ScopeRule) primitive.M {
+	conditions := []primitive.M{}
+
+	if rule.Scheme != "" {
+		conditions = append(conditions, primitive.M{"scheme": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(rule.Scheme) + "$", Options: "i"}})
+	}
+
+	if rule.HostPattern != "" {
+		conditions = append(conditions, primitive.M{"host": primitive.Regex{Pattern: globToRegex(rule.HostPattern), Options: "i"}})
+	}
+
+	if rule.Port != "" {
+		conditions = append(conditions, primitive.M{"port": rule.Port})
+	}
+
+	if rule.PathPrefix != "" {
+		conditions = append(conditions, primitive.M{"path": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(rule.PathPrefix)}})
+	}
+
+	if rule.PathRegex != "" {
+		conditions = append(conditions, primitive.M{"path": primitive.Regex{Pattern: rule.PathRegex}})
+	}
+
+	if len(conditions) == 0 {
+		return primitive.M{}
+	}
+
+	return primitive.M{"$and": conditions}
+}
+
+// globToRegex translates a path.Match pattern, already known to be valid, into an anchored regex
+func globToRegex(pattern string) string {
+	re := &strings.Builder{}
+	re.WriteString("^")
+
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			// Escaped characters are literal, also inside classes
+			i++
+			if isAlphanumeric(pattern[i]) {
+				re.WriteByte(pattern[i])
+			} else {
+				re.WriteByte('\\')
+				re.WriteByte(pattern[i])
+			}
+		case inClass && c == ']':
+			inClass = false
+			re.WriteByte(']')
+		case inClass:
+			re.WriteByte(c)
+		case c == '[':
+			inClass = true
+			re.WriteByte('[')
+			if i+1 < len(pattern) && pattern[i+1] == '^' {
+				i++
+				re.WriteByte('^')
+			}
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	re.WriteString("$")
+
+	return re.String()
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
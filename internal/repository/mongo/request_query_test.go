@@ -0,0 +1,436 @@
+package mongo_repo
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGlobToRegex(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		want     string
+		matching []string
+		other    []string
+	}{
+		{
+			pattern:  "*.example.com",
+			want:     `^[^/]*\.example\.com$`,
+			matching: []string{"api.example.com", ".example.com"},
+			other:    []string{"example.com", "apiXexample.com", "a.example.com.evil"},
+		},
+		{
+			pattern:  "api-?.test",
+			want:     `^api-[^/]\.test$`,
+			matching: []string{"api-1.test"},
+			other:    []string{"api-.test", "api-12.test"},
+		},
+		{
+			pattern:  "[a-c]x[^0-9]",
+			want:     `^[a-c]x[^0-9]$`,
+			matching: []string{"axb"},
+			other:    []string{"dxb", "ax1"},
+		},
+		{
+			pattern:  "a+b(c)|d{2}$^",
+			want:     `^a\+b\(c\)\|d\{2\}\$\^$`,
+			matching: []string{"a+b(c)|d{2}$^"},
+			other:    []string{"aab(c)|d{2}$^", "a+bc"},
+		},
+		{
+			pattern:  `\*\a\.`,
+			want:     `^\*a\.$`,
+			matching: []string{"*a."},
+			other:    []string{"xa.", "*ab"},
+		},
+		{
+			pattern:  `[\]a]`,
+			want:     `^[\]a]$`,
+			matching: []string{"]", "a"},
+			other:    []string{"b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got := globToRegex(tt.pattern)
+			if got != tt.want {
+				t.Fatalf("globToRegex(%q) = %q, want %q", tt.pattern, got, tt.want)
+			}
+
+			re := regexp.MustCompile(got)
+			for _, name := range append(tt.matching, tt.other...) {
+				want, err := path.Match(tt.pattern, name)
+				if err != nil {
+					t.Fatalf("path.Match(%q): %v", tt.pattern, err)
+				}
+
+				if re.MatchString(name) != want {
+					t.Errorf("%q matches %q: %v, path.Match: %v", got, name, !want, want)
+				}
+
+				if want != slices.Contains(tt.matching, name) {
+					t.Errorf("path.Match(%q, %q) = %v, the case is wrong", tt.pattern, name, want)
+				}
+			}
+		})
+	}
+}
+
+func TestScopeQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope *domain.Scope
+		want  []primitive.M
+	}{
+		{
+			name:  "empty scope matches everything",
+			scope: &domain.Scope{},
+			want:  nil,
+		},
+		{
+			name: "any include rule",
+			scope: &domain.Scope{Include: []domain.ScopeRule{
+				{Scheme: "HTTPS", HostPattern: "*.example.com"},
+				{Port: "8443", PathPrefix: "/api.v1"},
+			}},
+			want: []primitive.M{
+				{"$or": []primitive.M{
+					{"$and": []primitive.M{
+						{"scheme": primitive.Regex{Pattern: "^HTTPS$", Options: "i"}},
+						{"host": primitive.Regex{Pattern: `^[^/]*\.example\.com$`, Options: "i"}},
+					}},
+					{"$and": []primitive.M{
+						{"port": "8443"},
+						{"path": primitive.Regex{Pattern: `^/api\.v1`}},
+					}},
+				}},
+			},
+		},
+		{
+			name: "no exclude rule",
+			scope: &domain.Scope{Exclude: []domain.ScopeRule{
+				{PathRegex: `\.(png|css)$`},
+			}},
+			want: []primitive.M{
+				{"$nor": []primitive.M{
+					{"$and": []primitive.M{
+						{"path": primitive.Regex{Pattern: `\.(png|css)$`}},
+					}},
+				}},
+			},
+		},
+		{
+			name: "include and exclude, an empty rule matches everything",
+			scope: &domain.Scope{
+				Include: []domain.ScopeRule{{}},
+				Exclude: []domain.ScopeRule{{Port: "80"}},
+			},
+			want: []primitive.M{
+				{"$or": []primitive.M{{}}},
+				{"$nor": []primitive.M{{"$and": []primitive.M{{"port": "80"}}}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scopeQuery(tt.scope)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scopeQuery() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	value := int64(20)
+
+	tests := []struct {
+		name    string
+		cursor  string
+		want    *requestsCursor
+		wantErr bool
+	}{
+		{
+			name:   "time cursor",
+			cursor: encodeCursor(&requestsCursor{ID: "65f0c0de0000000000000001"}),
+			want:   &requestsCursor{ID: "65f0c0de0000000000000001"},
+		},
+		{
+			name:   "metric cursor",
+			cursor: encodeCursor(&requestsCursor{Value: &value, ID: "65f0c0de0000000000000001"}),
+			want:   &requestsCursor{Value: &value, ID: "65f0c0de0000000000000001"},
+		},
+		{
+			name:   "start of requests without timing",
+			cursor: encodeCursor(&requestsCursor{}),
+			want:   &requestsCursor{},
+		},
+		{
+			name:    "not base64",
+			cursor:  "not a cursor!",
+			wantErr: true,
+		},
+		{
+			name:    "not json",
+			cursor:  base64.RawURLEncoding.EncodeToString([]byte("{")),
+			wantErr: true,
+		},
+		{
+			name:    "metric without id",
+			cursor:  base64.RawURLEncoding.EncodeToString([]byte(`{"v":20}`)),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCursor(tt.cursor)
+			if tt.wantErr {
+				if !errors.Is(err, customerrors.ErrInvalidRequest) {
+					t.Fatalf("decodeCursor() error = %v, want %v", err, customerrors.ErrInvalidRequest)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeCursor() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeCursor() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// memoryFinder runs the queries of listRequests over reqs, it knows only the operators they use
+func memoryFinder(reqs []*domain.HTTPRequest) requestsFinder {
+	return func(ctx context.Context, query []primitive.M, sort primitive.D, limit int) (found []*domain.HTTPRequest, err error) {
+		for _, req := range reqs {
+			if matchesAll(req, query) {
+				found = append(found, req)
+			}
+		}
+
+		slices.SortFunc(found, func(a, b *domain.HTTPRequest) int {
+			for _, key := range sort {
+				if c := compareValues(fieldValue(a, key.Key), fieldValue(b, key.Key)); c != 0 {
+					return c * key.Value.(int)
+				}
+			}
+			return 0
+		})
+
+		return found[:min(limit, len(found))], nil
+	}
+}
+
+func matchesAll(req *domain.HTTPRequest, query []primitive.M) bool {
+	for _, cond := range query {
+		if !matches(req, cond) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matches(req *domain.HTTPRequest, cond primitive.M) bool {
+	for field, expected := range cond {
+		if field == "$or" {
+			if !slices.ContainsFunc(expected.([]primitive.M), func(c primitive.M) bool { return matches(req, c) }) {
+				return false
+			}
+			continue
+		}
+
+		value := fieldValue(req, field)
+		ops, ok := expected.(primitive.M)
+		if !ok {
+			ops = primitive.M{"$eq": expected}
+		}
+
+		for op, operand := range ops {
+			var matched bool
+			switch op {
+			case "$exists":
+				matched = (value != nil) == operand.(bool)
+			case "$eq":
+				matched = value != nil && compareValues(value, operand) == 0
+			case "$gt":
+				matched = value != nil && compareValues(value, operand) > 0
+			case "$gte":
+				matched = value != nil && compareValues(value, operand) >= 0
+			case "$lt":
+				matched = value != nil && compareValues(value, operand) < 0
+			case "$lte":
+				matched = value != nil && compareValues(value, operand) <= 0
+			default:
+				panic("unexpected operator " + op)
+			}
+
+			if !matched {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// fieldValue returns _id or a timing metric of req, nil if it has no timing
+func fieldValue(req *domain.HTTPRequest, field string) any {
+	if field == "_id" {
+		id, _ := primitive.ObjectIDFromHex(req.ID)
+		return id
+	}
+
+	for metric, name := range timingFields {
+		if name == field {
+			if req.Timing == nil {
+				return nil
+			}
+			value, _ := req.Timing.Value(metric)
+			return value
+		}
+	}
+
+	panic("unexpected field " + field)
+}
+
+// compareValues orders values the way MongoDB does, missing ones first
+func compareValues(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if id, ok := a.(primitive.ObjectID); ok {
+		other := b.(primitive.ObjectID)
+		return bytes.Compare(id[:], other[:])
+	}
+
+	x, y := a.(int64), b.(int64)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+
+	return 0
+}
+
+func TestListRequests(t *testing.T) {
+	// Requests 2 and 6 have no timing, 1, 4 and 7 share the same total
+	totals := []time.Duration{20, 0, 30, 20, 10, 0, 20}
+	reqs := make([]*domain.HTTPRequest, 0, len(totals))
+	for i, total := range totals {
+		req := &domain.HTTPRequest{ID: fmt.Sprintf("%024x", i+1)}
+		if total != 0 {
+			req.Timing = &domain.Timing{Total: total}
+		}
+		reqs = append(reqs, req)
+	}
+
+	tests := []struct {
+		name   string
+		filter domain.RequestsFilter
+		want   [][]int
+	}{
+		{
+			name:   "by time",
+			filter: domain.RequestsFilter{Limit: 3},
+			want:   [][]int{{1, 2, 3}, {4, 5, 6}, {7}},
+		},
+		{
+			name:   "by time descending",
+			filter: domain.RequestsFilter{Limit: 3, SortDesc: true},
+			want:   [][]int{{7, 6, 5}, {4, 3, 2}, {1}},
+		},
+		{
+			name:   "by metric, then requests without timing",
+			filter: domain.RequestsFilter{Limit: 2, SortBy: domain.TimingTotal},
+			want:   [][]int{{5, 1}, {4, 7}, {3, 2}, {6}},
+		},
+		{
+			name:   "descending across equal values",
+			filter: domain.RequestsFilter{Limit: 2, SortBy: domain.TimingTotal, SortDesc: true},
+			want:   [][]int{{3, 7}, {4, 1}, {5, 6}, {2}},
+		},
+		{
+			name:   "page ending with the last timed request",
+			filter: domain.RequestsFilter{Limit: 5, SortBy: domain.TimingTotal},
+			want:   [][]int{{5, 1, 4, 7, 3}, {2, 6}},
+		},
+		{
+			name:   "bounds leave out requests without timing",
+			filter: domain.RequestsFilter{Limit: 3, SortBy: domain.TimingTotal, Min: map[string]int64{domain.TimingTotal: 20}},
+			want:   [][]int{{1, 4, 7}, {3}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			find := memoryFinder(reqs)
+			filter := tt.filter
+
+			var got [][]int
+			for range 10 {
+				page, err := listRequests(context.Background(), &filter, find)
+				if err != nil {
+					t.Fatalf("listRequests() error = %v", err)
+				}
+
+				var ids []int
+				for _, req := range page.Requests {
+					var n int
+					fmt.Sscanf(req.ID, "%x", &n)
+					ids = append(ids, n)
+				}
+				got = append(got, ids)
+
+				if page.NextCursor == "" {
+					break
+				}
+				filter.Cursor = page.NextCursor
+			}
+
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("pages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListRequestsInvalidCursor(t *testing.T) {
+	cursors := []string{
+		"not a cursor!",
+		encodeCursor(&requestsCursor{ID: "not an object id"}),
+	}
+
+	for _, cursor := range cursors {
+		filter := &domain.RequestsFilter{Limit: 1, Cursor: cursor}
+		_, err := listRequests(context.Background(), filter, memoryFinder(nil))
+		if !errors.Is(err, customerrors.ErrInvalidRequest) {
+			t.Errorf("listRequests(%q) error = %v, want %v", cursor, err, customerrors.ErrInvalidRequest)
+		}
+	}
+}
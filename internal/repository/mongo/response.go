@@ -1,33 +1,81 @@
-package mongo_repo
-
-import (
-	"context"
-
-	"github.com/burp_junior/customerrors"
-	"github.com/burp_junior/domain"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-)
-
-type Responses struct {
-	Col *mongo.Collection
-}
-
-func NewResponsesRepo(col *mongo.Collection) (r *Responses) {
-	return &Responses{
-		Col: col,
-	}
-}
-
-func (r *Responses) SaveResponse(ctx context.Context, resp *domain.HTTPResponse) (savedResp *domain.HTTPResponse, err error) {
-	result, err := r.Col.InsertOne(context.Background(), resp)
-	if err != nil {
-		err = customerrors.ErrInternal
-		return
-	}
-
-	resp.ID = result.InsertedID.(primitive.ObjectID).Hex()
-	savedResp = resp
-
-	return
-}
+package mongo_repo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Responses struct {
+	Col *mongo.Collection
+}
+
+func NewResponsesRepo(col *mongo.Collection) (r *Responses) {
+	return &Responses{
+		Col: col,
+	}
+}
+
+func (r *Responses) SaveResponse(ctx context.Context, resp *domain.HTTPResponse) (savedResp *domain.HTTPResponse, err error) {
+	result, err := r.Col.InsertOne(context.Background(), responseDoc(resp))
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	resp.ID = result.InsertedID.(primitive.ObjectID).Hex()
+	savedResp = resp
+
+	return
+}
+
+// GetResponseByRequestID returns the earliest response saved for the request, i.e. the one captured by the proxy
+func (r *Responses) GetResponseByRequestID(ctx context.Context, reqID string) (resp *domain.HTTPResponse, err error) {
+	opts := options.FindOne().SetSort(primitive.D{{Key: "_id", Value: 1}})
+
+	err = r.Col.FindOne(ctx, primitive.M{"request_id": reqID}, opts).Decode(&resp)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = customerrors.ErrNotFound
+		return
+	}
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	fillBody(resp)
+
+	return
+}
+
+// responseDoc returns resp as it is stored: a body that is not decoded is the one as received,
+// so it is kept only in RawBody
+func responseDoc(resp *domain.HTTPResponse) *domain.HTTPResponse {
+	if resp.ContentEncoding != "" {
+		return resp
+	}
+
+	doc := *resp
+	doc.Body = nil
+	return &doc
+}
+
+// fillBody restores the body of a response read from storage that was stored only as received
+func fillBody(resp *domain.HTTPResponse) {
+	if resp.ContentEncoding == "" && resp.Body == nil {
+		resp.Body = resp.RawBody
+	}
+}
+
+// EnsureIndexes creates the index responses are looked up by their request with, if it does not exist yet
+func (r *Responses) EnsureIndexes(ctx context.Context) (err error) {
+	_, err = r.Col.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: primitive.D{{Key: "request_id", Value: 1}, {Key: "_id", Value: 1}},
+	})
+	return
+}
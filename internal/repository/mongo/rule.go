@@ -0,0 +1,121 @@
+package mongo_repo
+
+import (
+	"context"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Rules struct {
+	Col *mongo.Collection
+}
+
+func NewRulesRepo(col *mongo.Collection) (r *Rules) {
+	return &Rules{
+		Col: col,
+	}
+}
+
+func (r *Rules) SaveRule(ctx context.Context, rule *domain.ReplaceRule) (savedRule *domain.ReplaceRule, err error) {
+	result, err := r.Col.InsertOne(ctx, rule)
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	rule.ID = result.InsertedID.(primitive.ObjectID).Hex()
+	savedRule = rule
+
+	return
+}
+
+func (r *Rules) GetRulesList(ctx context.Context) (rules []*domain.ReplaceRule, err error) {
+	rules = make([]*domain.ReplaceRule, 0)
+
+	cursor, err := r.Col.Find(ctx, primitive.M{})
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var rule domain.ReplaceRule
+		err = cursor.Decode(&rule)
+		if err != nil {
+			err = customerrors.ErrInternal
+			return
+		}
+
+		rules = append(rules, &rule)
+	}
+
+	return
+}
+
+func (r *Rules) GetRuleByID(ctx context.Context, id string) (rule *domain.ReplaceRule, err error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		err = customerrors.ErrInvalidRequestID
+		return
+	}
+
+	err = r.Col.FindOne(ctx, primitive.M{"_id": objID}).Decode(&rule)
+	if err != nil {
+		err = customerrors.ErrNotFound
+		return
+	}
+
+	return
+}
+
+func (r *Rules) UpdateRule(ctx context.Context, rule *domain.ReplaceRule) (updatedRule *domain.ReplaceRule, err error) {
+	objID, err := primitive.ObjectIDFromHex(rule.ID)
+	if err != nil {
+		err = customerrors.ErrInvalidRequestID
+		return
+	}
+
+	// _id is immutable and stored as ObjectID, so it is left out of the replacement
+	replacement := *rule
+	replacement.ID = ""
+
+	result, err := r.Col.ReplaceOne(ctx, primitive.M{"_id": objID}, &replacement)
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		err = customerrors.ErrNotFound
+		return
+	}
+
+	updatedRule = rule
+
+	return
+}
+
+func (r *Rules) DeleteRule(ctx context.Context, id string) (err error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		err = customerrors.ErrInvalidRequestID
+		return
+	}
+
+	result, err := r.Col.DeleteOne(ctx, primitive.M{"_id": objID})
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	if result.DeletedCount == 0 {
+		err = customerrors.ErrNotFound
+		return
+	}
+
+	return
+}
@@ -0,0 +1,52 @@
+package mongo_repo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// scopeDocID is the _id of the single document holding the scope
+const scopeDocID = "scope"
+
+type Scopes struct {
+	Col *mongo.Collection
+}
+
+func NewScopesRepo(col *mongo.Collection) (r *Scopes) {
+	return &Scopes{
+		Col: col,
+	}
+}
+
+func (r *Scopes) GetScope(ctx context.Context) (scope *domain.Scope, err error) {
+	scope = &domain.Scope{}
+
+	err = r.Col.FindOne(ctx, primitive.M{"_id": scopeDocID}).Decode(scope)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = nil
+		return
+	}
+
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	return
+}
+
+func (r *Scopes) SaveScope(ctx context.Context, scope *domain.Scope) (err error) {
+	_, err = r.Col.ReplaceOne(ctx, primitive.M{"_id": scopeDocID}, scope, options.Replace().SetUpsert(true))
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	return
+}
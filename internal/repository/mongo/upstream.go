@@ -0,0 +1,52 @@
+package mongo_repo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// upstreamDocID is the _id of the single document holding upstream proxy settings
+const upstreamDocID = "upstream"
+
+type UpstreamProxies struct {
+	Col *mongo.Collection
+}
+
+func NewUpstreamProxiesRepo(col *mongo.Collection) (r *UpstreamProxies) {
+	return &UpstreamProxies{
+		Col: col,
+	}
+}
+
+func (r *UpstreamProxies) GetUpstreamProxySettings(ctx context.Context) (settings *domain.UpstreamProxySettings, err error) {
+	settings = &domain.UpstreamProxySettings{}
+
+	err = r.Col.FindOne(ctx, primitive.M{"_id": upstreamDocID}).Decode(settings)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = nil
+		return
+	}
+
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	return
+}
+
+func (r *UpstreamProxies) SaveUpstreamProxySettings(ctx context.Context, settings *domain.UpstreamProxySettings) (err error) {
+	_, err = r.Col.ReplaceOne(ctx, primitive.M{"_id": upstreamDocID}, settings, options.Replace().SetUpsert(true))
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	return
+}
@@ -0,0 +1,59 @@
+package mongo_repo
+
+import (
+	"context"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WebSocketMessages struct {
+	Col *mongo.Collection
+}
+
+func NewWebSocketMessagesRepo(col *mongo.Collection) (r *WebSocketMessages) {
+	return &WebSocketMessages{
+		Col: col,
+	}
+}
+
+func (r *WebSocketMessages) SaveWebSocketMessage(ctx context.Context, msg *domain.WebSocketMessage) (savedMsg *domain.WebSocketMessage, err error) {
+	result, err := r.Col.InsertOne(ctx, msg)
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	msg.ID = result.InsertedID.(primitive.ObjectID).Hex()
+	savedMsg = msg
+
+	return
+}
+
+func (r *WebSocketMessages) GetWebSocketMessages(ctx context.Context, reqID string) (msgs []*domain.WebSocketMessage, err error) {
+	msgs = make([]*domain.WebSocketMessage, 0)
+
+	opts := options.Find().SetSort(primitive.D{{Key: "timestamp", Value: 1}})
+	cursor, err := r.Col.Find(ctx, primitive.M{"request_id": reqID}, opts)
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var msg domain.WebSocketMessage
+		err = cursor.Decode(&msg)
+		if err != nil {
+			err = customerrors.ErrInternal
+			return
+		}
+
+		msgs = append(msgs, &msg)
+	}
+
+	return
+}
@@ -1,89 +1,263 @@
-package rest_api
-
-import (
-	"context"
-	"log"
-	"net/http"
-
-	"github.com/burp_junior/customerrors"
-	"github.com/burp_junior/domain"
-	"github.com/burp_junior/pkg/jsonutils"
-	"github.com/gorilla/mux"
-)
-
-type APIHandler struct {
-	rs RequestService
-}
-
-type RequestService interface {
-	GetRequestsList(ctx context.Context) (reqs []*domain.HTTPRequest, err error)
-	GetRequestByID(ctx context.Context, reqID string) (req *domain.HTTPRequest, err error)
-	RepeatRequestByID(ctx context.Context, reqID string) (res *domain.HTTPResponse, err error)
-	ScanRequestWithCommandInjection(ctx context.Context, reqID string) (unsafeReq *domain.HTTPRequest, err error)
-}
-
-func NewAPIHandler(rs RequestService) *APIHandler {
-	return &APIHandler{
-		rs: rs,
-	}
-}
-
-func (h *APIHandler) GetRequestsListHandler(w http.ResponseWriter, r *http.Request) {
-	rl, err := h.rs.GetRequestsList(r.Context())
-	if err != nil {
-		log.Println("error getting requests list: ", err)
-		return
-	}
-
-	jsonutils.ServeJSONBody(r.Context(), w, rl, http.StatusOK)
-}
-
-func (h *APIHandler) GetRequestByIDHandler(w http.ResponseWriter, r *http.Request) {
-	reqID, ok := mux.Vars(r)["id"]
-	if !ok {
-		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
-		return
-	}
-
-	req, err := h.rs.GetRequestByID(r.Context(), reqID)
-	if err != nil {
-		jsonutils.ServeJSONError(r.Context(), w, err)
-		return
-	}
-
-	jsonutils.ServeJSONBody(r.Context(), w, req, http.StatusOK)
-}
-
-func (h *APIHandler) RepeatRequestHandler(w http.ResponseWriter, r *http.Request) {
-	reqID, ok := mux.Vars(r)["id"]
-	if !ok {
-		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
-		return
-	}
-
-	res, err := h.rs.RepeatRequestByID(r.Context(), reqID)
-	if err != nil {
-		log.Println(err)
-		jsonutils.ServeJSONError(r.Context(), w, err)
-		return
-	}
-
-	jsonutils.ServeJSONBody(r.Context(), w, res, http.StatusCreated)
-}
-
-func (h *APIHandler) ScanRequestHandler(w http.ResponseWriter, r *http.Request) {
-	reqID, ok := mux.Vars(r)["id"]
-	if !ok {
-		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
-		return
-	}
-
-	unsafeReq, err := h.rs.ScanRequestWithCommandInjection(r.Context(), reqID)
-	if err != nil {
-		log.Println(err)
-		jsonutils.ServeJSONError(r.Context(), w, err)
-		return
-	}
-
-	jsonutils.ServeJSONBody(r.Context(), w, unsafeReq, http.StatusCreated)
-}
+package rest_api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/jsonutils"
+	"github.com/gorilla/mux"
+)
+
+type APIHandler struct {
+	rs RequestService
+}
+
+type RequestService interface {
+	GetRequestsList(ctx context.Context, filter *domain.RequestsFilter) (page *domain.RequestsPage, err error)
+	GetRequestWithResponse(ctx context.Context, reqID string) (req *domain.HTTPRequest, err error)
+	RepeatRequestByID(ctx context.Context, reqID string) (res *domain.HTTPResponse, err error)
+	ScanRequestWithCommandInjection(ctx context.Context, reqID string) (unsafeReq *domain.HTTPRequest, err error)
+}
+
+func NewAPIHandler(rs RequestService) *APIHandler {
+	return &APIHandler{
+		rs: rs,
+	}
+}
+
+// Page sizes of the requests list
+const (
+	defaultRequestsLimit = 100
+	maxRequestsLimit     = 1000
+)
+
+func (h *APIHandler) GetRequestsListHandler(w http.ResponseWriter, r *http.Request) {
+	filter := &domain.RequestsFilter{}
+
+	err := parseRequestsFilter(r.URL.Query(), filter)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	err = parseTimingFilter(r.URL.Query(), filter)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	page, err := h.rs.GetRequestsList(r.Context(), filter)
+	if err != nil {
+		log.Println("error getting requests list: ", err)
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, page, http.StatusOK)
+}
+
+// parseRequestsFilter reads the filters of the requests list: host, method, path (substring),
+// status, content_type (substring), from and to (RFC 3339), has_params, in_scope, tester, project,
+// and the page: limit and cursor, the next_cursor of the previous page
+func parseRequestsFilter(query url.Values, filter *domain.RequestsFilter) (err error) {
+	filter.Host = query.Get("host")
+	filter.Method = strings.ToUpper(query.Get("method"))
+	filter.Path = query.Get("path")
+	filter.ContentType = query.Get("content_type")
+	filter.Tester = query.Get("tester")
+	filter.Project = query.Get("project")
+	filter.Cursor = query.Get("cursor")
+
+	if status := query.Get("status"); status != "" {
+		filter.Status, err = strconv.Atoi(status)
+		if err != nil {
+			return customerrors.ErrInvalidRequest
+		}
+	}
+
+	for key, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(key); value != "" {
+			*t, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				return customerrors.ErrInvalidRequest
+			}
+		}
+	}
+
+	if hasParams := query.Get("has_params"); hasParams != "" {
+		var value bool
+		value, err = strconv.ParseBool(hasParams)
+		if err != nil {
+			return customerrors.ErrInvalidRequest
+		}
+		filter.HasParams = &value
+	}
+
+	if inScope := query.Get("in_scope"); inScope != "" {
+		filter.InScope, err = strconv.ParseBool(inScope)
+		if err != nil {
+			return customerrors.ErrInvalidRequest
+		}
+	}
+
+	filter.Limit = defaultRequestsLimit
+	if limit := query.Get("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxRequestsLimit {
+			return customerrors.ErrInvalidRequest
+		}
+	}
+
+	return
+}
+
+// parseTimingFilter reads sort=<time|metric> (sort=-<time|metric> for descending order) and
+// min_<metric>, max_<metric> bounds. Durations are given as "250ms", sizes in bytes.
+func parseTimingFilter(query url.Values, filter *domain.RequestsFilter) (err error) {
+	if sortBy := query.Get("sort"); sortBy != "" {
+		filter.SortBy, filter.SortDesc = strings.CutPrefix(sortBy, "-")
+		if filter.SortBy != domain.RequestsSortTime && !domain.IsTimingField(filter.SortBy) {
+			return customerrors.ErrInvalidRequest
+		}
+	}
+
+	filter.Min = make(map[string]int64)
+	filter.Max = make(map[string]int64)
+
+	for key := range query {
+		bounds := filter.Min
+		field, ok := strings.CutPrefix(key, "min_")
+		if !ok {
+			bounds = filter.Max
+			field, ok = strings.CutPrefix(key, "max_")
+		}
+		if !ok {
+			continue
+		}
+
+		if !domain.IsTimingField(field) {
+			return customerrors.ErrInvalidRequest
+		}
+
+		bounds[field], err = parseTimingValue(field, query.Get(key))
+		if err != nil {
+			return customerrors.ErrInvalidRequest
+		}
+	}
+
+	return
+}
+
+func parseTimingValue(field, value string) (int64, error) {
+	if domain.IsTimingDuration(field) {
+		d, err := time.ParseDuration(value)
+		return int64(d), err
+	}
+
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// Forms of the response body selected by the body parameter, both are returned without it
+const (
+	bodyFormDecoded = "decoded"
+	bodyFormRaw     = "raw"
+)
+
+// parseBodyForm reads body=decoded|raw, the form of the response body to return
+func parseBodyForm(query url.Values) (form string, err error) {
+	form = query.Get("body")
+	if form != "" && form != bodyFormDecoded && form != bodyFormRaw {
+		return "", customerrors.ErrInvalidRequest
+	}
+
+	return
+}
+
+// selectBodyForm leaves only the body of resp in form: Body for decoded, RawBody for raw
+func selectBodyForm(resp *domain.HTTPResponse, form string) {
+	if resp == nil {
+		return
+	}
+
+	switch form {
+	case bodyFormDecoded:
+		resp.RawBody = nil
+	case bodyFormRaw:
+		resp.Body = nil
+	}
+}
+
+// GetRequestByIDHandler reads body, see parseBodyForm
+func (h *APIHandler) GetRequestByIDHandler(w http.ResponseWriter, r *http.Request) {
+	reqID, ok := mux.Vars(r)["id"]
+	if !ok {
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
+		return
+	}
+
+	form, err := parseBodyForm(r.URL.Query())
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	req, err := h.rs.GetRequestWithResponse(r.Context(), reqID)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	selectBodyForm(req.Response, form)
+
+	jsonutils.ServeJSONBody(r.Context(), w, req, http.StatusOK)
+}
+
+// RepeatRequestHandler reads body, see parseBodyForm
+func (h *APIHandler) RepeatRequestHandler(w http.ResponseWriter, r *http.Request) {
+	reqID, ok := mux.Vars(r)["id"]
+	if !ok {
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
+		return
+	}
+
+	form, err := parseBodyForm(r.URL.Query())
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	res, err := h.rs.RepeatRequestByID(r.Context(), reqID)
+	if err != nil {
+		log.Println(err)
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	selectBodyForm(res, form)
+
+	jsonutils.ServeJSONBody(r.Context(), w, res, http.StatusCreated)
+}
+
+func (h *APIHandler) ScanRequestHandler(w http.ResponseWriter, r *http.Request) {
+	reqID, ok := mux.Vars(r)["id"]
+	if !ok {
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
+		return
+	}
+
+	unsafeReq, err := h.rs.ScanRequestWithCommandInjection(r.Context(), reqID)
+	if err != nil {
+		log.Println(err)
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, unsafeReq, http.StatusCreated)
+}
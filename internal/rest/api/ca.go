@@ -0,0 +1,59 @@
+package rest_api
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/jsonutils"
+)
+
+type CAHandler struct {
+	cas CAService
+}
+
+type CAService interface {
+	ExportCA(ctx context.Context, format string, password string) (export *domain.CAExport, err error)
+	RotateCA(ctx context.Context) (err error)
+}
+
+func NewCAHandler(cas CAService) *CAHandler {
+	return &CAHandler{
+		cas: cas,
+	}
+}
+
+// GetCAHandler downloads the CA certificate, ?format= is pem (default), der or p12 (with ?password=)
+func (h *CAHandler) GetCAHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = domain.CAFormatPEM
+	}
+
+	export, err := h.cas.ExportCA(r.Context(), format, r.URL.Query().Get("password"))
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", export.ContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+export.FileName+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(export.Data)
+	if err != nil {
+		log.Println("error writing ca: ", err)
+		return
+	}
+}
+
+func (h *CAHandler) RotateCAHandler(w http.ResponseWriter, r *http.Request) {
+	err := h.cas.RotateCA(r.Context())
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,70 @@
+package rest_api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/jsonutils"
+	"github.com/gorilla/mux"
+)
+
+type ClientCertHandler struct {
+	ccs ClientCertService
+}
+
+type ClientCertService interface {
+	GetClientCertificatesList(ctx context.Context) (certs []*domain.ClientCertificate, err error)
+	CreateClientCertificate(ctx context.Context, upload *domain.ClientCertificateUpload) (savedCert *domain.ClientCertificate, err error)
+	DeleteClientCertificate(ctx context.Context, id string) (err error)
+}
+
+func NewClientCertHandler(ccs ClientCertService) *ClientCertHandler {
+	return &ClientCertHandler{
+		ccs: ccs,
+	}
+}
+
+func (h *ClientCertHandler) GetClientCertificatesListHandler(w http.ResponseWriter, r *http.Request) {
+	certs, err := h.ccs.GetClientCertificatesList(r.Context())
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, certs, http.StatusOK)
+}
+
+func (h *ClientCertHandler) CreateClientCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	upload := &domain.ClientCertificateUpload{}
+	err := jsonutils.ReadJSONBody(r, upload)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	cert, err := h.ccs.CreateClientCertificate(r.Context(), upload)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, cert, http.StatusCreated)
+}
+
+func (h *ClientCertHandler) DeleteClientCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	certID, ok := mux.Vars(r)["id"]
+	if !ok {
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
+		return
+	}
+
+	err := h.ccs.DeleteClientCertificate(r.Context(), certID)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,48 @@
+package rest_api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/burp_junior/pkg/jsonutils"
+)
+
+// healthStatus is the body of successful health checks
+type healthStatus struct {
+	Status string `json:"status"`
+}
+
+type HealthHandler struct {
+	hs HealthService
+}
+
+type HealthService interface {
+	Live(ctx context.Context) (err error)
+	Ready(ctx context.Context) (err error)
+}
+
+func NewHealthHandler(hs HealthService) *HealthHandler {
+	return &HealthHandler{
+		hs: hs,
+	}
+}
+
+func (h *HealthHandler) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	err := h.hs.Live(r.Context())
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, &healthStatus{Status: "ok"}, http.StatusOK)
+}
+
+func (h *HealthHandler) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	err := h.hs.Ready(r.Context())
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, &healthStatus{Status: "ready"}, http.StatusOK)
+}
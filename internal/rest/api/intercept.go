@@ -0,0 +1,126 @@
+package rest_api
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/jsonutils"
+	"github.com/gorilla/mux"
+)
+
+type InterceptHandler struct {
+	is InterceptService
+}
+
+type InterceptService interface {
+	GetInterceptSettings(ctx context.Context) (settings *domain.InterceptSettings, err error)
+	SetInterceptSettings(ctx context.Context, settings *domain.InterceptSettings) (err error)
+	GetInterceptedList(ctx context.Context) (msgs []*domain.InterceptedMessage, err error)
+	GetInterceptedByID(ctx context.Context, id string) (msg *domain.InterceptedMessage, err error)
+	ForwardIntercepted(ctx context.Context, id string, edited *domain.InterceptedMessage) (err error)
+	DropIntercepted(ctx context.Context, id string) (err error)
+}
+
+func NewInterceptHandler(is InterceptService) *InterceptHandler {
+	return &InterceptHandler{
+		is: is,
+	}
+}
+
+func (h *InterceptHandler) GetInterceptSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.is.GetInterceptSettings(r.Context())
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, settings, http.StatusOK)
+}
+
+func (h *InterceptHandler) SetInterceptSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings := &domain.InterceptSettings{}
+	err := jsonutils.ReadJSONBody(r, settings)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	err = h.is.SetInterceptSettings(r.Context(), settings)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, settings, http.StatusOK)
+}
+
+func (h *InterceptHandler) GetInterceptedListHandler(w http.ResponseWriter, r *http.Request) {
+	msgs, err := h.is.GetInterceptedList(r.Context())
+	if err != nil {
+		log.Println("error getting intercepted list: ", err)
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, msgs, http.StatusOK)
+}
+
+func (h *InterceptHandler) GetInterceptedByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
+		return
+	}
+
+	msg, err := h.is.GetInterceptedByID(r.Context(), id)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, msg, http.StatusOK)
+}
+
+// ForwardInterceptedHandler releases a held message. Optional body of type
+// domain.InterceptedMessage carries the edited Request or Response.
+func (h *InterceptHandler) ForwardInterceptedHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
+		return
+	}
+
+	edited := &domain.InterceptedMessage{}
+	err := jsonutils.ReadJSONBody(r, edited)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	err = h.is.ForwardIntercepted(r.Context(), id, edited)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *InterceptHandler) DropInterceptedHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
+		return
+	}
+
+	err := h.is.DropIntercepted(r.Context(), id)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
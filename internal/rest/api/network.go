@@ -0,0 +1,51 @@
+package rest_api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/jsonutils"
+)
+
+type NetworkHandler struct {
+	ns NetworkService
+}
+
+type NetworkService interface {
+	GetNetworkProfileSettings(ctx context.Context) (settings *domain.NetworkProfileSettings, err error)
+	SetNetworkProfileSettings(ctx context.Context, settings *domain.NetworkProfileSettings) (err error)
+}
+
+func NewNetworkHandler(ns NetworkService) *NetworkHandler {
+	return &NetworkHandler{
+		ns: ns,
+	}
+}
+
+func (h *NetworkHandler) GetNetworkProfileSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.ns.GetNetworkProfileSettings(r.Context())
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, settings, http.StatusOK)
+}
+
+func (h *NetworkHandler) SetNetworkProfileSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings := &domain.NetworkProfileSettings{}
+	err := jsonutils.ReadJSONBody(r, settings)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	err = h.ns.SetNetworkProfileSettings(r.Context(), settings)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, settings, http.StatusOK)
+}
@@ -0,0 +1,62 @@
+package rest_api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/jsonutils"
+)
+
+type PassthroughHandler struct {
+	ps PassthroughService
+}
+
+type PassthroughService interface {
+	GetPassthroughSettings(ctx context.Context) (settings *domain.PassthroughSettings, err error)
+	SetPassthroughSettings(ctx context.Context, settings *domain.PassthroughSettings) (err error)
+	GetPassthroughTunnelsList(ctx context.Context) (tunnels []*domain.PassthroughTunnel, err error)
+}
+
+func NewPassthroughHandler(ps PassthroughService) *PassthroughHandler {
+	return &PassthroughHandler{
+		ps: ps,
+	}
+}
+
+func (h *PassthroughHandler) GetPassthroughSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.ps.GetPassthroughSettings(r.Context())
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, settings, http.StatusOK)
+}
+
+func (h *PassthroughHandler) SetPassthroughSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings := &domain.PassthroughSettings{}
+	err := jsonutils.ReadJSONBody(r, settings)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	err = h.ps.SetPassthroughSettings(r.Context(), settings)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, settings, http.StatusOK)
+}
+
+func (h *PassthroughHandler) GetPassthroughTunnelsListHandler(w http.ResponseWriter, r *http.Request) {
+	tunnels, err := h.ps.GetPassthroughTunnelsList(r.Context())
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, tunnels, http.StatusOK)
+}
@@ -0,0 +1,70 @@
+package rest_api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/jsonutils"
+	"github.com/gorilla/mux"
+)
+
+type ProxyUserHandler struct {
+	pus ProxyUserService
+}
+
+type ProxyUserService interface {
+	GetProxyUsersList(ctx context.Context) (users []*domain.ProxyUser, err error)
+	CreateProxyUser(ctx context.Context, upload *domain.ProxyUserUpload) (savedUser *domain.ProxyUser, err error)
+	DeleteProxyUser(ctx context.Context, id string) (err error)
+}
+
+func NewProxyUserHandler(pus ProxyUserService) *ProxyUserHandler {
+	return &ProxyUserHandler{
+		pus: pus,
+	}
+}
+
+func (h *ProxyUserHandler) GetProxyUsersListHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := h.pus.GetProxyUsersList(r.Context())
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, users, http.StatusOK)
+}
+
+func (h *ProxyUserHandler) CreateProxyUserHandler(w http.ResponseWriter, r *http.Request) {
+	upload := &domain.ProxyUserUpload{}
+	err := jsonutils.ReadJSONBody(r, upload)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	user, err := h.pus.CreateProxyUser(r.Context(), upload)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, user, http.StatusCreated)
+}
+
+func (h *ProxyUserHandler) DeleteProxyUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := mux.Vars(r)["id"]
+	if !ok {
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
+		return
+	}
+
+	err := h.pus.DeleteProxyUser(r.Context(), userID)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,115 @@
+package rest_api
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/jsonutils"
+	"github.com/gorilla/mux"
+)
+
+type RulesHandler struct {
+	rls RulesService
+}
+
+type RulesService interface {
+	GetRulesList(ctx context.Context) (rules []*domain.ReplaceRule, err error)
+	GetRuleByID(ctx context.Context, id string) (rule *domain.ReplaceRule, err error)
+	CreateRule(ctx context.Context, rule *domain.ReplaceRule) (savedRule *domain.ReplaceRule, err error)
+	UpdateRule(ctx context.Context, rule *domain.ReplaceRule) (updatedRule *domain.ReplaceRule, err error)
+	DeleteRule(ctx context.Context, id string) (err error)
+}
+
+func NewRulesHandler(rls RulesService) *RulesHandler {
+	return &RulesHandler{
+		rls: rls,
+	}
+}
+
+func (h *RulesHandler) GetRulesListHandler(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.rls.GetRulesList(r.Context())
+	if err != nil {
+		log.Println("error getting rules list: ", err)
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, rules, http.StatusOK)
+}
+
+func (h *RulesHandler) GetRuleByIDHandler(w http.ResponseWriter, r *http.Request) {
+	ruleID, ok := mux.Vars(r)["id"]
+	if !ok {
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
+		return
+	}
+
+	rule, err := h.rls.GetRuleByID(r.Context(), ruleID)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, rule, http.StatusOK)
+}
+
+func (h *RulesHandler) CreateRuleHandler(w http.ResponseWriter, r *http.Request) {
+	rule := &domain.ReplaceRule{}
+	err := jsonutils.ReadJSONBody(r, rule)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	rule, err = h.rls.CreateRule(r.Context(), rule)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, rule, http.StatusCreated)
+}
+
+func (h *RulesHandler) UpdateRuleHandler(w http.ResponseWriter, r *http.Request) {
+	ruleID, ok := mux.Vars(r)["id"]
+	if !ok {
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
+		return
+	}
+
+	rule := &domain.ReplaceRule{}
+	err := jsonutils.ReadJSONBody(r, rule)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	rule.ID = ruleID
+
+	rule, err = h.rls.UpdateRule(r.Context(), rule)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, rule, http.StatusOK)
+}
+
+func (h *RulesHandler) DeleteRuleHandler(w http.ResponseWriter, r *http.Request) {
+	ruleID, ok := mux.Vars(r)["id"]
+	if !ok {
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
+		return
+	}
+
+	err := h.rls.DeleteRule(r.Context(), ruleID)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,51 @@
+package rest_api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/jsonutils"
+)
+
+type ScopeHandler struct {
+	ss ScopeService
+}
+
+type ScopeService interface {
+	GetScope(ctx context.Context) (scope *domain.Scope, err error)
+	SetScope(ctx context.Context, scope *domain.Scope) (err error)
+}
+
+func NewScopeHandler(ss ScopeService) *ScopeHandler {
+	return &ScopeHandler{
+		ss: ss,
+	}
+}
+
+func (h *ScopeHandler) GetScopeHandler(w http.ResponseWriter, r *http.Request) {
+	scope, err := h.ss.GetScope(r.Context())
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, scope, http.StatusOK)
+}
+
+func (h *ScopeHandler) SetScopeHandler(w http.ResponseWriter, r *http.Request) {
+	scope := &domain.Scope{}
+	err := jsonutils.ReadJSONBody(r, scope)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	err = h.ss.SetScope(r.Context(), scope)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, scope, http.StatusOK)
+}
@@ -0,0 +1,76 @@
+package rest_api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/jsonutils"
+)
+
+type SearchHandler struct {
+	ss SearchService
+}
+
+type SearchService interface {
+	Search(ctx context.Context, query *domain.SearchQuery) (page *domain.SearchPage, err error)
+}
+
+func NewSearchHandler(ss SearchService) *SearchHandler {
+	return &SearchHandler{
+		ss: ss,
+	}
+}
+
+// SearchExchangesHandler reads q, regex, case_sensitive and fields (comma separated) along with the
+// filters and paging of the requests list and its min_ and max_ timing bounds, see parseRequestsFilter
+// and parseTimingFilter. Sorting is not accepted.
+func (h *SearchHandler) SearchExchangesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := &domain.RequestsFilter{}
+
+	err := parseRequestsFilter(query, filter)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	// Results are always from the newest to the oldest exchange
+	err = parseTimingFilter(query, filter)
+	if err != nil || filter.SortBy != "" {
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
+		return
+	}
+
+	search := &domain.SearchQuery{
+		Text:   query.Get("q"),
+		Filter: filter,
+		Limit:  filter.Limit,
+		Cursor: filter.Cursor,
+	}
+
+	for key, flag := range map[string]*bool{"regex": &search.Regex, "case_sensitive": &search.CaseSensitive} {
+		if value := query.Get(key); value != "" {
+			*flag, err = strconv.ParseBool(value)
+			if err != nil {
+				jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
+				return
+			}
+		}
+	}
+
+	if fields := query.Get("fields"); fields != "" {
+		search.Fields = strings.Split(fields, ",")
+	}
+
+	page, err := h.ss.Search(r.Context(), search)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, page, http.StatusOK)
+}
@@ -0,0 +1,51 @@
+package rest_api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/jsonutils"
+)
+
+type UpstreamHandler struct {
+	us UpstreamService
+}
+
+type UpstreamService interface {
+	GetUpstreamProxySettings(ctx context.Context) (settings *domain.UpstreamProxySettings, err error)
+	SetUpstreamProxySettings(ctx context.Context, settings *domain.UpstreamProxySettings) (err error)
+}
+
+func NewUpstreamHandler(us UpstreamService) *UpstreamHandler {
+	return &UpstreamHandler{
+		us: us,
+	}
+}
+
+func (h *UpstreamHandler) GetUpstreamProxySettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.us.GetUpstreamProxySettings(r.Context())
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, settings, http.StatusOK)
+}
+
+func (h *UpstreamHandler) SetUpstreamProxySettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings := &domain.UpstreamProxySettings{}
+	err := jsonutils.ReadJSONBody(r, settings)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	err = h.us.SetUpstreamProxySettings(r.Context(), settings)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, settings, http.StatusOK)
+}
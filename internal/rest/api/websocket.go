@@ -0,0 +1,69 @@
+package rest_api
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/jsonutils"
+	"github.com/gorilla/mux"
+)
+
+type WebSocketHandler struct {
+	wss WebSocketService
+}
+
+type WebSocketService interface {
+	GetWebSocketMessages(ctx context.Context, reqID string) (msgs []*domain.WebSocketMessage, err error)
+	ResendWebSocketMessage(ctx context.Context, reqID string, msg *domain.WebSocketMessage) (msgs []*domain.WebSocketMessage, err error)
+}
+
+func NewWebSocketHandler(wss WebSocketService) *WebSocketHandler {
+	return &WebSocketHandler{
+		wss: wss,
+	}
+}
+
+func (h *WebSocketHandler) GetWebSocketMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	reqID, ok := mux.Vars(r)["id"]
+	if !ok {
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
+		return
+	}
+
+	msgs, err := h.wss.GetWebSocketMessages(r.Context(), reqID)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, msgs, http.StatusOK)
+}
+
+// ResendWebSocketMessageHandler expects domain.WebSocketMessage with Opcode and Payload
+// and returns the sent message followed by the server replies.
+func (h *WebSocketHandler) ResendWebSocketMessageHandler(w http.ResponseWriter, r *http.Request) {
+	reqID, ok := mux.Vars(r)["id"]
+	if !ok {
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrInvalidRequest)
+		return
+	}
+
+	msg := &domain.WebSocketMessage{}
+	err := jsonutils.ReadJSONBody(r, msg)
+	if err != nil {
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	msgs, err := h.wss.ResendWebSocketMessage(r.Context(), reqID, msg)
+	if err != nil {
+		log.Println(err)
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	jsonutils.ServeJSONBody(r.Context(), w, msgs, http.StatusCreated)
+}
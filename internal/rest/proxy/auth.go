@@ -0,0 +1,60 @@
+package rest_proxy
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/burp_junior/domain"
+)
+
+const proxyAuthRealm = "burp_junior"
+
+type ProxyUserService interface {
+	AuthRequired(ctx context.Context) bool
+	Authenticate(ctx context.Context, username string, password string) *domain.ProxyUser
+}
+
+// transparentConnKey holds whether the transparent listener a connection came from is open
+type transparentConnKey struct{}
+
+// authenticate checks the Proxy-Authorization credentials of r and answers 407 if they are
+// missing or wrong. user is nil if authentication is not required. Clients of the transparent
+// proxy do not know they use a proxy and cannot send credentials, so once proxy users exist
+// they are refused unless the transparent listener is open.
+func (h *ProxyHandler) authenticate(w http.ResponseWriter, r *http.Request) (user *domain.ProxyUser, ok bool) {
+	if !h.proxyUserService.AuthRequired(r.Context()) {
+		return nil, true
+	}
+
+	if open, transparent := r.Context().Value(transparentConnKey{}).(bool); transparent {
+		if !open {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		}
+		return nil, open
+	}
+
+	username, password, hasAuth := parseProxyAuthorization(r)
+	if hasAuth {
+		user = h.proxyUserService.Authenticate(r.Context(), username, password)
+	}
+
+	if user == nil {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="`+proxyAuthRealm+`"`)
+		http.Error(w, http.StatusText(http.StatusProxyAuthRequired), http.StatusProxyAuthRequired)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// parseProxyAuthorization reads Basic credentials from Proxy-Authorization the way
+// http.Request.BasicAuth reads them from Authorization
+func parseProxyAuthorization(r *http.Request) (username string, password string, ok bool) {
+	auth := r.Header.Get("Proxy-Authorization")
+	if auth == "" {
+		return
+	}
+
+	req := &http.Request{Header: http.Header{"Authorization": {auth}}}
+	return req.BasicAuth()
+}
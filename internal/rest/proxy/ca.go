@@ -0,0 +1,52 @@
+package rest_proxy
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/jsonutils"
+)
+
+// caHost is the magic hostname the proxy answers itself, serving its CA certificate
+// for installation on devices: http://burp.junior/cert
+const caHost = "burp.junior"
+
+// caPaths maps paths on caHost to export formats. /cert is DER, which mobile browsers offer to install.
+var caPaths = map[string]string{
+	"/cert":     domain.CAFormatDER,
+	"/cert/der": domain.CAFormatDER,
+	"/cert/pem": domain.CAFormatPEM,
+	"/cert/p12": domain.CAFormatPKCS12,
+}
+
+func isCAHost(pr *domain.HTTPRequest) bool {
+	return strings.EqualFold(pr.Host, caHost)
+}
+
+// serveCAHost serves requests to caHost without sending them anywhere or recording them
+func (h *ProxyHandler) serveCAHost(w http.ResponseWriter, r *http.Request) {
+	format, ok := caPaths[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	export, err := h.caService.ExportCA(r.Context(), format, r.URL.Query().Get("password"))
+	if err != nil {
+		log.Println(err)
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", export.ContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+export.FileName+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(export.Data)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+}
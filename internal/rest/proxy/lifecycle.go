@@ -0,0 +1,145 @@
+package rest_proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// tunnel is a client connection served by the proxy itself instead of http.Server:
+// CONNECT and WebSocket connections once hijacked, SOCKS5 clients and transparent TLS.
+// http.Server.Shutdown does not wait for those, so the proxy drains them on its own.
+type tunnel struct {
+	conn net.Conn
+	idle bool
+}
+
+type tunnelKey struct{}
+
+// tunnels holds the tunnels being served and whether the proxy is shutting down
+type tunnels struct {
+	mu           *sync.Mutex
+	wg           *sync.WaitGroup
+	active       map[*tunnel]struct{}
+	shuttingDown bool
+}
+
+func newTunnels() *tunnels {
+	return &tunnels{
+		mu:     &sync.Mutex{},
+		wg:     &sync.WaitGroup{},
+		active: make(map[*tunnel]struct{}),
+	}
+}
+
+// trackTunnel registers conn to be drained on shutdown and returns ctx carrying it.
+// done must be called once conn is served. ok is false if the proxy is shutting down,
+// then conn must not be served.
+func (h *ProxyHandler) trackTunnel(ctx context.Context, conn net.Conn) (tunnelCtx context.Context, done func(), ok bool) {
+	h.tunnels.mu.Lock()
+	defer h.tunnels.mu.Unlock()
+
+	if h.tunnels.shuttingDown {
+		return
+	}
+
+	t := &tunnel{conn: conn}
+	h.tunnels.active[t] = struct{}{}
+	h.tunnels.wg.Add(1)
+
+	done = func() {
+		h.tunnels.mu.Lock()
+		delete(h.tunnels.active, t)
+		h.tunnels.mu.Unlock()
+
+		h.tunnels.wg.Done()
+	}
+
+	return context.WithValue(ctx, tunnelKey{}, t), done, true
+}
+
+// setTunnelIdle marks the tunnel of ctx as waiting for the next request, which lets
+// shutdown close it right away. ok is false if the tunnel must not wait, because
+// the proxy is shutting down.
+func (h *ProxyHandler) setTunnelIdle(ctx context.Context, idle bool) (ok bool) {
+	t, tracked := ctx.Value(tunnelKey{}).(*tunnel)
+	if !tracked {
+		return true
+	}
+
+	h.tunnels.mu.Lock()
+	defer h.tunnels.mu.Unlock()
+
+	if idle && h.tunnels.shuttingDown {
+		return false
+	}
+
+	t.idle = idle
+
+	return true
+}
+
+// closeTunnels closes the tunnels being served, only the idle ones unless all is set
+func (h *ProxyHandler) closeTunnels(all bool) {
+	h.tunnels.mu.Lock()
+	defer h.tunnels.mu.Unlock()
+
+	for t := range h.tunnels.active {
+		if all || t.idle {
+			t.conn.Close()
+		}
+	}
+}
+
+// Serve serves proxy clients from l with server, keeping the heads of their requests as received.
+// The handler of server is set to h.
+func (h *ProxyHandler) Serve(server *http.Server, l net.Listener) error {
+	tl, transparent := l.(*transparentListener)
+
+	server.Handler = h
+	server.BaseContext = func(net.Listener) context.Context {
+		return h.ctx
+	}
+	server.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if transparent {
+			ctx = context.WithValue(ctx, transparentConnKey{}, tl.open)
+		}
+
+		if rc, ok := c.(*recordingConn); ok {
+			return context.WithValue(ctx, recordingConnKey{}, rc)
+		}
+
+		return ctx
+	}
+
+	return server.Serve(&recordingListener{Listener: l})
+}
+
+// Shutdown stops taking new tunnels, closes idle ones and waits for the rest to finish
+// their exchanges. Once ctx is done the remaining tunnels are closed and requests still
+// in progress, e.g. held by intercept, are cancelled.
+func (h *ProxyHandler) Shutdown(ctx context.Context) (err error) {
+	h.tunnels.mu.Lock()
+	h.tunnels.shuttingDown = true
+	h.tunnels.mu.Unlock()
+
+	h.closeTunnels(false)
+
+	drained := make(chan struct{})
+	go func() {
+		h.tunnels.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return
+	case <-ctx.Done():
+	}
+
+	h.cancel()
+	h.closeTunnels(true)
+
+	return ctx.Err()
+}
@@ -0,0 +1,155 @@
+package rest_proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/netsim"
+)
+
+// defaultFaultCode is answered for simulated errors of profiles without an ErrorCode
+const defaultFaultCode = http.StatusServiceUnavailable
+
+// faultResponse is the synthetic response answered for a simulated backend error
+func faultResponse(profile *domain.NetworkProfile) *domain.HTTPResponse {
+	code := profile.ErrorCode
+	if code == 0 {
+		code = defaultFaultCode
+	}
+
+	return &domain.HTTPResponse{
+		Proto:   "HTTP/1.1",
+		Code:    code,
+		Message: fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		Headers: map[string][]string{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:    []byte("simulated by network profile\n"),
+	}
+}
+
+// simulateHTTPFault fails a plain proxy request or an HTTP/2 stream with fault
+// instead of forwarding it. It reports whether the fault was simulated.
+func (h *ProxyHandler) simulateHTTPFault(w http.ResponseWriter, profile *domain.NetworkProfile, fault domain.NetworkFault) bool {
+	switch fault {
+	case domain.NetworkFaultDrop, domain.NetworkFaultReset:
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			// HTTP/2 streams are reset on their own, the connection carries other streams
+			panic(http.ErrAbortHandler)
+		}
+
+		conn, _, err := hijacker.Hijack()
+		if err != nil {
+			log.Println("simulating fault: ", err)
+			return true
+		}
+
+		closeConn(conn, fault)
+	case domain.NetworkFaultError:
+		err := h.ServeHTTPResponse(w, faultResponse(profile))
+		if err != nil {
+			log.Println("simulating fault: ", err)
+		}
+	default:
+		return false
+	}
+
+	return true
+}
+
+// simulateTunnelFault fails a request read from a tunnel with fault instead of forwarding it.
+// It reports whether the fault was simulated and whether the tunnel can still be used.
+func simulateTunnelFault(cconn net.Conn, req *http.Request, profile *domain.NetworkProfile, fault domain.NetworkFault) (simulated bool, keepAlive bool, err error) {
+	switch fault {
+	case domain.NetworkFaultDrop, domain.NetworkFaultReset:
+		closeConn(cconn, fault)
+	case domain.NetworkFaultError:
+		err = buildHTTPResponse(faultResponse(profile), req).Write(cconn)
+		keepAlive = !req.Close
+	default:
+		return
+	}
+
+	simulated = true
+
+	return
+}
+
+// closeConn closes conn, with a TCP reset instead of a regular close for NetworkFaultReset.
+// The reset is sent on the TCP connection itself, so TLS does not close it gracefully first.
+func closeConn(conn net.Conn, fault domain.NetworkFault) {
+	if tcpConn, ok := tcpConnOf(conn); ok && fault == domain.NetworkFaultReset {
+		tcpConn.SetLinger(0)
+		tcpConn.Close()
+	}
+
+	conn.Close()
+}
+
+func tcpConnOf(conn net.Conn) (tcpConn *net.TCPConn, ok bool) {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c, true
+		case *tls.Conn:
+			conn = c.NetConn()
+		case *bufferedConn:
+			conn = c.Conn
+		case *recordingConn:
+			conn = c.Conn
+		default:
+			return
+		}
+	}
+}
+
+// throttle paces writes to w to the bandwidth of profile
+func throttle(w io.Writer, profile *domain.NetworkProfile) io.Writer {
+	if profile == nil {
+		return w
+	}
+
+	return netsim.NewWriter(w, profile.Bandwidth)
+}
+
+// throttledResponseWriter paces the body written to a client to the bandwidth of a profile
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	w io.Writer
+}
+
+func (w *throttledResponseWriter) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
+func throttleResponse(w http.ResponseWriter, profile *domain.NetworkProfile) http.ResponseWriter {
+	if profile == nil || profile.Bandwidth <= 0 {
+		return w
+	}
+
+	return &throttledResponseWriter{ResponseWriter: w, w: netsim.NewWriter(w, profile.Bandwidth)}
+}
+
+// simulate applies both the bandwidth and the latency of profile to a stream written to w.
+// It must be closed to wait for the delayed bytes.
+func simulate(w io.Writer, profile *domain.NetworkProfile) io.WriteCloser {
+	if profile == nil {
+		return netsim.NewDelayWriter(w, 0)
+	}
+
+	return netsim.NewDelayWriter(netsim.NewWriter(w, profile.Bandwidth), profile.Latency)
+}
+
+// delay waits for the latency of profile
+func delay(ctx context.Context, profile *domain.NetworkProfile) error {
+	if profile == nil {
+		return nil
+	}
+
+	return netsim.Sleep(ctx, profile.Latency)
+}
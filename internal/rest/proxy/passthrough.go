@@ -0,0 +1,107 @@
+package rest_proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/burp_junior/domain"
+)
+
+// servePassthrough relays a TLS tunnel as raw bytes without terminating it,
+// so clients pinning certificates keep working. Only tunnel metadata is saved.
+func (h *ProxyHandler) servePassthrough(ctx context.Context, pr *domain.HTTPRequest, raw net.Conn) (err error) {
+	cconn := &bufferedConn{Conn: raw, r: bufio.NewReader(raw)}
+
+	tunnel := &domain.PassthroughTunnel{
+		Host:      pr.Host,
+		Port:      pr.Port,
+		StartedAt: time.Now(),
+	}
+
+	// A tunnel that does not start with a ClientHello is relayed all the same
+	tunnel.SNI, err = sniffSNI(cconn)
+	if err != nil {
+		log.Println("passthrough sni err:", err)
+	}
+
+	profile, fault := h.networkService.GetNetworkConditions(ctx, pr.Host)
+	if fault == domain.NetworkFaultDrop || fault == domain.NetworkFaultReset {
+		closeConn(cconn, fault)
+		return
+	}
+
+	sconn, err := h.requestService.DialUpstreamTCP(ctx, pr)
+	if err != nil {
+		return
+	}
+	defer sconn.Close()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		tunnel.BytesSent = relay(cconn, sconn, profile)
+	}()
+
+	go func() {
+		defer wg.Done()
+		tunnel.BytesReceived = relay(sconn, cconn, profile)
+	}()
+
+	wg.Wait()
+
+	tunnel.Duration = time.Since(tunnel.StartedAt)
+
+	_, err = h.passthroughService.SavePassthroughTunnel(ctx, tunnel)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Alerts clients send when they do not accept a certificate, as worded by crypto/tls
+var certificateRejectionAlerts = []string{
+	"tls: bad certificate",
+	"tls: unsupported certificate",
+	"tls: revoked certificate",
+	"tls: expired certificate",
+	"tls: unknown certificate",
+	"tls: unknown certificate authority",
+}
+
+// isCertificateRejection reports whether a handshake failed because the client rejected
+// the forged certificate. Failures to reach the target, timeouts and clients going away
+// say nothing about the certificate, so they are not counted towards passthrough.
+func isCertificateRejection(err error) bool {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "remote error" {
+		return false
+	}
+
+	return slices.Contains(certificateRejectionAlerts, opErr.Err.Error())
+}
+
+// relay copies src to dst under the network conditions of profile and closes both once src
+// is drained, so the opposite direction ends too. It returns the number of bytes copied.
+func relay(src net.Conn, dst net.Conn, profile *domain.NetworkProfile) (n int64) {
+	w := simulate(dst, profile)
+	n, err := io.Copy(w, src)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Println("passthrough relay err:", err)
+	}
+	w.Close()
+
+	src.Close()
+	dst.Close()
+
+	return
+}
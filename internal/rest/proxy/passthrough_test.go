@@ -0,0 +1,101 @@
+package rest_proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+
+	"github.com/burp_junior/pkg/certs"
+)
+
+func TestIsCertificateRejection(t *testing.T) {
+	ca, err := certs.GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+
+	cert, err := certs.SignTLSCert("example.com", ca)
+	if err != nil {
+		t.Fatalf("SignTLSCert() error = %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+
+	serverConf := &tls.Config{Certificates: []tls.Certificate{*cert}}
+
+	tests := []struct {
+		name   string
+		server *tls.Config
+		client func(conn net.Conn)
+		want   bool
+	}{
+		{
+			name:   "untrusted authority",
+			server: serverConf,
+			client: func(conn net.Conn) {
+				tls.Client(conn, &tls.Config{ServerName: "example.com"}).Handshake()
+			},
+			want: true,
+		},
+		{
+			name:   "certificate for another host",
+			server: serverConf,
+			client: func(conn net.Conn) {
+				tls.Client(conn, &tls.Config{ServerName: "other.com", RootCAs: roots}).Handshake()
+			},
+			want: true,
+		},
+		{
+			name: "no common protocol version",
+			server: &tls.Config{
+				Certificates: []tls.Certificate{*cert},
+				MinVersion:   tls.VersionTLS13,
+			},
+			client: func(conn net.Conn) {
+				tls.Client(conn, &tls.Config{ServerName: "example.com", RootCAs: roots, MaxVersion: tls.VersionTLS12}).Handshake()
+			},
+			want: false,
+		},
+		{
+			name:   "client goes away",
+			server: serverConf,
+			client: func(conn net.Conn) {},
+			want:   false,
+		},
+		{
+			name:   "plain http instead of tls",
+			server: serverConf,
+			client: func(conn net.Conn) {
+				conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				defer client.Close()
+				tt.client(client)
+			}()
+
+			_, err := handshake(server, tt.server)
+			server.Close()
+			<-done
+
+			if err == nil {
+				t.Fatal("handshake() succeeded")
+			}
+
+			if got := isCertificateRejection(err); got != tt.want {
+				t.Errorf("isCertificateRejection(%v) = %v, want %v", err, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,229 +1,891 @@
-package rest_proxy
-
-import (
-	"bufio"
-	"bytes"
-	"context"
-	"crypto/tls"
-	"io"
-	"log"
-	"net"
-	"net/http"
-	"strings"
-	"sync"
-
-	"github.com/burp_junior/customerrors"
-	"github.com/burp_junior/domain"
-	"github.com/burp_junior/pkg/jsonutils"
-)
-
-var okHeader = []byte("HTTP/1.1 200 Connection Established\r\n\r\n")
-
-type RequestService interface {
-	ParseHTTPRequest(ctx context.Context, r *http.Request) (pr *domain.HTTPRequest, err error)
-	SendHTTPRequest(ctx context.Context, pr *domain.HTTPRequest) (resp *domain.HTTPResponse, err error)
-	GetTLSConfig(ctx context.Context, pr *domain.HTTPRequest) (cfg *tls.Config, sconn *tls.Conn, err error)
-	ParseHTTPResponse(ctx context.Context, resp *http.Response) (*domain.HTTPResponse, error)
-	SaveRequest(ctx context.Context, r *domain.HTTPRequest) (newReq *domain.HTTPRequest, err error)
-	SaveHTTPResponse(ctx context.Context, resp *domain.HTTPResponse, req *domain.HTTPRequest) (savedResp *domain.HTTPResponse, err error)
-}
-
-type SafeBuffer struct {
-	buf []byte
-	mu  sync.Mutex
-}
-
-type ProxyHandler struct {
-	requestService RequestService
-}
-
-func NewProxyHandler(requestService RequestService) *ProxyHandler {
-	return &ProxyHandler{
-		requestService: requestService,
-	}
-}
-
-func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	pr, err := h.requestService.ParseHTTPRequest(r.Context(), r)
-	if err != nil {
-		log.Println(err)
-		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrParsingRequest)
-		return
-	}
-
-	if pr.Method == http.MethodConnect {
-		err = h.serveConnect(w, r, pr)
-		if err != nil {
-			log.Println("connect err:", err)
-			return
-		}
-
-		return
-	}
-
-	savedResp, err := h.requestService.SendHTTPRequest(r.Context(), pr)
-	if err != nil {
-		log.Println(err)
-		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrSendingRequest)
-		return
-	}
-
-	err = h.ServeHTTPResponse(w, savedResp)
-	if err != nil {
-		log.Println(err)
-		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrServingResponse)
-		return
-	}
-}
-
-func (h *ProxyHandler) ServeHTTPResponse(w http.ResponseWriter, httpResponse *domain.HTTPResponse) (err error) {
-	// Write status code
-	w.WriteHeader(httpResponse.Code)
-
-	// Write headers
-	for key, values := range httpResponse.Headers {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
-	}
-
-	// Write body
-	_, err = io.Copy(w, strings.NewReader(httpResponse.Body))
-	if err != nil {
-		return
-	}
-
-	return
-}
-
-func (h *ProxyHandler) serveConnect(w http.ResponseWriter, r *http.Request, pr *domain.HTTPRequest) (err error) {
-	tlsConf, sconn, err := h.requestService.GetTLSConfig(r.Context(), pr)
-	if err != nil {
-		return
-	}
-
-	cconn, err := handshake(w, tlsConf)
-	if err != nil {
-		return
-	}
-
-	defer cconn.Close()
-
-	if sconn == nil {
-		sconn, err = tls.Dial("tcp", pr.GetFullHost(), tlsConf)
-		if err != nil {
-			log.Println("dial", pr.GetFullHost(), err)
-			return
-		}
-	}
-	defer sconn.Close()
-
-	wg := &sync.WaitGroup{}
-	wg.Add(2)
-
-	reqBuf := &SafeBuffer{
-		buf: make([]byte, 0, 100*1024),
-		mu:  sync.Mutex{},
-	}
-	resBuf := &SafeBuffer{
-		buf: make([]byte, 0, 100*1024),
-		mu:  sync.Mutex{},
-	}
-
-	go transfer(sconn, cconn, wg, resBuf)
-	go transfer(cconn, sconn, wg, reqBuf)
-
-	wg.Wait()
-
-	reqBuf.mu.Lock()
-	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(reqBuf.buf)))
-	reqBuf.mu.Unlock()
-	if err != nil {
-		err = customerrors.ErrParsingRequest
-		return
-	}
-
-	parsedRequest, err := h.requestService.ParseHTTPRequest(r.Context(), req)
-	if err != nil {
-		return
-	}
-
-	parsedRequest.Scheme = "https"
-	parsedRequest.Port = "443"
-
-	parsedRequest, err = h.requestService.SaveRequest(r.Context(), parsedRequest)
-	if err != nil {
-		return
-	}
-
-	resBuf.mu.Lock()
-	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(resBuf.buf)), req)
-	resBuf.mu.Unlock()
-	if err != nil {
-		err = customerrors.ErrParsingResponse
-		return
-	}
-
-	parsedResponse, err := h.requestService.ParseHTTPResponse(r.Context(), res)
-	if err != nil {
-		return
-	}
-
-	_, err = h.requestService.SaveHTTPResponse(r.Context(), parsedResponse, parsedRequest)
-	if err != nil {
-		return
-	}
-
-	return
-}
-
-func transfer(reader io.Reader, writer io.Writer, wg *sync.WaitGroup, transfered *SafeBuffer) {
-	defer wg.Done()
-	buf := make([]byte, 10*1024)
-
-	for {
-		n, err := reader.Read(buf)
-		if err != nil && err != io.EOF {
-			log.Println("Error reading from connection:", err)
-			return
-		}
-
-		err = nil
-
-		if n > 0 {
-			transfered.mu.Lock()
-			transfered.buf = append(transfered.buf, buf[:n]...)
-			transfered.mu.Unlock()
-
-			_, err = writer.Write(buf[:n])
-			if err != nil {
-				log.Println("Error writing to connection:", err)
-				return
-			}
-		} else {
-			return
-		}
-	}
-}
-
-func handshake(w http.ResponseWriter, config *tls.Config) (net.Conn, error) {
-	raw, _, err := w.(http.Hijacker).Hijack()
-	if err != nil {
-		http.Error(w, "no upstream", 503)
-		return nil, err
-	}
-
-	if _, err = raw.Write(okHeader); err != nil {
-		raw.Close()
-		return nil, err
-	}
-
-	conn := tls.Server(raw, config)
-	err = conn.Handshake()
-	if err != nil {
-		conn.Close()
-		raw.Close()
-		return nil, err
-	}
-	return conn, nil
-}
+package rest_proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/jsonutils"
+	"github.com/burp_junior/pkg/timing"
+	"golang.org/x/net/http2"
+)
+
+var okHeader = []byte("HTTP/1.1 200 Connection Established\r\n\r\n")
+
+var hopByHopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+type RequestService interface {
+	ParseHTTPRequest(ctx context.Context, r *http.Request) (pr *domain.HTTPRequest, err error)
+	GetTLSConfig(ctx context.Context, pr *domain.HTTPRequest) (cfg *tls.Config, upstream <-chan *tls.Conn, err error)
+	ParseHTTPResponse(ctx context.Context, resp *http.Response) (*domain.HTTPResponse, error)
+	SaveRequest(ctx context.Context, r *domain.HTTPRequest) (newReq *domain.HTTPRequest, err error)
+	SaveHTTPResponse(ctx context.Context, resp *domain.HTTPResponse, req *domain.HTTPRequest) (savedResp *domain.HTTPResponse, err error)
+	BuildHTTPRequest(ctx context.Context, pr *domain.HTTPRequest) (req *http.Request, err error)
+	DoHTTPRequest(ctx context.Context, pr *domain.HTTPRequest) (resp *domain.HTTPResponse, err error)
+	OpenHTTPRequest(ctx context.Context, pr *domain.HTTPRequest) (resp *domain.HTTPResponse, err error)
+	InScope(ctx context.Context, pr *domain.HTTPRequest) bool
+	DialUpstream(ctx context.Context, pr *domain.HTTPRequest) (conn net.Conn, err error)
+	DialUpstreamTCP(ctx context.Context, pr *domain.HTTPRequest) (conn net.Conn, err error)
+	DialUpstreamTLS(ctx context.Context, pr *domain.HTTPRequest, cfg *tls.Config) (sconn *tls.Conn, err error)
+}
+
+type InterceptService interface {
+	InterceptRequest(ctx context.Context, req *domain.HTTPRequest) (forwarded *domain.HTTPRequest, intercepted bool, err error)
+	InterceptResponse(ctx context.Context, req *domain.HTTPRequest, res *domain.HTTPResponse) (forwarded *domain.HTTPResponse, intercepted bool, err error)
+}
+
+type RulesService interface {
+	ApplyRequestRules(ctx context.Context, req *domain.HTTPRequest) (modified bool, err error)
+	ApplyResponseRules(ctx context.Context, res *domain.HTTPResponse) (modified bool, err error)
+}
+
+type WebSocketService interface {
+	Relay(ctx context.Context, handshake *domain.HTTPRequest, record bool, client io.ReadWriteCloser, server io.ReadWriteCloser)
+}
+
+type PassthroughService interface {
+	IsPassthrough(ctx context.Context, host string) bool
+	ReportHandshakeFailure(ctx context.Context, host string)
+	ReportHandshakeSuccess(ctx context.Context, host string)
+	SavePassthroughTunnel(ctx context.Context, tunnel *domain.PassthroughTunnel) (savedTunnel *domain.PassthroughTunnel, err error)
+}
+
+type CAService interface {
+	ExportCA(ctx context.Context, format string, password string) (export *domain.CAExport, err error)
+}
+
+type NetworkService interface {
+	GetNetworkConditions(ctx context.Context, host string) (profile *domain.NetworkProfile, fault domain.NetworkFault)
+}
+
+type ProxyHandler struct {
+	requestService     RequestService
+	interceptService   InterceptService
+	rulesService       RulesService
+	webSocketService   WebSocketService
+	passthroughService PassthroughService
+	caService          CAService
+	networkService     NetworkService
+	proxyUserService   ProxyUserService
+	tunnels            *tunnels
+	// ctx is the base of every request served, it is cancelled once shutdown times out
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewProxyHandler(requestService RequestService, interceptService InterceptService, rulesService RulesService, webSocketService WebSocketService, passthroughService PassthroughService, caService CAService, networkService NetworkService, proxyUserService ProxyUserService) *ProxyHandler {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &ProxyHandler{
+		requestService:     requestService,
+		interceptService:   interceptService,
+		rulesService:       rulesService,
+		webSocketService:   webSocketService,
+		passthroughService: passthroughService,
+		caService:          caService,
+		networkService:     networkService,
+		proxyUserService:   proxyUserService,
+		tunnels:            newTunnels(),
+		ctx:                ctx,
+		cancel:             cancel,
+	}
+}
+
+func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	disableWebSocketExtensions(r)
+
+	rawHead := takeRawHead(r)
+
+	user, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	// Credentials are meant for the proxy and are not passed on to the target
+	r.Header.Del("Proxy-Authorization")
+
+	pr, err := h.requestService.ParseHTTPRequest(r.Context(), r)
+	if err != nil {
+		log.Println(err)
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrParsingRequest)
+		return
+	}
+
+	if rawHead != nil {
+		pr.SetRawHead(rawHead)
+		pr.DelRawHeader("Proxy-Authorization")
+	}
+
+	if user != nil {
+		pr.Tester, pr.Project = user.Tester, user.Project
+	}
+
+	if pr.Method == http.MethodConnect {
+		err = h.serveConnect(w, r, pr)
+		if err != nil {
+			log.Println("connect err:", err)
+			return
+		}
+
+		return
+	}
+
+	if isCAHost(pr) {
+		h.serveCAHost(w, r)
+		return
+	}
+
+	h.serveHTTPExchange(w, r, pr)
+}
+
+// serveHTTPExchange forwards a parsed request upstream and serves the response back to the client.
+// It serves both plain proxy requests and HTTP/2 streams of CONNECT tunnels.
+func (h *ProxyHandler) serveHTTPExchange(w http.ResponseWriter, r *http.Request, pr *domain.HTTPRequest) {
+	// Request bodies over the capture limit are sent on as they arrive, rules and intercept cannot change them
+	if !pr.Truncated {
+		_, err := h.rulesService.ApplyRequestRules(r.Context(), pr)
+		if err != nil {
+			log.Println(err)
+			jsonutils.ServeJSONError(r.Context(), w, err)
+			return
+		}
+
+		pr, _, err = h.interceptService.InterceptRequest(r.Context(), pr)
+		if err != nil {
+			log.Println(err)
+			jsonutils.ServeJSONError(r.Context(), w, err)
+			return
+		}
+	}
+
+	// Network conditions are simulated on the way to the target and back
+	profile, fault := h.networkService.GetNetworkConditions(r.Context(), pr.Host)
+	if h.simulateHTTPFault(w, profile, fault) {
+		return
+	}
+
+	err := delay(r.Context(), profile)
+	if err != nil {
+		return
+	}
+
+	if pr.IsWebSocketUpgrade() {
+		err = h.serveWebSocket(w, r, pr)
+		if err != nil {
+			log.Println("websocket err:", err)
+			return
+		}
+
+		return
+	}
+
+	// Out of scope traffic is proxied without being recorded, as is traffic that fails to be saved.
+	// Streamed requests are saved once they have been sent, when their length is known.
+	inScope := h.requestService.InScope(r.Context(), pr)
+	if inScope && pr.BodyStream == nil {
+		pr, inScope = h.saveRequest(r.Context(), pr)
+	}
+
+	var sent *sentBody
+	if pr.BodyStream != nil {
+		sent = newSentBody(pr.BodyStream)
+		pr.BodyStream = sent
+
+		// The body is read by the transport, which may still be sending it, and must not be read after the handler returns
+		defer sent.wait(r.Context())
+	}
+
+	savedResp, err := h.requestService.OpenHTTPRequest(r.Context(), pr)
+	if err != nil {
+		log.Println(err)
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrSendingRequest)
+		return
+	}
+
+	w = throttleResponse(w, profile)
+	err = delay(r.Context(), profile)
+	if err != nil {
+		if savedResp.BodyStream != nil {
+			savedResp.BodyStream.Close()
+		}
+		return
+	}
+
+	// Bodies over the capture limit are streamed as received, without rules and intercept
+	if savedResp.BodyStream != nil {
+		err = h.serveStreamedResponse(w, savedResp)
+		if err != nil {
+			log.Println("streaming response: ", err)
+		}
+	}
+
+	if inScope && sent != nil {
+		inScope = sent.wait(r.Context())
+		if inScope {
+			pr, inScope = h.saveRequest(r.Context(), pr)
+		}
+	}
+
+	if inScope {
+		h.saveResponse(r.Context(), savedResp, pr)
+	}
+
+	if savedResp.Truncated {
+		return
+	}
+
+	_, err = h.rulesService.ApplyResponseRules(r.Context(), savedResp)
+	if err != nil {
+		log.Println(err)
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	savedResp, _, err = h.interceptService.InterceptResponse(r.Context(), pr, savedResp)
+	if err != nil {
+		log.Println(err)
+		jsonutils.ServeJSONError(r.Context(), w, err)
+		return
+	}
+
+	err = h.ServeHTTPResponse(w, savedResp)
+	if err != nil {
+		log.Println(err)
+		jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrServingResponse)
+		return
+	}
+}
+
+// saveRequest records req. Failing to record an exchange does not fail it, so ok only
+// reports whether the rest of it is to be recorded.
+func (h *ProxyHandler) saveRequest(ctx context.Context, req *domain.HTTPRequest) (saved *domain.HTTPRequest, ok bool) {
+	saved, err := h.requestService.SaveRequest(ctx, req)
+	if err != nil {
+		return req, false
+	}
+
+	return saved, true
+}
+
+// saveResponse records the response to a saved request. Failing to record an exchange
+// does not fail it, so the error is only logged.
+func (h *ProxyHandler) saveResponse(ctx context.Context, res *domain.HTTPResponse, req *domain.HTTPRequest) {
+	_, err := h.requestService.SaveHTTPResponse(ctx, res, req)
+	if err != nil {
+		log.Println("error saving response: ", err)
+	}
+}
+
+// serveStreamedResponse passes a response with a body over the capture limit to the client as it is received
+func (h *ProxyHandler) serveStreamedResponse(w http.ResponseWriter, res *domain.HTTPResponse) (err error) {
+	defer res.BodyStream.Close()
+
+	for key, values := range res.Headers {
+		if slices.Contains(hopByHopHeaders, key) {
+			continue
+		}
+
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	w.WriteHeader(res.Code)
+
+	_, err = io.Copy(w, res.BodyStream)
+	return
+}
+
+func (h *ProxyHandler) ServeHTTPResponse(w http.ResponseWriter, httpResponse *domain.HTTPResponse) (err error) {
+	// Write headers
+	for key, values := range responseHeaders(httpResponse) {
+		// Connection management belongs to the server writing the response,
+		// and HTTP/2 clients reject connection-specific headers altogether
+		if slices.Contains(hopByHopHeaders, key) {
+			continue
+		}
+
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	// Write status code
+	w.WriteHeader(httpResponse.Code)
+
+	// Write body
+	_, err = w.Write(httpResponse.Body)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (h *ProxyHandler) serveConnect(w http.ResponseWriter, r *http.Request, pr *domain.HTTPRequest) (err error) {
+	raw, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		http.Error(w, "no upstream", 503)
+		return
+	}
+	defer raw.Close()
+
+	ctx, done, ok := h.trackTunnel(r.Context(), raw)
+	if !ok {
+		return
+	}
+	defer done()
+
+	if _, err = raw.Write(okHeader); err != nil {
+		return
+	}
+
+	return h.serveTLSTunnel(ctx, pr, raw)
+}
+
+// serveTLSTunnel terminates client TLS on raw with a certificate forged for pr
+// and relays the decrypted traffic to the target server.
+func (h *ProxyHandler) serveTLSTunnel(ctx context.Context, pr *domain.HTTPRequest, raw net.Conn) (err error) {
+	pr.Scheme = "https"
+
+	if h.passthroughService.IsPassthrough(ctx, pr.Host) {
+		return h.servePassthrough(ctx, pr, raw)
+	}
+
+	// The target is dialed with its own trace, the phases are reported with the first exchange
+	recorder := timing.NewRecorder()
+	dialCtx := recorder.WithContext(ctx)
+
+	tlsConf, upstream, err := h.requestService.GetTLSConfig(dialCtx, pr)
+	if err != nil {
+		return
+	}
+
+	cconn, err := handshake(raw, tlsConf)
+
+	// The target is dialed during the handshake to forge its certificate
+	var sconn *tls.Conn
+	select {
+	case sconn = <-upstream:
+	default:
+	}
+
+	if err != nil {
+		if sconn != nil {
+			sconn.Close()
+		}
+
+		if isCertificateRejection(err) {
+			h.passthroughService.ReportHandshakeFailure(ctx, pr.Host)
+		}
+		return
+	}
+
+	h.passthroughService.ReportHandshakeSuccess(ctx, pr.Host)
+
+	defer cconn.Close()
+
+	if cconn.ConnectionState().NegotiatedProtocol == http2.NextProtoTLS {
+		// HTTP/2 streams are sent upstream one by one on their own connections
+		if sconn != nil {
+			sconn.Close()
+		}
+
+		h.serveHTTP2Tunnel(ctx, pr, cconn)
+		return
+	}
+
+	if sconn == nil {
+		sconn, err = h.requestService.DialUpstreamTLS(dialCtx, pr, tlsConf)
+		if err != nil {
+			log.Println("dial", pr.GetFullHost(), err)
+			return
+		}
+	}
+	defer sconn.Close()
+
+	return h.serveTunnel(ctx, pr, cconn, sconn, recorder)
+}
+
+// serveTunnel relays HTTP/1.x exchanges between an established client connection
+// and the target server. pr holds the scheme and port of the tunnel, recorder holds
+// the phases of the dial of sconn and times the first exchange.
+func (h *ProxyHandler) serveTunnel(ctx context.Context, pr *domain.HTTPRequest, cconn net.Conn, sconn net.Conn, recorder *timing.Recorder) (err error) {
+	clientReader := bufio.NewReaderSize(cconn, maxRawHeadSize)
+	firstByte := &firstByteReader{r: sconn}
+	serverReader := bufio.NewReader(firstByte)
+
+	// Every request read from the tunnel is forwarded, answered and saved
+	// before the next one is read, so keep-alive sessions are recorded as
+	// a sequence of exchanges instead of a single one.
+	for {
+		// Later exchanges reuse the connection, so only the first one has connection phases
+		if recorder == nil {
+			recorder = timing.NewRecorder()
+		}
+		firstByte.recorder = recorder
+
+		// Tunnels waiting for the next request are closed right away on shutdown
+		if !h.setTunnelIdle(ctx, true) {
+			return
+		}
+
+		_, err = clientReader.Peek(1)
+		h.setTunnelIdle(ctx, false)
+		if err != nil {
+			if err == io.EOF || errors.Is(err, net.ErrClosed) {
+				err = nil
+			}
+			return
+		}
+
+		var keepAlive bool
+		keepAlive, err = h.serveTunnelExchange(ctx, pr, clientReader, cconn, serverReader, sconn, recorder)
+		recorder = nil
+		if err == io.EOF {
+			err = nil
+			return
+		}
+
+		if err != nil || !keepAlive {
+			return
+		}
+	}
+}
+
+// serveTunnelExchange relays a single request/response pair through the tunnel and saves it.
+// keepAlive reports whether the tunnel can carry further HTTP messages.
+func (h *ProxyHandler) serveTunnelExchange(ctx context.Context, pr *domain.HTTPRequest, clientReader *bufio.Reader, cconn net.Conn, serverReader *bufio.Reader, sconn net.Conn, recorder *timing.Recorder) (keepAlive bool, err error) {
+	rawHead := peekRawHead(clientReader)
+
+	req, err := http.ReadRequest(clientReader)
+	if err != nil {
+		if err != io.EOF {
+			err = customerrors.ErrParsingRequest
+		}
+		return
+	}
+
+	disableWebSocketExtensions(req)
+
+	// The captured part of the body is read before the request is sent on, so the client
+	// is told to send it instead of waiting for the server to
+	if strings.EqualFold(req.Header.Get("Expect"), "100-continue") {
+		_, err = io.WriteString(cconn, "HTTP/1.1 100 Continue\r\n\r\n")
+		if err != nil {
+			return
+		}
+	}
+
+	req.RemoteAddr = cconn.RemoteAddr().String()
+	req.TLS = connectionState(cconn)
+	parsedRequest, err := h.requestService.ParseHTTPRequest(ctx, req)
+	if err != nil {
+		err = customerrors.ErrParsingRequest
+		return
+	}
+
+	parsedRequest.Scheme = pr.Scheme
+	parsedRequest.Port = pr.Port
+	parsedRequest.Tester, parsedRequest.Project = pr.Tester, pr.Project
+	if rawHead != nil {
+		parsedRequest.SetRawHead(rawHead)
+	}
+
+	// Bodies over the capture limit are relayed as they arrive, without rules or intercept
+	var rewritten, intercepted bool
+	if !parsedRequest.Truncated {
+		rewritten, err = h.rulesService.ApplyRequestRules(ctx, parsedRequest)
+		if err != nil {
+			return
+		}
+
+		parsedRequest, intercepted, err = h.interceptService.InterceptRequest(ctx, parsedRequest)
+		if err != nil {
+			return
+		}
+	}
+
+	profile, fault := h.networkService.GetNetworkConditions(ctx, parsedRequest.Host)
+	simulated, keepAlive, err := simulateTunnelFault(cconn, req, profile, fault)
+	if simulated || err != nil {
+		return
+	}
+
+	err = delay(ctx, profile)
+	if err != nil {
+		return
+	}
+
+	// Rewritten or held requests may differ from what the client sent, so they are
+	// rebuilt from the model instead of being relayed as read from the client.
+	outReq := req
+	if rewritten || intercepted {
+		outReq, err = h.requestService.BuildHTTPRequest(ctx, parsedRequest)
+		if err != nil {
+			return
+		}
+	}
+
+	recorder.Start()
+	err = outReq.Write(sconn)
+	if err != nil {
+		return
+	}
+
+	// The body has been written in full, so the length of streamed ones is final
+	reqSize := parsedRequest.BodyLength
+	if rewritten || intercepted {
+		reqSize = max(outReq.ContentLength, 0)
+	}
+
+	inScope := h.requestService.InScope(ctx, parsedRequest)
+	if inScope {
+		var savedRequest *domain.HTTPRequest
+		savedRequest, err = h.requestService.SaveRequest(ctx, parsedRequest)
+		if err != nil {
+			inScope = false
+		} else {
+			parsedRequest = savedRequest
+		}
+	}
+
+	res, err := readFinalResponse(serverReader, outReq, cconn)
+	if err != nil {
+		return
+	}
+
+	parsedResponse, err := h.requestService.ParseHTTPResponse(ctx, res)
+	if err != nil {
+		return
+	}
+
+	parsedResponse.Connection = domain.NewConnectionInfo(sconn.RemoteAddr().String(), connectionState(sconn))
+
+	clientWriter := throttle(cconn, profile)
+	err = delay(ctx, profile)
+	if err != nil {
+		if parsedResponse.BodyStream != nil {
+			parsedResponse.BodyStream.Close()
+		}
+		return
+	}
+
+	// Bodies over the capture limit are relayed as they arrive, without rules or intercept
+	if parsedResponse.BodyStream != nil {
+		res.Body = parsedResponse.BodyStream
+		err = res.Write(clientWriter)
+		parsedResponse.BodyStream.Close()
+		parsedResponse.BodyStream = nil
+		if err != nil {
+			return
+		}
+
+		parsedResponse.Timing = recorder.Finish(reqSize, parsedResponse.BodyLength)
+		if inScope {
+			h.saveResponse(ctx, parsedResponse, parsedRequest)
+		}
+
+		keepAlive = !req.Close && !res.Close
+		return
+	}
+
+	resBody := parsedResponse.RawBody
+	parsedResponse.Timing = recorder.Finish(reqSize, parsedResponse.BodyLength)
+
+	if inScope {
+		h.saveResponse(ctx, parsedResponse, parsedRequest)
+	}
+
+	rewritten, err = h.rulesService.ApplyResponseRules(ctx, parsedResponse)
+	if err != nil {
+		return
+	}
+
+	forwardedResponse, intercepted, err := h.interceptService.InterceptResponse(ctx, parsedRequest, parsedResponse)
+	if err != nil {
+		return
+	}
+
+	outRes := res
+	if rewritten || intercepted {
+		outRes = buildHTTPResponse(forwardedResponse, outReq)
+	} else {
+		res.Body = io.NopCloser(bytes.NewReader(resBody))
+	}
+
+	err = outRes.Write(clientWriter)
+	if err != nil {
+		return
+	}
+
+	// After a protocol switch (e.g. WebSocket) the tunnel no longer carries HTTP,
+	// so the rest of it is relayed as raw bytes.
+	if res.StatusCode == http.StatusSwitchingProtocols {
+		if parsedRequest.IsWebSocketUpgrade() {
+			h.webSocketService.Relay(ctx, parsedRequest, inScope,
+				&bufferedConn{Conn: cconn, r: clientReader},
+				&bufferedConn{Conn: sconn, r: serverReader},
+			)
+
+			return
+		}
+
+		wg := &sync.WaitGroup{}
+		wg.Add(2)
+
+		go transfer(serverReader, cconn, profile, wg)
+		go transfer(clientReader, sconn, profile, wg)
+
+		wg.Wait()
+
+		return
+	}
+
+	keepAlive = !req.Close && !outRes.Close
+
+	return
+}
+
+// peekRawHead returns the head of the next request in r without consuming it,
+// or nil if it does not fit into the buffer of r
+func peekRawHead(r *bufio.Reader) []byte {
+	n := 1
+	for {
+		_, err := r.Peek(n)
+		if err != nil {
+			return nil
+		}
+
+		buf, _ := r.Peek(r.Buffered())
+		if end := bytes.Index(buf, headTerminator); end != -1 {
+			return bytes.Clone(buf[:end+len(headTerminator)])
+		}
+
+		n = len(buf) + 1
+	}
+}
+
+// readFinalResponse reads the response to req from serverReader. Interim 1xx responses,
+// such as 103 Early Hints, are relayed to client as they arrive and are not recorded.
+// 100 Continue has already been answered by the proxy, so it is dropped.
+// 101 Switching Protocols is final.
+func readFinalResponse(serverReader *bufio.Reader, req *http.Request, client io.Writer) (res *http.Response, err error) {
+	for {
+		res, err = http.ReadResponse(serverReader, req)
+		if err != nil {
+			err = customerrors.ErrParsingResponse
+			return
+		}
+
+		if res.StatusCode < 100 || res.StatusCode >= 200 || res.StatusCode == http.StatusSwitchingProtocols {
+			return
+		}
+
+		if res.StatusCode == http.StatusContinue {
+			continue
+		}
+
+		_, err = fmt.Fprintf(client, "HTTP/%d.%d %s\r\n", res.ProtoMajor, res.ProtoMinor, res.Status)
+		if err != nil {
+			return
+		}
+
+		err = res.Header.Write(client)
+		if err != nil {
+			return
+		}
+
+		_, err = io.WriteString(client, "\r\n")
+		if err != nil {
+			return
+		}
+	}
+}
+
+// firstByteReader reports the first byte read from the target to recorder,
+// which is set anew for every exchange of a tunnel
+type firstByteReader struct {
+	r        io.Reader
+	recorder *timing.Recorder
+}
+
+func (f *firstByteReader) Read(p []byte) (n int, err error) {
+	n, err = f.r.Read(p)
+	if n > 0 && f.recorder != nil {
+		f.recorder.GotFirstResponseByte()
+		f.recorder = nil
+	}
+
+	return
+}
+
+// connectionState returns the negotiated TLS state of conn, or nil for plain connections
+func connectionState(conn net.Conn) *tls.ConnectionState {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	state := tlsConn.ConnectionState()
+	return &state
+}
+
+// buildHTTPResponse turns a parsed response back into *http.Response that can be written to the client.
+func buildHTTPResponse(res *domain.HTTPResponse, req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        res.Message,
+		StatusCode:    res.Code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        responseHeaders(res),
+		Body:          io.NopCloser(bytes.NewReader(res.Body)),
+		ContentLength: int64(len(res.Body)),
+		Request:       req,
+	}
+}
+
+// responseHeaders returns headers of a parsed response that are still valid for its body.
+// Body is stored decoded and may be edited, so its framing and encoding headers are dropped.
+func responseHeaders(res *domain.HTTPResponse) (headers http.Header) {
+	headers = make(http.Header, len(res.Headers))
+	for key, values := range res.Headers {
+		if key == "Content-Length" || key == "Transfer-Encoding" {
+			continue
+		}
+
+		if key == "Content-Encoding" && res.ContentEncoding != "" {
+			continue
+		}
+
+		headers[key] = values
+	}
+
+	return
+}
+
+// sentBody tells when a streamed request body has been closed by whoever sent it on
+type sentBody struct {
+	io.ReadCloser
+	done chan struct{}
+	once *sync.Once
+}
+
+func newSentBody(body io.ReadCloser) *sentBody {
+	return &sentBody{
+		ReadCloser: body,
+		done:       make(chan struct{}),
+		once:       &sync.Once{},
+	}
+}
+
+func (b *sentBody) Close() (err error) {
+	err = b.ReadCloser.Close()
+	b.once.Do(func() {
+		close(b.done)
+	})
+
+	return
+}
+
+// wait waits until the body is closed and reports whether it was before ctx was done
+func (b *sentBody) wait(ctx context.Context) bool {
+	select {
+	case <-b.done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func readBody(body io.ReadCloser) (data []byte, err error) {
+	if body == nil {
+		return
+	}
+	defer body.Close()
+
+	data, err = io.ReadAll(body)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// transfer copies reader to writer under the network conditions of profile, nil if there are none
+func transfer(reader io.Reader, writer io.Writer, profile *domain.NetworkProfile, wg *sync.WaitGroup) {
+	defer wg.Done()
+	buf := make([]byte, 10*1024)
+
+	simulated := simulate(writer, profile)
+	defer simulated.Close()
+	writer = simulated
+
+	for {
+		n, err := reader.Read(buf)
+		if err != nil && err != io.EOF {
+			log.Println("Error reading from connection:", err)
+			return
+		}
+
+		if n > 0 {
+			_, err = writer.Write(buf[:n])
+			if err != nil {
+				log.Println("Error writing to connection:", err)
+				return
+			}
+		} else {
+			return
+		}
+	}
+}
+
+// serveHTTP2Tunnel serves the client side of a tunnel that negotiated HTTP/2.
+// Every stream is handled as a separate exchange and sent upstream on its own.
+func (h *ProxyHandler) serveHTTP2Tunnel(ctx context.Context, pr *domain.HTTPRequest, cconn *tls.Conn) {
+	server := &http2.Server{}
+	server.ServeConn(cconn, &http2.ServeConnOpts{
+		Context: ctx,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			parsedRequest, err := h.requestService.ParseHTTPRequest(r.Context(), r)
+			if err != nil {
+				log.Println(err)
+				jsonutils.ServeJSONError(r.Context(), w, customerrors.ErrParsingRequest)
+				return
+			}
+
+			parsedRequest.Scheme = "https"
+			parsedRequest.Port = pr.Port
+			parsedRequest.Tester, parsedRequest.Project = pr.Tester, pr.Project
+
+			h.serveHTTPExchange(w, r, parsedRequest)
+		}),
+	})
+}
+
+// handshake terminates client TLS of a tunnel, offering HTTP/2 via ALPN
+func handshake(raw net.Conn, config *tls.Config) (*tls.Conn, error) {
+	config = config.Clone()
+	config.NextProtos = []string{http2.NextProtoTLS, "http/1.1"}
+
+	conn := tls.Server(raw, config)
+	err := conn.Handshake()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
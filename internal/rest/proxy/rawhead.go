@@ -0,0 +1,105 @@
+package rest_proxy
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// maxRawHeadSize bounds the request heads kept as received, larger ones are only parsed
+const maxRawHeadSize = 64 << 10
+
+var headTerminator = []byte("\r\n\r\n")
+
+type recordingConnKey struct{}
+
+// recordingConn keeps the bytes http.Server reads from the client, so that request heads
+// can be recovered as they were sent. Bodies are read through it too, so only the tail
+// that may still hold the next head is kept.
+type recordingConn struct {
+	net.Conn
+	mu      *sync.Mutex
+	buf     []byte
+	stopped bool
+}
+
+func (c *recordingConn) Read(p []byte) (n int, err error) {
+	n, err = c.Conn.Read(p)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopped {
+		return
+	}
+
+	c.buf = append(c.buf, p[:n]...)
+	if len(c.buf) > maxRawHeadSize {
+		c.buf = append(c.buf[:0], c.buf[len(c.buf)-maxRawHeadSize:]...)
+	}
+
+	return
+}
+
+// takeHead removes the head starting with requestLine and everything before it from the
+// recorded bytes and returns it, or nil if it was not recorded in full
+func (c *recordingConn) takeHead(requestLine string) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	start := bytes.Index(c.buf, []byte(requestLine+"\r\n"))
+	if start == -1 {
+		return nil
+	}
+
+	end := bytes.Index(c.buf[start:], headTerminator)
+	if end == -1 {
+		return nil
+	}
+	end += start + len(headTerminator)
+
+	head := bytes.Clone(c.buf[start:end])
+	c.buf = append(c.buf[:0], c.buf[end:]...)
+
+	return head
+}
+
+// stop ends recording, e.g. once the connection is hijacked for a tunnel
+func (c *recordingConn) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stopped = true
+	c.buf = nil
+}
+
+type recordingListener struct {
+	net.Listener
+}
+
+func (l *recordingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &recordingConn{Conn: conn, mu: &sync.Mutex{}}, nil
+}
+
+// takeRawHead returns the head of r as received from the client, or nil if it was not recorded
+func takeRawHead(r *http.Request) []byte {
+	rc, ok := r.Context().Value(recordingConnKey{}).(*recordingConn)
+	if !ok {
+		return nil
+	}
+
+	head := rc.takeHead(r.Method + " " + r.RequestURI + " " + r.Proto)
+
+	// Tunnels are read by the proxy itself
+	if r.Method == http.MethodConnect {
+		rc.stop()
+	}
+
+	return head
+}
@@ -0,0 +1,325 @@
+package rest_proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/timing"
+)
+
+// SOCKS5 protocol constants (RFC 1928)
+const (
+	socksVersion = 0x05
+
+	socksMethodNoAuth       = 0x00
+	socksMethodPassword     = 0x02
+	socksMethodNoAcceptable = 0xFF
+
+	// Username/password subnegotiation (RFC 1929)
+	socksPasswordVersion = 0x01
+	socksPasswordSuccess = 0x00
+	socksPasswordFailure = 0x01
+
+	socksCmdConnect = 0x01
+
+	socksAddrIPv4   = 0x01
+	socksAddrDomain = 0x03
+	socksAddrIPv6   = 0x04
+
+	socksReplySucceeded           = 0x00
+	socksReplyCommandNotSupported = 0x07
+	socksReplyAddrNotSupported    = 0x08
+)
+
+// tlsRecordHandshake is the first byte of a TLS ClientHello record
+const tlsRecordHandshake = 0x16
+
+// sniffTimeout is how long SOCKS tunnels and transparent connections wait for the client
+// to speak first. In SOCKS tunnels protocols where the server speaks first are relayed as raw bytes.
+var sniffTimeout = 2 * time.Second
+
+// ServeSOCKS5 serves a single SOCKS5 client connection. CONNECT tunnels are fed
+// into the same pipeline as the HTTP proxy: TLS streams are intercepted with a forged
+// certificate, plaintext HTTP is parsed as is, anything else is relayed untouched.
+func (h *ProxyHandler) ServeSOCKS5(conn net.Conn) {
+	defer conn.Close()
+
+	ctx, done, ok := h.trackTunnel(h.ctx, conn)
+	if !ok {
+		return
+	}
+	defer done()
+
+	reader := bufio.NewReader(conn)
+
+	pr, err := h.socksHandshake(ctx, reader, conn)
+	if err != nil {
+		log.Println("socks handshake err:", err)
+		return
+	}
+
+	err = h.serveSOCKSTunnel(ctx, pr, &bufferedConn{Conn: conn, r: reader})
+	if err != nil {
+		log.Println("socks tunnel err:", err)
+		return
+	}
+}
+
+// socksHandshake negotiates the authentication method and reads the CONNECT command.
+// The target is returned as a CONNECT request model, like for the HTTP proxy. Once proxy
+// users exist, clients have to authenticate with username and password as one of them.
+func (h *ProxyHandler) socksHandshake(ctx context.Context, reader *bufio.Reader, conn net.Conn) (pr *domain.HTTPRequest, err error) {
+	header := make([]byte, 2)
+	_, err = io.ReadFull(reader, header)
+	if err != nil {
+		return
+	}
+
+	if header[0] != socksVersion {
+		err = fmt.Errorf("unsupported socks version %d", header[0])
+		return
+	}
+
+	methods := make([]byte, header[1])
+	_, err = io.ReadFull(reader, methods)
+	if err != nil {
+		return
+	}
+
+	wanted := byte(socksMethodNoAuth)
+	if h.proxyUserService.AuthRequired(ctx) {
+		wanted = socksMethodPassword
+	}
+
+	method := byte(socksMethodNoAcceptable)
+	if slices.Contains(methods, wanted) {
+		method = wanted
+	}
+
+	_, err = conn.Write([]byte{socksVersion, method})
+	if err != nil {
+		return
+	}
+
+	if method == socksMethodNoAcceptable {
+		err = errors.New("no acceptable socks auth method")
+		return
+	}
+
+	var user *domain.ProxyUser
+	if method == socksMethodPassword {
+		user, err = h.socksAuthenticate(ctx, reader, conn)
+		if err != nil {
+			return
+		}
+	}
+
+	request := make([]byte, 4)
+	_, err = io.ReadFull(reader, request)
+	if err != nil {
+		return
+	}
+
+	if request[0] != socksVersion {
+		err = fmt.Errorf("unsupported socks version %d", request[0])
+		return
+	}
+
+	if request[1] != socksCmdConnect {
+		writeSOCKSReply(conn, socksReplyCommandNotSupported)
+		err = fmt.Errorf("unsupported socks command %d", request[1])
+		return
+	}
+
+	var host string
+	switch request[3] {
+	case socksAddrIPv4, socksAddrIPv6:
+		size := net.IPv4len
+		if request[3] == socksAddrIPv6 {
+			size = net.IPv6len
+		}
+
+		ip := make(net.IP, size)
+		_, err = io.ReadFull(reader, ip)
+		if err != nil {
+			return
+		}
+		host = ip.String()
+	case socksAddrDomain:
+		var size byte
+		size, err = reader.ReadByte()
+		if err != nil {
+			return
+		}
+
+		domainName := make([]byte, size)
+		_, err = io.ReadFull(reader, domainName)
+		if err != nil {
+			return
+		}
+		host = string(domainName)
+	default:
+		writeSOCKSReply(conn, socksReplyAddrNotSupported)
+		err = fmt.Errorf("unsupported socks address type %d", request[3])
+		return
+	}
+
+	port := make([]byte, 2)
+	_, err = io.ReadFull(reader, port)
+	if err != nil {
+		return
+	}
+
+	// The target is dialed lazily once the stream is sniffed, as for CONNECT
+	// requests of the HTTP proxy, so success is reported right away.
+	err = writeSOCKSReply(conn, socksReplySucceeded)
+	if err != nil {
+		return
+	}
+
+	pr = &domain.HTTPRequest{
+		Method: http.MethodConnect,
+		Host:   host,
+		Port:   strconv.Itoa(int(binary.BigEndian.Uint16(port))),
+		Scheme: "http",
+	}
+
+	if user != nil {
+		pr.Tester, pr.Project = user.Tester, user.Project
+	}
+
+	return
+}
+
+// socksAuthenticate reads the username and password of the client and checks them
+// against the proxy users
+func (h *ProxyHandler) socksAuthenticate(ctx context.Context, reader *bufio.Reader, conn net.Conn) (user *domain.ProxyUser, err error) {
+	version, err := reader.ReadByte()
+	if err != nil {
+		return
+	}
+
+	if version != socksPasswordVersion {
+		err = fmt.Errorf("unsupported socks auth version %d", version)
+		return
+	}
+
+	var credentials [2]string
+	for i := range credentials {
+		var size byte
+		size, err = reader.ReadByte()
+		if err != nil {
+			return
+		}
+
+		value := make([]byte, size)
+		_, err = io.ReadFull(reader, value)
+		if err != nil {
+			return
+		}
+		credentials[i] = string(value)
+	}
+
+	user = h.proxyUserService.Authenticate(ctx, credentials[0], credentials[1])
+
+	status := byte(socksPasswordSuccess)
+	if user == nil {
+		status = socksPasswordFailure
+	}
+
+	_, err = conn.Write([]byte{socksPasswordVersion, status})
+	if err != nil {
+		return
+	}
+
+	if user == nil {
+		err = fmt.Errorf("socks auth failed for %q", credentials[0])
+		return
+	}
+
+	return
+}
+
+func writeSOCKSReply(conn net.Conn, reply byte) (err error) {
+	// Bound address is not meaningful for an intercepting proxy, so zeros are sent
+	_, err = conn.Write([]byte{socksVersion, reply, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// serveSOCKSTunnel sniffs the first bytes sent by the client to pick how the tunnel is served
+func (h *ProxyHandler) serveSOCKSTunnel(ctx context.Context, pr *domain.HTTPRequest, cconn *bufferedConn) (err error) {
+	err = cconn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	if err != nil {
+		return
+	}
+
+	first, err := cconn.r.Peek(1)
+	if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+		if err == io.EOF {
+			err = nil
+		}
+		return
+	}
+
+	err = cconn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return
+	}
+
+	if len(first) > 0 && first[0] == tlsRecordHandshake {
+		return h.serveTLSTunnel(ctx, pr, cconn)
+	}
+
+	recorder := timing.NewRecorder()
+	sconn, err := h.requestService.DialUpstream(recorder.WithContext(ctx), pr)
+	if err != nil {
+		return
+	}
+	defer sconn.Close()
+
+	// HTTP methods are uppercase tokens
+	if len(first) > 0 && first[0] >= 'A' && first[0] <= 'Z' {
+		return h.serveTunnel(ctx, pr, cconn, sconn, recorder)
+	}
+
+	// Raw tunnels carry no requests to answer, so simulated errors are left out
+	profile, fault := h.networkService.GetNetworkConditions(ctx, pr.Host)
+	if fault == domain.NetworkFaultDrop || fault == domain.NetworkFaultReset {
+		closeConn(cconn, fault)
+		return
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+
+	// Either side closing ends the whole tunnel
+	go func() {
+		transfer(sconn, cconn, profile, wg)
+		cconn.Close()
+	}()
+	go func() {
+		transfer(cconn, sconn, profile, wg)
+		sconn.Close()
+	}()
+
+	wg.Wait()
+
+	return
+}
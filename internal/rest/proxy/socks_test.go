@@ -0,0 +1,169 @@
+package rest_proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/burp_junior/domain"
+)
+
+// testProxyUsers accepts the passwords of users, keyed by username
+type testProxyUsers struct {
+	users     map[string]*domain.ProxyUser
+	passwords map[string]string
+}
+
+func (u *testProxyUsers) AuthRequired(ctx context.Context) bool {
+	return len(u.users) > 0
+}
+
+func (u *testProxyUsers) Authenticate(ctx context.Context, username string, password string) *domain.ProxyUser {
+	if u.passwords[username] != password {
+		return nil
+	}
+
+	return u.users[username]
+}
+
+// socksPassword builds an RFC 1929 username/password request
+func socksPassword(username, password string) []byte {
+	msg := []byte{socksPasswordVersion, byte(len(username))}
+	msg = append(msg, username...)
+	msg = append(msg, byte(len(password)))
+	return append(msg, password...)
+}
+
+func TestSOCKSHandshake(t *testing.T) {
+	alice := &domain.ProxyUser{Username: "alice", Tester: "alice", Project: "shop"}
+	withUsers := &testProxyUsers{
+		users:     map[string]*domain.ProxyUser{"alice": alice},
+		passwords: map[string]string{"alice": "secret"},
+	}
+	withoutUsers := &testProxyUsers{}
+
+	succeeded := []byte{socksVersion, socksReplySucceeded, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0}
+	connectDomain := append([]byte{socksVersion, socksCmdConnect, 0x00, socksAddrDomain, 11}, "example.com\x01\xbb"...)
+
+	tests := []struct {
+		name      string
+		users     *testProxyUsers
+		client    []byte
+		wantReply []byte
+		want      *domain.HTTPRequest
+		wantErr   bool
+	}{
+		{
+			name:      "no auth, domain target",
+			users:     withoutUsers,
+			client:    append([]byte{socksVersion, 1, socksMethodNoAuth}, connectDomain...),
+			wantReply: append([]byte{socksVersion, socksMethodNoAuth}, succeeded...),
+			want:      &domain.HTTPRequest{Method: "CONNECT", Host: "example.com", Port: "443", Scheme: "http"},
+		},
+		{
+			name:      "no auth, IPv4 target",
+			users:     withoutUsers,
+			client:    []byte{socksVersion, 1, socksMethodNoAuth, socksVersion, socksCmdConnect, 0x00, socksAddrIPv4, 10, 0, 0, 1, 0x00, 0x50},
+			wantReply: append([]byte{socksVersion, socksMethodNoAuth}, succeeded...),
+			want:      &domain.HTTPRequest{Method: "CONNECT", Host: "10.0.0.1", Port: "80", Scheme: "http"},
+		},
+		{
+			name:  "no auth, IPv6 target",
+			users: withoutUsers,
+			client: append([]byte{socksVersion, 1, socksMethodNoAuth, socksVersion, socksCmdConnect, 0x00, socksAddrIPv6},
+				append(net.ParseIP("2001:db8::1").To16(), 0x1f, 0x90)...),
+			wantReply: append([]byte{socksVersion, socksMethodNoAuth}, succeeded...),
+			want:      &domain.HTTPRequest{Method: "CONNECT", Host: "2001:db8::1", Port: "8080", Scheme: "http"},
+		},
+		{
+			name:  "password of a proxy user tags the tunnel",
+			users: withUsers,
+			client: append(append([]byte{socksVersion, 2, socksMethodNoAuth, socksMethodPassword},
+				socksPassword("alice", "secret")...), connectDomain...),
+			wantReply: append([]byte{socksVersion, socksMethodPassword, socksPasswordVersion, socksPasswordSuccess}, succeeded...),
+			want:      &domain.HTTPRequest{Method: "CONNECT", Host: "example.com", Port: "443", Scheme: "http", Tester: "alice", Project: "shop"},
+		},
+		{
+			name:      "bad credentials",
+			users:     withUsers,
+			client:    append([]byte{socksVersion, 1, socksMethodPassword}, socksPassword("alice", "wrong")...),
+			wantReply: []byte{socksVersion, socksMethodPassword, socksPasswordVersion, socksPasswordFailure},
+			wantErr:   true,
+		},
+		{
+			name:      "unknown user",
+			users:     withUsers,
+			client:    append([]byte{socksVersion, 1, socksMethodPassword}, socksPassword("mallory", "secret")...),
+			wantReply: []byte{socksVersion, socksMethodPassword, socksPasswordVersion, socksPasswordFailure},
+			wantErr:   true,
+		},
+		{
+			name:      "no auth offered while users exist",
+			users:     withUsers,
+			client:    []byte{socksVersion, 1, socksMethodNoAuth},
+			wantReply: []byte{socksVersion, socksMethodNoAcceptable},
+			wantErr:   true,
+		},
+		{
+			name:      "unsupported command",
+			users:     withoutUsers,
+			client:    []byte{socksVersion, 1, socksMethodNoAuth, socksVersion, 0x02, 0x00, socksAddrIPv4},
+			wantReply: []byte{socksVersion, socksMethodNoAuth, socksVersion, socksReplyCommandNotSupported, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0},
+			wantErr:   true,
+		},
+		{
+			name:      "unsupported address type",
+			users:     withoutUsers,
+			client:    []byte{socksVersion, 1, socksMethodNoAuth, socksVersion, socksCmdConnect, 0x00, 0x05},
+			wantReply: []byte{socksVersion, socksMethodNoAuth, socksVersion, socksReplyAddrNotSupported, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0},
+			wantErr:   true,
+		},
+		{
+			name:    "other socks version",
+			users:   withoutUsers,
+			client:  []byte{0x04, 1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+
+			go client.Write(tt.client)
+
+			replies := make(chan []byte)
+			go func() {
+				reply, _ := io.ReadAll(client)
+				replies <- reply
+			}()
+
+			h := NewProxyHandler(nil, nil, nil, nil, nil, nil, nil, tt.users)
+			pr, err := h.socksHandshake(context.Background(), bufio.NewReader(server), server)
+			server.Close()
+
+			if reply := <-replies; !bytes.Equal(reply, tt.wantReply) {
+				t.Errorf("reply = %v, want %v", reply, tt.wantReply)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("socksHandshake() = %+v, want an error", pr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("socksHandshake() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(pr, tt.want) {
+				t.Errorf("socksHandshake() = %+v, want %+v", pr, tt.want)
+			}
+		})
+	}
+}
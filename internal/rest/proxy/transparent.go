@@ -0,0 +1,197 @@
+package rest_proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/burp_junior/domain"
+)
+
+var errSNISniffed = errors.New("sni sniffed")
+
+// transparentListener accepts connections redirected to the proxy by iptables or
+// a hosts-file entry. Plaintext connections are handed to http.Server as usual, since
+// origin-form requests carry their target in the Host header. TLS connections are
+// served by the listener itself, with the target taken from the ClientHello SNI.
+// Clients cannot authenticate, so once proxy users exist only an open listener serves them.
+type transparentListener struct {
+	net.Listener
+	h     *ProxyHandler
+	open  bool
+	conns chan net.Conn
+	// done is closed once accepting fails, err is the failure
+	done chan struct{}
+	err  error
+}
+
+// TransparentListener wraps l for serving clients that are not configured to use the proxy.
+// An open listener serves them without credentials even if proxy users exist.
+func (h *ProxyHandler) TransparentListener(l net.Listener, open bool) net.Listener {
+	tl := &transparentListener{
+		Listener: l,
+		h:        h,
+		open:     open,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+
+	go tl.acceptLoop()
+
+	return tl
+}
+
+func (l *transparentListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+func (l *transparentListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.err = err
+			close(l.done)
+			return
+		}
+
+		go l.sniff(conn)
+	}
+}
+
+// sniff waits for the first byte of the client and dispatches the connection by it.
+// Clients that send nothing within sniffTimeout are disconnected.
+func (l *transparentListener) sniff(conn net.Conn) {
+	cconn := &bufferedConn{Conn: conn, r: bufio.NewReader(conn)}
+
+	// Until it is handed to the server the connection is a tunnel of the proxy,
+	// closed right away on shutdown while the client is silent
+	ctx, done, ok := l.h.trackTunnel(l.h.ctx, cconn)
+	if !ok {
+		conn.Close()
+		return
+	}
+	defer done()
+
+	if !l.h.setTunnelIdle(ctx, true) {
+		conn.Close()
+		return
+	}
+
+	// The deadline also covers the ClientHello, it is cleared once the SNI is sniffed
+	err := conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	first, err := cconn.r.Peek(1)
+	l.h.setTunnelIdle(ctx, false)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	if first[0] != tlsRecordHandshake {
+		err = conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			conn.Close()
+			return
+		}
+
+		// Connections sniffed after the listener is closed have no server to go to
+		select {
+		case l.conns <- cconn:
+		case <-l.done:
+			conn.Close()
+		}
+		return
+	}
+
+	defer cconn.Close()
+
+	// Refused TLS clients cannot be told why, so the connection is just closed
+	if !l.open && l.h.proxyUserService.AuthRequired(l.h.ctx) {
+		return
+	}
+
+	err = l.h.serveTransparentTLS(ctx, cconn)
+	if err != nil {
+		log.Println("transparent tls err:", err)
+		return
+	}
+}
+
+// serveTransparentTLS intercepts a TLS connection that was not preceded by CONNECT.
+// The port is not known to the proxy, so the default https port is assumed.
+func (h *ProxyHandler) serveTransparentTLS(ctx context.Context, cconn *bufferedConn) (err error) {
+	sni, err := sniffSNI(cconn)
+	if err != nil {
+		return
+	}
+
+	err = cconn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return
+	}
+
+	if sni == "" {
+		err = errors.New("client hello without sni")
+		return
+	}
+
+	pr := &domain.HTTPRequest{
+		Method: http.MethodConnect,
+		Host:   sni,
+		Port:   "443",
+		Scheme: "https",
+	}
+
+	return h.serveTLSTunnel(ctx, pr, cconn)
+}
+
+// readOnlyConn lets a throwaway TLS server read the ClientHello without answering it
+type readOnlyConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *readOnlyConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *readOnlyConn) Write(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+// sniffSNI returns the server name of the ClientHello sent on conn, empty if there is none.
+// The bytes read are put back in front of conn, so the real handshake sees them again.
+func sniffSNI(conn *bufferedConn) (sni string, err error) {
+	read := &bytes.Buffer{}
+	sniffer := tls.Server(&readOnlyConn{Conn: conn.Conn, r: io.TeeReader(conn.r, read)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			sni = hello.ServerName
+			return nil, errSNISniffed
+		},
+	})
+
+	err = sniffer.Handshake()
+	conn.r = bufio.NewReader(io.MultiReader(read, conn.r))
+	if !errors.Is(err, errSNISniffed) {
+		return
+	}
+	err = nil
+
+	return
+}
@@ -0,0 +1,107 @@
+package rest_proxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/burp_junior/domain"
+)
+
+// bufferedConn reads through r, which may already hold bytes read from Conn
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// disableWebSocketExtensions keeps the handshake from negotiating extensions
+// such as permessage-deflate, so relayed frames can be recorded as is.
+func disableWebSocketExtensions(r *http.Request) {
+	r.Header.Del("Sec-WebSocket-Extensions")
+}
+
+// serveWebSocket performs the opening handshake of a plain proxy request with the target
+// and, once the protocol is switched, relays frames between client and server.
+func (h *ProxyHandler) serveWebSocket(w http.ResponseWriter, r *http.Request, pr *domain.HTTPRequest) (err error) {
+	inScope := h.requestService.InScope(r.Context(), pr)
+	if inScope {
+		var savedRequest *domain.HTTPRequest
+		savedRequest, err = h.requestService.SaveRequest(r.Context(), pr)
+		if err != nil {
+			inScope = false
+		} else {
+			pr = savedRequest
+		}
+	}
+
+	outReq, err := h.requestService.BuildHTTPRequest(r.Context(), pr)
+	if err != nil {
+		return
+	}
+
+	sconn, err := h.requestService.DialUpstream(r.Context(), pr)
+	if err != nil {
+		return
+	}
+	defer sconn.Close()
+
+	err = outReq.Write(sconn)
+	if err != nil {
+		return
+	}
+
+	serverReader := bufio.NewReader(sconn)
+	res, err := http.ReadResponse(serverReader, outReq)
+	if err != nil {
+		return
+	}
+
+	cconn, brw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer cconn.Close()
+
+	ctx, done, ok := h.trackTunnel(r.Context(), cconn)
+	if !ok {
+		return
+	}
+	defer done()
+
+	resBody, err := readBody(res.Body)
+	if err != nil {
+		return
+	}
+
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+	parsedResponse, err := h.requestService.ParseHTTPResponse(r.Context(), res)
+	if err != nil {
+		return
+	}
+
+	err = buildHTTPResponse(parsedResponse, outReq).Write(cconn)
+	if err != nil {
+		return
+	}
+
+	if inScope {
+		h.saveResponse(r.Context(), parsedResponse, pr)
+	}
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		return
+	}
+
+	h.webSocketService.Relay(ctx, pr, inScope,
+		&bufferedConn{Conn: cconn, r: brw.Reader},
+		&bufferedConn{Conn: sconn, r: serverReader},
+	)
+
+	return
+}
@@ -1,42 +1,229 @@
-package routers
-
-import (
-	"log"
-	"net/http"
-
-	rest_api "github.com/burp_junior/internal/rest/api"
-	rest_proxy "github.com/burp_junior/internal/rest/proxy"
-	"github.com/gorilla/mux"
-)
-
-func MountProxyRouter(rs rest_proxy.RequestService) {
-	proxyHandler := rest_proxy.NewProxyHandler(rs)
-
-	proxyPort := ":8080"
-	log.Println("Proxy is running on port " + proxyPort)
-	err := http.ListenAndServe(proxyPort, proxyHandler)
-	if err != nil {
-		log.Println("Proxy failed to listen: ", err)
-		return
-	}
-}
-
-func MountAPIRouter(rs rest_api.RequestService) {
-	r := mux.NewRouter()
-
-	h := rest_api.NewAPIHandler(rs)
-
-	r.HandleFunc("/requests/", h.GetRequestsListHandler).Methods(http.MethodGet, http.MethodOptions)
-	r.HandleFunc("/requests/{id}", h.GetRequestByIDHandler).Methods(http.MethodGet, http.MethodOptions)
-	r.HandleFunc("/requests/{id}/repeat", h.RepeatRequestHandler).Methods(http.MethodPost, http.MethodOptions)
-	r.HandleFunc("/requests/{id}/scan", h.ScanRequestHandler).Methods(http.MethodPost, http.MethodOptions)
-
-	APIPort := ":8000"
-
-	log.Println("WebAPI is running on port " + APIPort)
-	err := http.ListenAndServe(APIPort, r)
-	if err != nil {
-		log.Println("WebAPI failed to listen: ", err)
-		return
-	}
-}
+package routers
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/burp_junior/internal/config"
+	rest_api "github.com/burp_junior/internal/rest/api"
+	rest_proxy "github.com/burp_junior/internal/rest/proxy"
+	"github.com/gorilla/mux"
+)
+
+// newServer returns a server with the client timeouts of cfg
+func newServer(cfg *config.Config) *http.Server {
+	return &http.Server{
+		ReadHeaderTimeout: cfg.Timeouts.ReadHeader,
+		IdleTimeout:       cfg.Timeouts.Idle,
+	}
+}
+
+// serveUntilDone runs serve until ctx is done, then shuts server down. Active requests
+// are waited for until shutdownCtx is done, after that their connections are closed.
+func serveUntilDone(ctx context.Context, shutdownCtx context.Context, server *http.Server, serve func() error) (err error) {
+	served := make(chan error, 1)
+	go func() {
+		served <- serve()
+	}()
+
+	select {
+	case err = <-served:
+		return
+	case <-ctx.Done():
+	}
+
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		server.Close()
+		return
+	}
+
+	return
+}
+
+// MountProxyRouter serves the HTTP proxy until ctx is done and waits for active requests
+// until shutdownCtx is done
+func MountProxyRouter(ctx context.Context, shutdownCtx context.Context, cfg *config.Config, proxyHandler *rest_proxy.ProxyHandler) {
+	proxyAddr := cfg.Proxy.Addr
+	listener, err := net.Listen("tcp", proxyAddr)
+	if err != nil {
+		log.Println("Proxy failed to listen: ", err)
+		return
+	}
+
+	log.Println("Proxy is running on " + proxyAddr)
+	server := newServer(cfg)
+	err = serveUntilDone(ctx, shutdownCtx, server, func() error {
+		return proxyHandler.Serve(server, listener)
+	})
+	if err != nil {
+		log.Println("Proxy failed to serve: ", err)
+		return
+	}
+
+	log.Println("Proxy is stopped")
+}
+
+// MountSOCKSProxyRouter accepts SOCKS5 clients and serves them with the same handler as
+// the HTTP proxy until ctx is done. Clients already accepted are drained by the handler.
+func MountSOCKSProxyRouter(ctx context.Context, cfg *config.Config, proxyHandler *rest_proxy.ProxyHandler) {
+	socksAddr := cfg.SOCKS.Addr
+	if socksAddr == "" {
+		log.Println("SOCKS5 proxy is disabled")
+		return
+	}
+
+	listener, err := net.Listen("tcp", socksAddr)
+	if err != nil {
+		log.Println("SOCKS5 proxy failed to listen: ", err)
+		return
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		listener.Close()
+	})
+	defer stop()
+
+	log.Println("SOCKS5 proxy is running on " + socksAddr)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Println("SOCKS5 proxy is stopped")
+				return
+			}
+
+			log.Println("SOCKS5 proxy failed to accept: ", err)
+			return
+		}
+
+		go proxyHandler.ServeSOCKS5(conn)
+	}
+}
+
+// MountTransparentProxyRouter serves clients whose traffic is redirected to the proxy
+// without proxy settings until ctx is done and waits for active requests until shutdownCtx is done.
+// Both plaintext HTTP and TLS are accepted on the same port.
+func MountTransparentProxyRouter(ctx context.Context, shutdownCtx context.Context, cfg *config.Config, proxyHandler *rest_proxy.ProxyHandler) {
+	transparentAddr := cfg.Transparent.Addr
+	if transparentAddr == "" {
+		log.Println("Transparent proxy is disabled")
+		return
+	}
+
+	listener, err := net.Listen("tcp", transparentAddr)
+	if err != nil {
+		log.Println("Transparent proxy failed to listen: ", err)
+		return
+	}
+
+	log.Println("Transparent proxy is running on " + transparentAddr)
+	server := newServer(cfg)
+	err = serveUntilDone(ctx, shutdownCtx, server, func() error {
+		return proxyHandler.Serve(server, proxyHandler.TransparentListener(listener, cfg.Transparent.AllowUnauthenticated))
+	})
+	if err != nil {
+		log.Println("Transparent proxy failed to serve: ", err)
+		return
+	}
+
+	log.Println("Transparent proxy is stopped")
+}
+
+// MountAPIRouter serves the web API until ctx is done. Requests in progress, scans
+// included, are waited for and cancelled once shutdownCtx is done.
+func MountAPIRouter(ctx context.Context, shutdownCtx context.Context, cfg *config.Config, hs rest_api.HealthService, rs rest_api.RequestService, is rest_api.InterceptService, rls rest_api.RulesService, ss rest_api.ScopeService, wss rest_api.WebSocketService, us rest_api.UpstreamService, ps rest_api.PassthroughService, cas rest_api.CAService, ccs rest_api.ClientCertService, ns rest_api.NetworkService, pus rest_api.ProxyUserService, srs rest_api.SearchService) {
+	r := mux.NewRouter()
+
+	h := rest_api.NewAPIHandler(rs)
+	ih := rest_api.NewInterceptHandler(is)
+	rlh := rest_api.NewRulesHandler(rls)
+	sh := rest_api.NewScopeHandler(ss)
+	wsh := rest_api.NewWebSocketHandler(wss)
+	uh := rest_api.NewUpstreamHandler(us)
+	ph := rest_api.NewPassthroughHandler(ps)
+	cah := rest_api.NewCAHandler(cas)
+	cch := rest_api.NewClientCertHandler(ccs)
+	nh := rest_api.NewNetworkHandler(ns)
+	puh := rest_api.NewProxyUserHandler(pus)
+	hh := rest_api.NewHealthHandler(hs)
+	srh := rest_api.NewSearchHandler(srs)
+
+	r.HandleFunc("/requests/", h.GetRequestsListHandler).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/requests/{id}", h.GetRequestByIDHandler).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/requests/{id}/repeat", h.RepeatRequestHandler).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/requests/{id}/scan", h.ScanRequestHandler).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/requests/{id}/websocket", wsh.GetWebSocketMessagesHandler).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/requests/{id}/websocket/resend", wsh.ResendWebSocketMessageHandler).Methods(http.MethodPost, http.MethodOptions)
+
+	r.HandleFunc("/search", srh.SearchExchangesHandler).Methods(http.MethodGet, http.MethodOptions)
+
+	r.HandleFunc("/intercept/", ih.GetInterceptedListHandler).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/intercept/settings", ih.GetInterceptSettingsHandler).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/intercept/settings", ih.SetInterceptSettingsHandler).Methods(http.MethodPut, http.MethodOptions)
+	r.HandleFunc("/intercept/{id}", ih.GetInterceptedByIDHandler).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/intercept/{id}/forward", ih.ForwardInterceptedHandler).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/intercept/{id}/drop", ih.DropInterceptedHandler).Methods(http.MethodPost, http.MethodOptions)
+
+	r.HandleFunc("/rules/", rlh.GetRulesListHandler).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/rules/", rlh.CreateRuleHandler).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/rules/{id}", rlh.GetRuleByIDHandler).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/rules/{id}", rlh.UpdateRuleHandler).Methods(http.MethodPut, http.MethodOptions)
+	r.HandleFunc("/rules/{id}", rlh.DeleteRuleHandler).Methods(http.MethodDelete, http.MethodOptions)
+
+	r.HandleFunc("/scope", sh.GetScopeHandler).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/scope", sh.SetScopeHandler).Methods(http.MethodPut, http.MethodOptions)
+
+	r.HandleFunc("/upstream-proxies", uh.GetUpstreamProxySettingsHandler).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/upstream-proxies", uh.SetUpstreamProxySettingsHandler).Methods(http.MethodPut, http.MethodOptions)
+
+	r.HandleFunc("/passthrough", ph.GetPassthroughSettingsHandler).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/passthrough", ph.SetPassthroughSettingsHandler).Methods(http.MethodPut, http.MethodOptions)
+	r.HandleFunc("/passthrough/tunnels", ph.GetPassthroughTunnelsListHandler).Methods(http.MethodGet, http.MethodOptions)
+
+	r.HandleFunc("/ca", cah.GetCAHandler).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/ca/rotate", cah.RotateCAHandler).Methods(http.MethodPost, http.MethodOptions)
+
+	r.HandleFunc("/client-certs/", cch.GetClientCertificatesListHandler).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/client-certs/", cch.CreateClientCertificateHandler).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/client-certs/{id}", cch.DeleteClientCertificateHandler).Methods(http.MethodDelete, http.MethodOptions)
+
+	r.HandleFunc("/network-profiles", nh.GetNetworkProfileSettingsHandler).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/network-profiles", nh.SetNetworkProfileSettingsHandler).Methods(http.MethodPut, http.MethodOptions)
+
+	r.HandleFunc("/proxy-users/", puh.GetProxyUsersListHandler).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/proxy-users/", puh.CreateProxyUserHandler).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/proxy-users/{id}", puh.DeleteProxyUserHandler).Methods(http.MethodDelete, http.MethodOptions)
+
+	r.HandleFunc("/healthz", hh.LivenessHandler).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/readyz", hh.ReadinessHandler).Methods(http.MethodGet, http.MethodOptions)
+
+	// Requests outliving the shutdown timeout are cancelled through their base context
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+
+	server := newServer(cfg)
+	server.Addr = cfg.API.Addr
+	server.Handler = r
+	server.BaseContext = func(net.Listener) context.Context {
+		return baseCtx
+	}
+
+	err := serveUntilDone(ctx, shutdownCtx, server, func() error {
+		if cfg.API.TLSCert != "" {
+			log.Println("WebAPI is running on " + cfg.API.Addr + " with TLS")
+			return server.ListenAndServeTLS(cfg.API.TLSCert, cfg.API.TLSKey)
+		}
+
+		log.Println("WebAPI is running on " + cfg.API.Addr)
+		return server.ListenAndServe()
+	})
+	if err != nil {
+		log.Println("WebAPI failed to serve: ", err)
+		return
+	}
+
+	log.Println("WebAPI is stopped")
+}
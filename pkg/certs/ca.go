@@ -0,0 +1,124 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+const caCommonName = "burp_junior CA"
+
+const caValidity = 10 * 365 * 24 * time.Hour
+
+// GenerateCA creates a new self-signed CA certificate with an ECDSA key
+func GenerateCA() (ca *tls.Certificate, err error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %v", err)
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName: caCommonName,
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %v", err)
+	}
+
+	ca = &tls.Certificate{
+		Certificate: [][]byte{certBytes},
+		PrivateKey:  priv,
+		Leaf:        cert,
+	}
+
+	return
+}
+
+// WriteCA saves the CA certificate and its PKCS#8 key as PEM files, creating their directories
+func WriteCA(ca *tls.Certificate, certPath, keyPath string) (err error) {
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(ca.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %v", err)
+	}
+
+	for _, path := range []string{certPath, keyPath} {
+		err = os.MkdirAll(filepath.Dir(path), 0o700)
+		if err != nil {
+			return fmt.Errorf("failed to create CA directory: %v", err)
+		}
+	}
+
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}), 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write private key file: %v", err)
+	}
+
+	err = os.WriteFile(certPath, EncodeCertPEM(ca.Leaf), 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write CA certificate file: %v", err)
+	}
+
+	return
+}
+
+// LoadOrCreateCA reads the CA from its files, generating and saving a new one if they do not exist yet
+func LoadOrCreateCA(certPath, keyPath string) (ca *tls.Certificate, err error) {
+	_, certErr := os.Stat(certPath)
+	_, keyErr := os.Stat(keyPath)
+	if !errors.Is(certErr, os.ErrNotExist) || !errors.Is(keyErr, os.ErrNotExist) {
+		return GetCA(certPath, keyPath)
+	}
+
+	ca, err = GenerateCA()
+	if err != nil {
+		return
+	}
+
+	err = WriteCA(ca, certPath, keyPath)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func EncodeCertPEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// EncodeCertPKCS12 packs the certificate into a PKCS#12 trust store without a private key.
+// Legacy algorithms are used, since the file is meant to be imported on all kinds of devices.
+func EncodeCertPKCS12(cert *x509.Certificate, password string) ([]byte, error) {
+	return pkcs12.Legacy.EncodeTrustStore([]*x509.Certificate{cert}, password)
+}
@@ -0,0 +1,96 @@
+package certs
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// CertCache keeps forged leaf certificates per host for ttl, which must be shorter than their validity.
+// Concurrent requests for the same host wait for a single certificate to be signed.
+type CertCache struct {
+	mu      *sync.Mutex
+	ttl     time.Duration
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	ready   chan struct{}
+	cert    *tls.Certificate
+	err     error
+	expires time.Time
+}
+
+func NewCertCache(ttl time.Duration) *CertCache {
+	return &CertCache{
+		mu:      &sync.Mutex{},
+		ttl:     ttl,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+// Get returns the cached certificate of host or the one created by sign
+func (c *CertCache) Get(host string, sign func() (*tls.Certificate, error)) (cert *tls.Certificate, err error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	if !ok || now.After(entry.expires) {
+		c.removeExpired(now)
+
+		entry = &cacheEntry{
+			ready:   make(chan struct{}),
+			expires: now.Add(c.ttl),
+		}
+		c.entries[host] = entry
+		c.mu.Unlock()
+
+		entry.cert, entry.err = sign()
+		close(entry.ready)
+
+		// Failures are not cached, the next handshake signs again
+		if entry.err != nil {
+			c.mu.Lock()
+			if c.entries[host] == entry {
+				delete(c.entries, host)
+			}
+			c.mu.Unlock()
+		}
+	} else {
+		c.mu.Unlock()
+	}
+
+	<-entry.ready
+
+	return entry.cert, entry.err
+}
+
+// removeExpired must be called with mu held
+func (c *CertCache) removeExpired(now time.Time) {
+	for host, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, host)
+		}
+	}
+}
+
+// WildcardName returns the name of a wildcard certificate covering host, so a single
+// certificate serves all sibling subdomains. Registrable domains, IP literals and
+// hosts with an unknown suffix are returned unchanged.
+func WildcardName(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil || domain == host {
+		return host
+	}
+
+	// A wildcard matches a single label only
+	return "*." + host[strings.Index(host, ".")+1:]
+}
@@ -1,152 +1,220 @@
-package certs
-
-import (
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/tls"
-	"crypto/x509"
-	"crypto/x509/pkix"
-	"encoding/pem"
-	"fmt"
-	"log"
-	"math/big"
-	"os"
-	"time"
-)
-
-// ReadCACertificate reads the CA certificate from a file
-func ReadCACertificate(certPath string) (*x509.Certificate, error) {
-	certPEM, err := os.ReadFile(certPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CA certificate file: %v", err)
-	}
-
-	block, _ := pem.Decode(certPEM)
-	if block == nil || block.Type != "CERTIFICATE" {
-		return nil, fmt.Errorf("failed to decode PEM block containing the certificate")
-	}
-
-	cert, err := x509.ParseCertificate(block.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse CA certificate: %v", err)
-	}
-
-	return cert, nil
-}
-
-// ReadCAPrivateKey reads the CA private key from a file
-func ReadPrivateKey(keyPath string) (interface{}, error) {
-	keyPEM, err := os.ReadFile(keyPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read private key file: %v", err)
-	}
-
-	block, _ := pem.Decode(keyPEM)
-	if block == nil || block.Type != "PRIVATE KEY" {
-		return nil, fmt.Errorf("failed to decode PEM block containing the private key")
-	}
-
-	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
-	if err != nil {
-		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse private key: %v", err)
-		}
-	}
-
-	return key, nil
-}
-
-// CreateCertificateRequest creates a new certificate request
-func CreateCertificateRequest(name string) (*x509.CertificateRequest, *ecdsa.PrivateKey, error) {
-	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate private key: %v", err)
-	}
-
-	template := &x509.CertificateRequest{
-		Subject: pkix.Name{
-			CommonName: name,
-		},
-		DNSNames: []string{name},
-	}
-
-	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, template, priv)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create certificate request: %v", err)
-	}
-
-	csr, err := x509.ParseCertificateRequest(csrBytes)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse certificate request: %v", err)
-	}
-
-	return csr, priv, nil
-}
-
-// SignCertificate signs a certificate request using the CA certificate and private key
-func SignCertificate(caCert *x509.Certificate, caKey interface{}, csr *x509.CertificateRequest) ([]byte, error) {
-	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate serial number: %v", err)
-	}
-
-	template := &x509.Certificate{
-		SerialNumber: serialNumber,
-		Subject:      csr.Subject,
-		DNSNames:     csr.DNSNames,
-		NotBefore:    time.Now(),
-		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
-		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-	}
-
-	certBytes, err := x509.CreateCertificate(rand.Reader, template, caCert, csr.PublicKey, caKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create certificate: %v", err)
-	}
-
-	return certBytes, nil
-}
-
-func GetCA(certPath, keyPath string) (ca *tls.Certificate, err error) {
-	ca = new(tls.Certificate)
-	cert, err := ReadCACertificate(certPath)
-	if err != nil {
-		return
-	}
-
-	key, err := ReadPrivateKey(keyPath)
-	if err != nil {
-		return
-	}
-
-	ca = &tls.Certificate{
-		Certificate: [][]byte{cert.Raw},
-		PrivateKey:  key,
-		Leaf:        cert,
-	}
-
-	return
-}
-
-func SignTLSCert(host string, ca *tls.Certificate) (cert *tls.Certificate, err error) {
-	csr, priv, err := CreateCertificateRequest(host)
-	if err != nil {
-		return
-	}
-
-	certBytes, err := SignCertificate(ca.Leaf, ca.PrivateKey, csr)
-	if err != nil {
-		log.Println("sign", err)
-		return
-	}
-
-	cert = &tls.Certificate{
-		Certificate: [][]byte{certBytes},
-		PrivateKey:  priv,
-	}
-
-	return
-}
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// ReadCACertificate reads the CA certificate from a file
+func ReadCACertificate(certPath string) (*x509.Certificate, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate file: %v", err)
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("failed to decode PEM block containing the certificate")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %v", err)
+	}
+
+	return cert, nil
+}
+
+// ReadCAPrivateKey reads the CA private key from a file
+func ReadPrivateKey(keyPath string) (interface{}, error) {
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %v", err)
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("failed to decode PEM block containing the private key")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %v", err)
+		}
+	}
+
+	return key, nil
+}
+
+// CreateCertificateRequest creates a new certificate request.
+// IP literals are put in IP SANs, a wildcard name also covers its parent domain.
+func CreateCertificateRequest(name string) (*x509.CertificateRequest, *ecdsa.PrivateKey, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate private key: %v", err)
+	}
+
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName: name,
+		},
+	}
+
+	if ip := net.ParseIP(name); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{name}
+		if parent, ok := strings.CutPrefix(name, "*."); ok {
+			template.DNSNames = append(template.DNSNames, parent)
+		}
+	}
+
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, template, priv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate request: %v", err)
+	}
+
+	csr, err := x509.ParseCertificateRequest(csrBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse certificate request: %v", err)
+	}
+
+	return csr, priv, nil
+}
+
+// SignCertificate signs a certificate request using the CA certificate and private key
+func SignCertificate(caCert *x509.Certificate, caKey interface{}, csr *x509.CertificateRequest) ([]byte, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		IPAddresses:  csr.IPAddresses,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, caCert, csr.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %v", err)
+	}
+
+	return certBytes, nil
+}
+
+func GetCA(certPath, keyPath string) (ca *tls.Certificate, err error) {
+	ca = new(tls.Certificate)
+	cert, err := ReadCACertificate(certPath)
+	if err != nil {
+		return
+	}
+
+	key, err := ReadPrivateKey(keyPath)
+	if err != nil {
+		return
+	}
+
+	ca = &tls.Certificate{
+		Certificate: [][]byte{cert.Raw},
+		PrivateKey:  key,
+		Leaf:        cert,
+	}
+
+	return
+}
+
+func SignTLSCert(host string, ca *tls.Certificate) (cert *tls.Certificate, err error) {
+	csr, priv, err := CreateCertificateRequest(host)
+	if err != nil {
+		return
+	}
+
+	certBytes, err := SignCertificate(ca.Leaf, ca.PrivateKey, csr)
+	if err != nil {
+		log.Println("sign", err)
+		return
+	}
+
+	leaf, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return
+	}
+
+	cert = &tls.Certificate{
+		Certificate: [][]byte{certBytes},
+		PrivateKey:  priv,
+		Leaf:        leaf,
+	}
+
+	return
+}
+
+// MimicTLSCert signs a certificate with the subject, SANs, validity and extended key usages
+// of target, so clients inspecting the certificate see the same fields as without the proxy
+func MimicTLSCert(target *x509.Certificate, ca *tls.Certificate) (cert *tls.Certificate, err error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %v", err)
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+
+	extKeyUsage := target.ExtKeyUsage
+	if len(extKeyUsage) == 0 {
+		extKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:   serialNumber,
+		RawSubject:     target.RawSubject,
+		DNSNames:       target.DNSNames,
+		IPAddresses:    target.IPAddresses,
+		EmailAddresses: target.EmailAddresses,
+		URIs:           target.URIs,
+		NotBefore:      target.NotBefore,
+		NotAfter:       target.NotAfter,
+		KeyUsage:       x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    extKeyUsage,
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, ca.Leaf, &priv.PublicKey, ca.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return
+	}
+
+	cert = &tls.Certificate{
+		Certificate: [][]byte{certBytes},
+		PrivateKey:  priv,
+		Leaf:        leaf,
+	}
+
+	return
+}
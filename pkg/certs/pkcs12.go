@@ -0,0 +1,31 @@
+package certs
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// DecodePKCS12 extracts the certificate chain and the private key of a PKCS#12 file as PEM
+func DecodePKCS12(data []byte, password string) (certPEM []byte, keyPEM []byte, err error) {
+	key, cert, caCerts, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode pkcs12: %v", err)
+	}
+
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal private key: %v", err)
+	}
+
+	certPEM = EncodeCertPEM(cert)
+	for _, caCert := range caCerts {
+		certPEM = append(certPEM, EncodeCertPEM(caCert)...)
+	}
+
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})
+
+	return
+}
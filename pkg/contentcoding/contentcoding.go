@@ -0,0 +1,98 @@
+package contentcoding
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Decode undoes the codings listed in a Content-Encoding header, which are applied in order,
+// so they are removed from the last one. At most limit decoded bytes are kept, truncated
+// reports whether the decoded data is longer than that.
+func Decode(contentEncoding string, data []byte, limit int64) (decoded []byte, truncated bool, err error) {
+	codings := strings.Split(contentEncoding, ",")
+
+	// The codings are undone as a chain of readers, so only what is kept is ever decoded
+	var reader io.Reader = bytes.NewReader(data)
+	for i := len(codings) - 1; i >= 0; i-- {
+		var closer io.Closer
+		reader, closer, err = decoder(strings.ToLower(strings.TrimSpace(codings[i])), reader)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if closer != nil {
+			defer closer.Close()
+		}
+	}
+
+	decoded, err = io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if int64(len(decoded)) > limit {
+		decoded = decoded[:limit]
+		truncated = true
+	}
+
+	return
+}
+
+// decoder returns a reader undoing coding on r and, if it has to be released, its closer
+func decoder(coding string, r io.Reader) (reader io.Reader, closer io.Closer, err error) {
+	switch coding {
+	case "", "identity":
+		return r, nil, nil
+	case "gzip", "x-gzip":
+		gzipReader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return gzipReader, gzipReader, nil
+	case "deflate":
+		// "deflate" should be zlib-wrapped, but some servers send raw deflate data
+		buffered := bufio.NewReader(r)
+		header, _ := buffered.Peek(2)
+		if !isZlibHeader(header) {
+			flateReader := flate.NewReader(buffered)
+			return flateReader, flateReader, nil
+		}
+
+		zlibReader, err := zlib.NewReader(buffered)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return zlibReader, zlibReader, nil
+	case "br":
+		return brotli.NewReader(r), nil, nil
+	case "zstd":
+		zstdReader, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return zstdReader, zstdReader.IOReadCloser(), nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported content coding %q", coding)
+	}
+}
+
+// isZlibHeader reports whether header starts a zlib stream, as checked in RFC 1950
+func isZlibHeader(header []byte) bool {
+	if len(header) < 2 {
+		return false
+	}
+
+	return header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
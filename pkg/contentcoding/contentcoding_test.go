@@ -0,0 +1,168 @@
+package contentcoding
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// encode applies coding to data the way a server would
+func encode(t *testing.T, coding string, data []byte) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+
+	var w io.WriteCloser
+	switch coding {
+	case "gzip":
+		w = gzip.NewWriter(buf)
+	case "zlib":
+		w = zlib.NewWriter(buf)
+	case "flate":
+		w, _ = flate.NewWriter(buf, flate.DefaultCompression)
+	case "br":
+		w = brotli.NewWriter(buf)
+	case "zstd":
+		w, _ = zstd.NewWriter(buf)
+	default:
+		t.Fatalf("unknown coding %q", coding)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("encoding %s: %v", coding, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("encoding %s: %v", coding, err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	body := []byte(strings.Repeat("hello, world! ", 100))
+
+	tests := []struct {
+		name     string
+		encoding string
+		// codings applied to body in order
+		codings []string
+	}{
+		{name: "no encoding", encoding: ""},
+		{name: "identity", encoding: "identity"},
+		{name: "gzip", encoding: "gzip", codings: []string{"gzip"}},
+		{name: "x-gzip", encoding: "x-gzip", codings: []string{"gzip"}},
+		{name: "zlib deflate", encoding: "deflate", codings: []string{"zlib"}},
+		{name: "raw deflate", encoding: "deflate", codings: []string{"flate"}},
+		{name: "brotli", encoding: "br", codings: []string{"br"}},
+		{name: "zstd", encoding: "zstd", codings: []string{"zstd"}},
+		{name: "case and spaces", encoding: " GZIP ", codings: []string{"gzip"}},
+		{name: "stacked", encoding: "gzip, br", codings: []string{"gzip", "br"}},
+		{name: "stacked without spaces", encoding: "deflate,gzip", codings: []string{"flate", "gzip"}},
+		{name: "stacked three", encoding: "zstd, identity, deflate, br", codings: []string{"zstd", "zlib", "br"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := body
+			for _, coding := range tt.codings {
+				data = encode(t, coding, data)
+			}
+
+			decoded, truncated, err := Decode(tt.encoding, data, int64(len(body)))
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			if truncated {
+				t.Errorf("Decode() truncated = true, want false")
+			}
+
+			if !bytes.Equal(decoded, body) {
+				t.Errorf("Decode() = %q, want %q", decoded, body)
+			}
+		})
+	}
+}
+
+func TestDecodeLimit(t *testing.T) {
+	body := []byte("0123456789")
+	data := encode(t, "br", encode(t, "gzip", body))
+
+	tests := []struct {
+		limit         int64
+		want          []byte
+		wantTruncated bool
+	}{
+		{limit: 100, want: body},
+		{limit: 10, want: body},
+		{limit: 9, want: body[:9], wantTruncated: true},
+		{limit: 0, want: []byte{}, wantTruncated: true},
+	}
+
+	for _, tt := range tests {
+		decoded, truncated, err := Decode("gzip, br", data, tt.limit)
+		if err != nil {
+			t.Fatalf("Decode() limit %d error = %v", tt.limit, err)
+		}
+
+		if truncated != tt.wantTruncated {
+			t.Errorf("Decode() limit %d truncated = %v, want %v", tt.limit, truncated, tt.wantTruncated)
+		}
+
+		if !bytes.Equal(decoded, tt.want) {
+			t.Errorf("Decode() limit %d = %q, want %q", tt.limit, decoded, tt.want)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	gzipped := encode(t, "gzip", []byte("hello"))
+
+	tests := []struct {
+		name     string
+		encoding string
+		data     []byte
+	}{
+		{name: "unsupported coding", encoding: "compress", data: []byte("hello")},
+		{name: "unsupported stacked coding", encoding: "gzip, compress", data: gzipped},
+		{name: "not gzip", encoding: "gzip", data: []byte("hello")},
+		{name: "cut gzip", encoding: "gzip", data: gzipped[:len(gzipped)-4]},
+		{name: "codings listed in the wrong order", encoding: "br, gzip", data: encode(t, "br", gzipped)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Decode(tt.encoding, tt.data, 1<<20); err == nil {
+				t.Errorf("Decode() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestIsZlibHeader(t *testing.T) {
+	tests := []struct {
+		header []byte
+		want   bool
+	}{
+		{header: encode(t, "zlib", []byte("hello"))[:2], want: true},
+		{header: []byte{0x78, 0x01}, want: true},
+		{header: []byte{0x78, 0xda}, want: true},
+		{header: []byte{0x78, 0x00}, want: false},
+		{header: []byte{0x79, 0x9c}, want: false},
+		{header: []byte{0x78}, want: false},
+		{header: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isZlibHeader(tt.header); got != tt.want {
+			t.Errorf("isZlibHeader(%x) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
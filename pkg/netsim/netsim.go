@@ -0,0 +1,165 @@
+package netsim
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tick is the pacing interval of throttled writes
+const tick = 100 * time.Millisecond
+
+// delayQueueSize bounds the writes held back by a delay writer before Write blocks
+const delayQueueSize = 64
+
+type writer struct {
+	w         io.Writer
+	bandwidth int64
+}
+
+// NewWriter returns a writer that paces writes to w to bandwidth bytes per second,
+// or w itself if bandwidth is zero. Writes are flushed as they are paced when w is an http.Flusher.
+func NewWriter(w io.Writer, bandwidth int64) io.Writer {
+	if bandwidth <= 0 {
+		return w
+	}
+
+	return &writer{
+		w:         w,
+		bandwidth: bandwidth,
+	}
+}
+
+func (w *writer) Write(p []byte) (n int, err error) {
+	chunk := max(int(w.bandwidth*int64(tick)/int64(time.Second)), 1)
+	for len(p) > 0 {
+		part := p[:min(chunk, len(p))]
+		start := time.Now()
+
+		var written int
+		written, err = w.write(part)
+		n += written
+		if err != nil {
+			return
+		}
+
+		p = p[len(part):]
+		time.Sleep(time.Duration(int64(len(part))*int64(time.Second)/w.bandwidth) - time.Since(start))
+	}
+
+	return
+}
+
+func (w *writer) write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return
+}
+
+type delayedWrite struct {
+	at   time.Time
+	data []byte
+}
+
+type delayWriter struct {
+	w       io.Writer
+	latency time.Duration
+	queue   chan delayedWrite
+	done    chan struct{}
+	mu      *sync.Mutex
+	err     error
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// NewDelayWriter returns a writer passing every write on to w latency after it was made,
+// without holding back the writes that follow it, as a link with that latency would.
+// Errors of w are returned by later calls. Close waits for the delayed writes to finish.
+func NewDelayWriter(w io.Writer, latency time.Duration) io.WriteCloser {
+	if latency <= 0 {
+		return nopCloser{w}
+	}
+
+	d := &delayWriter{
+		w:       w,
+		latency: latency,
+		queue:   make(chan delayedWrite, delayQueueSize),
+		done:    make(chan struct{}),
+		mu:      &sync.Mutex{},
+	}
+
+	go d.run()
+
+	return d
+}
+
+func (d *delayWriter) run() {
+	defer close(d.done)
+
+	for write := range d.queue {
+		if d.failed() != nil {
+			continue
+		}
+
+		time.Sleep(time.Until(write.at))
+		if _, err := d.w.Write(write.data); err != nil {
+			d.mu.Lock()
+			d.err = err
+			d.mu.Unlock()
+		}
+	}
+}
+
+func (d *delayWriter) failed() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.err
+}
+
+func (d *delayWriter) Write(p []byte) (n int, err error) {
+	if err = d.failed(); err != nil {
+		return
+	}
+
+	d.queue <- delayedWrite{at: time.Now().Add(d.latency), data: bytes.Clone(p)}
+
+	return len(p), nil
+}
+
+func (d *delayWriter) Close() error {
+	close(d.queue)
+	<-d.done
+
+	return d.failed()
+}
+
+// Sleep waits for d or until ctx is done, whichever comes first
+func Sleep(ctx context.Context, d time.Duration) (err error) {
+	if d <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	return
+}
@@ -0,0 +1,96 @@
+// Package searchwords splits text into the words exchanges are indexed and found by.
+// A word is a run of letters, digits, marks and underscores, compared in lower case.
+package searchwords
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxWordLength bounds the words that are indexed in bytes, longer ones are left out
+const MaxWordLength = 64
+
+// IsWordRune reports whether r is part of words
+func IsWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r)
+}
+
+// Words returns the words of text in lower case, in order and with repeats
+func Words(text string) (words []string) {
+	each([]byte(text), func(word string) bool {
+		words = append(words, word)
+		return true
+	})
+
+	return
+}
+
+// Set gathers the distinct words of texts, up to a limit
+type Set struct {
+	seen  map[string]struct{}
+	words []string
+	limit int
+}
+
+func NewSet(limit int) *Set {
+	return &Set{
+		seen:  make(map[string]struct{}),
+		words: make([]string, 0),
+		limit: limit,
+	}
+}
+
+// Add adds the words of text until the set is full. It stops at the first invalid UTF-8
+// sequence, so binary data adds no words past it.
+func (s *Set) Add(text []byte) {
+	each(text, func(word string) bool {
+		if len(s.words) == s.limit {
+			return false
+		}
+
+		if _, ok := s.seen[word]; !ok {
+			s.seen[word] = struct{}{}
+			s.words = append(s.words, word)
+		}
+
+		return true
+	})
+}
+
+// Words returns the words of the set in the order they were added
+func (s *Set) Words() []string {
+	return s.words
+}
+
+// each calls fn with every word of text up to MaxWordLength until it returns false
+func each(text []byte, fn func(word string) bool) {
+	start := -1
+	for i := 0; i <= len(text); {
+		r, size := utf8.RuneError, 0
+		if i < len(text) {
+			r, size = utf8.DecodeRune(text[i:])
+		}
+
+		invalid := r == utf8.RuneError && size == 1
+		if i < len(text) && !invalid && IsWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			i += size
+			continue
+		}
+
+		if start >= 0 && i-start <= MaxWordLength {
+			if !fn(strings.ToLower(string(text[start:i]))) {
+				return
+			}
+		}
+		start = -1
+
+		if i == len(text) || invalid {
+			return
+		}
+		i += size
+	}
+}
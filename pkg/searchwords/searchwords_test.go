@@ -0,0 +1,96 @@
+package searchwords
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "punctuation separates words",
+			text: "GET /api/v1/users?id=42&Token=ab_c",
+			want: []string{"get", "api", "v1", "users", "id", "42", "token", "ab_c"},
+		},
+		{
+			name: "repeats are kept",
+			text: "a a",
+			want: []string{"a", "a"},
+		},
+		{
+			name: "letters of other scripts are words",
+			text: "Привет, мир",
+			want: []string{"привет", "мир"},
+		},
+		{
+			name: "too long words are left out",
+			text: "x " + strings.Repeat("y", MaxWordLength+1) + " " + strings.Repeat("z", MaxWordLength),
+			want: []string{"x", strings.Repeat("z", MaxWordLength)},
+		},
+		{
+			name: "no words",
+			text: "== --",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Words(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("Words() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		texts []string
+		want  []string
+	}{
+		{
+			name:  "distinct words in the order added",
+			limit: 10,
+			texts: []string{"b A", "a c B"},
+			want:  []string{"b", "a", "c"},
+		},
+		{
+			name:  "full set takes no more words",
+			limit: 2,
+			texts: []string{"a b", "c"},
+			want:  []string{"a", "b"},
+		},
+		{
+			name:  "binary data stops at the first invalid byte",
+			limit: 10,
+			texts: []string{"ab cd\xffef gh"},
+			want:  []string{"ab", "cd"},
+		},
+		{
+			name:  "empty set",
+			limit: 10,
+			texts: []string{""},
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := NewSet(tt.limit)
+			for _, text := range tt.texts {
+				set.Add([]byte(text))
+			}
+
+			if got := set.Words(); !slices.Equal(got, tt.want) {
+				t.Errorf("Words() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
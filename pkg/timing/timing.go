@@ -0,0 +1,112 @@
+package timing
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/burp_junior/domain"
+)
+
+// Recorder measures the phases of an exchange. Connection phases are reported by the
+// httptrace hooks of its context, so they are recorded both by http.Transport and by
+// plain dials made with that context. TTFB and Total are counted from Start, once
+// the connection is ready and the request is about to be written, so they never
+// include the connection phases, however the exchange was sent.
+type Recorder struct {
+	mu           *sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	timing       domain.Timing
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{
+		mu:    &sync.Mutex{},
+		start: time.Now(),
+	}
+}
+
+// Start marks the request being written, keeping the connection phases recorded so far.
+// http.Transport calls it through the context of the recorder, plain connections have
+// to call it themselves.
+func (r *Recorder) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.start = time.Now()
+}
+
+// WithContext returns ctx reporting connection phases and the first response byte to r
+func (r *Recorder) WithContext(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			r.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			r.timing.DNS = time.Since(r.dnsStart)
+		},
+		// Dual-stack targets may be dialed several times in parallel,
+		// the phase lasts from the first attempt to the last finished one
+		ConnectStart: func(network, addr string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			if r.connectStart.IsZero() {
+				r.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			r.timing.Connect = time.Since(r.connectStart)
+		},
+		TLSHandshakeStart: func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			r.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			r.timing.TLSHandshake = time.Since(r.tlsStart)
+		},
+		GotConn: func(httptrace.GotConnInfo) {
+			r.Start()
+		},
+		GotFirstResponseByte: r.GotFirstResponseByte,
+	})
+}
+
+func (r *Recorder) GotFirstResponseByte() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.timing.TTFB = time.Since(r.start)
+}
+
+// Finish ends the exchange and returns its timing
+func (r *Recorder) Finish(requestSize, responseSize int64) *domain.Timing {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	timing := r.timing
+	timing.Total = time.Since(r.start)
+	timing.RequestSize = requestSize
+	timing.ResponseSize = responseSize
+
+	return &timing
+}
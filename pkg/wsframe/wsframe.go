@@ -0,0 +1,158 @@
+package wsframe
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+// MaxPayloadSize limits the size of a single frame read from the wire
+const MaxPayloadSize = 32 << 20
+
+// Frame is a single WebSocket frame (RFC 6455, section 5.2). Payload is always stored unmasked.
+type Frame struct {
+	Fin     bool
+	Rsv     byte
+	Opcode  byte
+	Masked  bool
+	MaskKey [4]byte
+	Payload []byte
+}
+
+func (f *Frame) IsControl() bool {
+	return f.Opcode&0x8 != 0
+}
+
+// NewMaskedFrame creates a final frame with a random mask key, as required for frames sent by clients
+func NewMaskedFrame(opcode byte, payload []byte) (f *Frame, err error) {
+	f = &Frame{
+		Fin:     true,
+		Opcode:  opcode,
+		Masked:  true,
+		Payload: payload,
+	}
+
+	_, err = rand.Read(f.MaskKey[:])
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func ReadFrame(r io.Reader) (f *Frame, err error) {
+	header := make([]byte, 2)
+	_, err = io.ReadFull(r, header)
+	if err != nil {
+		return
+	}
+
+	f = &Frame{
+		Fin:    header[0]&0x80 != 0,
+		Rsv:    (header[0] >> 4) & 0x7,
+		Opcode: header[0] & 0xF,
+		Masked: header[1]&0x80 != 0,
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		_, err = io.ReadFull(r, ext)
+		if err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		_, err = io.ReadFull(r, ext)
+		if err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+
+	if length > MaxPayloadSize {
+		err = fmt.Errorf("websocket frame of %d bytes exceeds limit", length)
+		return
+	}
+
+	if f.Masked {
+		_, err = io.ReadFull(r, f.MaskKey[:])
+		if err != nil {
+			return
+		}
+	}
+
+	f.Payload = make([]byte, length)
+	_, err = io.ReadFull(r, f.Payload)
+	if err != nil {
+		return
+	}
+
+	if f.Masked {
+		mask(f.Payload, f.MaskKey)
+	}
+
+	return
+}
+
+func WriteFrame(w io.Writer, f *Frame) (err error) {
+	buf := make([]byte, 0, 14+len(f.Payload))
+
+	b0 := f.Rsv<<4 | f.Opcode&0xF
+	if f.Fin {
+		b0 |= 0x80
+	}
+
+	var b1 byte
+	if f.Masked {
+		b1 = 0x80
+	}
+
+	length := len(f.Payload)
+	switch {
+	case length < 126:
+		buf = append(buf, b0, b1|byte(length))
+	case length <= 0xFFFF:
+		buf = append(buf, b0, b1|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(length))
+	default:
+		buf = append(buf, b0, b1|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(length))
+	}
+
+	payloadStart := len(buf)
+	if f.Masked {
+		buf = append(buf, f.MaskKey[:]...)
+		payloadStart += 4
+	}
+
+	buf = append(buf, f.Payload...)
+	if f.Masked {
+		mask(buf[payloadStart:], f.MaskKey)
+	}
+
+	_, err = w.Write(buf)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func mask(payload []byte, key [4]byte) {
+	for i := range payload {
+		payload[i] ^= key[i%4]
+	}
+}
@@ -0,0 +1,108 @@
+package ca
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"sync"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/certs"
+)
+
+// CAService owns the CA forged certificates are signed with. The CA is generated
+// on first start and kept in certPath and keyPath, so it survives restarts.
+type CAService struct {
+	mu       *sync.RWMutex
+	certPath string
+	keyPath  string
+	ca       *tls.Certificate
+}
+
+func NewCAService(certPath, keyPath string) (s *CAService, err error) {
+	s = &CAService{
+		mu:       &sync.RWMutex{},
+		certPath: certPath,
+		keyPath:  keyPath,
+	}
+
+	s.ca, err = certs.LoadOrCreateCA(certPath, keyPath)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (s *CAService) GetCA() *tls.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.ca
+}
+
+// RotateCA replaces the CA with a newly generated one. Clients have to install the new
+// certificate, since certificates forged from now on are signed by it.
+func (s *CAService) RotateCA(ctx context.Context) (err error) {
+	newCA, err := certs.GenerateCA()
+	if err != nil {
+		log.Println("error generating ca: ", err)
+		err = customerrors.ErrInternal
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = certs.WriteCA(newCA, s.certPath, s.keyPath)
+	if err != nil {
+		log.Println("error writing ca: ", err)
+		err = customerrors.ErrInternal
+		return
+	}
+
+	s.ca = newCA
+
+	return
+}
+
+// ExportCA encodes the CA certificate in format, password only protects PKCS#12 files
+func (s *CAService) ExportCA(ctx context.Context, format string, password string) (export *domain.CAExport, err error) {
+	cert := s.GetCA().Leaf
+
+	switch format {
+	case domain.CAFormatPEM:
+		export = &domain.CAExport{
+			Data:        certs.EncodeCertPEM(cert),
+			ContentType: "application/x-pem-file",
+			FileName:    "burp_junior_ca.pem",
+		}
+	case domain.CAFormatDER:
+		// This content type makes mobile browsers offer to install the certificate
+		export = &domain.CAExport{
+			Data:        cert.Raw,
+			ContentType: "application/x-x509-ca-cert",
+			FileName:    "burp_junior_ca.der",
+		}
+	case domain.CAFormatPKCS12:
+		var data []byte
+		data, err = certs.EncodeCertPKCS12(cert, password)
+		if err != nil {
+			log.Println("error encoding ca: ", err)
+			err = customerrors.ErrInternal
+			return
+		}
+
+		export = &domain.CAExport{
+			Data:        data,
+			ContentType: "application/x-pkcs12",
+			FileName:    "burp_junior_ca.p12",
+		}
+	default:
+		err = customerrors.ErrInvalidRequest
+		return
+	}
+
+	return
+}
@@ -0,0 +1,179 @@
+package clientcert
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/certs"
+)
+
+type ClientCertificatesStorage interface {
+	SaveClientCertificate(ctx context.Context, cert *domain.ClientCertificate) (savedCert *domain.ClientCertificate, err error)
+	GetClientCertificatesList(ctx context.Context) (certs []*domain.ClientCertificate, err error)
+	DeleteClientCertificate(ctx context.Context, id string) (err error)
+}
+
+type loadedCert struct {
+	hostPattern string
+	cert        *tls.Certificate
+}
+
+// ClientCertService manages client certificates for targets requiring mutual TLS.
+// Certificates are kept parsed in memory and reloaded after every change.
+type ClientCertService struct {
+	mu    *sync.RWMutex
+	certS ClientCertificatesStorage
+	certs []*loadedCert
+}
+
+func NewClientCertService(ctx context.Context, certS ClientCertificatesStorage) (s *ClientCertService, err error) {
+	s = &ClientCertService{
+		mu:    &sync.RWMutex{},
+		certS: certS,
+	}
+
+	err = s.reload(ctx)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func loadCert(clientCert *domain.ClientCertificate) (c *loadedCert, err error) {
+	cert, err := tls.X509KeyPair([]byte(clientCert.CertPEM), []byte(clientCert.KeyPEM))
+	if err != nil {
+		err = customerrors.ErrInvalidRequest
+		return
+	}
+
+	c = &loadedCert{
+		hostPattern: strings.ToLower(clientCert.HostPattern),
+		cert:        &cert,
+	}
+
+	return
+}
+
+func (s *ClientCertService) reload(ctx context.Context) (err error) {
+	clientCerts, err := s.certS.GetClientCertificatesList(ctx)
+	if err != nil {
+		return
+	}
+
+	loaded := make([]*loadedCert, 0, len(clientCerts))
+	for _, clientCert := range clientCerts {
+		c, err := loadCert(clientCert)
+		if err != nil {
+			log.Println("skipping invalid client certificate ", clientCert.ID, ": ", err)
+			continue
+		}
+
+		loaded = append(loaded, c)
+	}
+
+	s.mu.Lock()
+	s.certs = loaded
+	s.mu.Unlock()
+
+	return
+}
+
+// GetClientCertificatesList returns the certificates without their private keys
+func (s *ClientCertService) GetClientCertificatesList(ctx context.Context) (clientCerts []*domain.ClientCertificate, err error) {
+	clientCerts, err = s.certS.GetClientCertificatesList(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, clientCert := range clientCerts {
+		clientCert.KeyPEM = ""
+	}
+
+	return
+}
+
+func (s *ClientCertService) CreateClientCertificate(ctx context.Context, upload *domain.ClientCertificateUpload) (savedCert *domain.ClientCertificate, err error) {
+	if _, err = path.Match(upload.HostPattern, ""); err != nil {
+		err = customerrors.ErrInvalidRequest
+		return
+	}
+
+	clientCert := &domain.ClientCertificate{
+		HostPattern: upload.HostPattern,
+		CertPEM:     upload.CertPEM,
+		KeyPEM:      upload.KeyPEM,
+	}
+
+	if len(upload.PKCS12) > 0 {
+		certPEM, keyPEM, err := certs.DecodePKCS12(upload.PKCS12, upload.Password)
+		if err != nil {
+			log.Println("error decoding client certificate: ", err)
+			return nil, customerrors.ErrInvalidRequest
+		}
+
+		clientCert.CertPEM = string(certPEM)
+		clientCert.KeyPEM = string(keyPEM)
+	}
+
+	c, err := loadCert(clientCert)
+	if err != nil {
+		return
+	}
+
+	clientCert.Subject = c.cert.Leaf.Subject.String()
+	clientCert.NotAfter = c.cert.Leaf.NotAfter
+
+	savedCert, err = s.certS.SaveClientCertificate(ctx, clientCert)
+	if err != nil {
+		return
+	}
+
+	err = s.reload(ctx)
+	if err != nil {
+		return
+	}
+
+	savedCert.KeyPEM = ""
+
+	return
+}
+
+func (s *ClientCertService) DeleteClientCertificate(ctx context.Context, id string) (err error) {
+	err = s.certS.DeleteClientCertificate(ctx, id)
+	if err != nil {
+		return
+	}
+
+	err = s.reload(ctx)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// GetClientCertificate returns the first certificate configured for host, or nil if there is none
+func (s *ClientCertService) GetClientCertificate(host string) *tls.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	host = strings.ToLower(host)
+	for _, c := range s.certs {
+		if c.hostPattern == "" {
+			return c.cert
+		}
+
+		if ok, _ := path.Match(c.hostPattern, host); ok {
+			return c.cert
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package health
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+
+	"github.com/burp_junior/customerrors"
+)
+
+type StoragePinger interface {
+	Ping(ctx context.Context) (err error)
+}
+
+// HealthService reports whether the application is alive and ready to take traffic
+type HealthService struct {
+	storage      StoragePinger
+	shuttingDown *atomic.Bool
+}
+
+func NewHealthService(storage StoragePinger) *HealthService {
+	return &HealthService{
+		storage:      storage,
+		shuttingDown: &atomic.Bool{},
+	}
+}
+
+// Live reports whether the process is able to serve at all, it fails only if it hangs
+func (s *HealthService) Live(ctx context.Context) (err error) {
+	return
+}
+
+// Ready reports whether traffic can be routed to the application: the storage is
+// reachable and shutdown has not started
+func (s *HealthService) Ready(ctx context.Context) (err error) {
+	if s.shuttingDown.Load() {
+		return customerrors.ErrNotReady
+	}
+
+	err = s.storage.Ping(ctx)
+	if err != nil {
+		log.Println("storage ping err:", err)
+		return customerrors.ErrNotReady
+	}
+
+	return
+}
+
+// SetShuttingDown makes the application report not ready from now on
+func (s *HealthService) SetShuttingDown() {
+	s.shuttingDown.Store(true)
+}
@@ -0,0 +1,246 @@
+package intercept
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+)
+
+type decision struct {
+	drop     bool
+	request  *domain.HTTPRequest
+	response *domain.HTTPResponse
+}
+
+type pendingMessage struct {
+	msg      *domain.InterceptedMessage
+	decision chan decision
+}
+
+// InterceptService holds proxied requests and responses until they are
+// forwarded or dropped through the API.
+type InterceptService struct {
+	mu       *sync.RWMutex
+	settings domain.InterceptSettings
+	pending  map[string]*pendingMessage
+	lastID   int
+}
+
+func NewInterceptService() *InterceptService {
+	return &InterceptService{
+		mu:      &sync.RWMutex{},
+		pending: make(map[string]*pendingMessage),
+	}
+}
+
+func (s *InterceptService) GetInterceptSettings(ctx context.Context) (settings *domain.InterceptSettings, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	settings = &domain.InterceptSettings{
+		Enabled:            s.settings.Enabled,
+		HostPatterns:       append([]string{}, s.settings.HostPatterns...),
+		InterceptResponses: s.settings.InterceptResponses,
+	}
+
+	return
+}
+
+// SetInterceptSettings replaces current settings. Switching intercept off
+// releases every held message unchanged.
+func (s *InterceptService) SetInterceptSettings(ctx context.Context, settings *domain.InterceptSettings) (err error) {
+	for _, pattern := range settings.HostPatterns {
+		if _, err = path.Match(pattern, ""); err != nil {
+			err = customerrors.ErrInvalidRequest
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settings = *settings
+
+	if !s.settings.Enabled {
+		for id, p := range s.pending {
+			p.decision <- decision{}
+			delete(s.pending, id)
+		}
+	}
+
+	return
+}
+
+func (s *InterceptService) GetInterceptedList(ctx context.Context) (msgs []*domain.InterceptedMessage, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	msgs = make([]*domain.InterceptedMessage, 0, len(s.pending))
+	for _, p := range s.pending {
+		msgs = append(msgs, p.msg)
+	}
+
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].CreatedAt.Before(msgs[j].CreatedAt)
+	})
+
+	return
+}
+
+func (s *InterceptService) GetInterceptedByID(ctx context.Context, id string) (msg *domain.InterceptedMessage, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.pending[id]
+	if !ok {
+		err = customerrors.ErrNotFound
+		return
+	}
+
+	msg = p.msg
+
+	return
+}
+
+// ForwardIntercepted releases the message with the given ID. If edited carries
+// a request (or a response, for the response stage), it replaces the held one.
+func (s *InterceptService) ForwardIntercepted(ctx context.Context, id string, edited *domain.InterceptedMessage) (err error) {
+	p, err := s.release(id)
+	if err != nil {
+		return
+	}
+
+	d := decision{}
+	if edited != nil {
+		d.request = edited.Request
+		d.response = edited.Response
+	}
+
+	p.decision <- d
+
+	return
+}
+
+func (s *InterceptService) DropIntercepted(ctx context.Context, id string) (err error) {
+	p, err := s.release(id)
+	if err != nil {
+		return
+	}
+
+	p.decision <- decision{drop: true}
+
+	return
+}
+
+// InterceptRequest blocks until the request is forwarded or dropped if it matches
+// intercept settings. intercepted is false when the request was passed through untouched.
+func (s *InterceptService) InterceptRequest(ctx context.Context, req *domain.HTTPRequest) (forwarded *domain.HTTPRequest, intercepted bool, err error) {
+	forwarded = req
+
+	if !s.shouldIntercept(req, false) {
+		return
+	}
+
+	d, err := s.hold(ctx, &domain.InterceptedMessage{
+		Stage:   domain.InterceptStageRequest,
+		Request: req,
+	})
+	if err != nil {
+		return
+	}
+
+	intercepted = true
+
+	if d.request != nil {
+		forwarded = d.request
+	}
+
+	return
+}
+
+// InterceptResponse is the response stage counterpart of InterceptRequest.
+func (s *InterceptService) InterceptResponse(ctx context.Context, req *domain.HTTPRequest, res *domain.HTTPResponse) (forwarded *domain.HTTPResponse, intercepted bool, err error) {
+	forwarded = res
+
+	if !s.shouldIntercept(req, true) {
+		return
+	}
+
+	d, err := s.hold(ctx, &domain.InterceptedMessage{
+		Stage:    domain.InterceptStageResponse,
+		Request:  req,
+		Response: res,
+	})
+	if err != nil {
+		return
+	}
+
+	intercepted = true
+
+	if d.response != nil {
+		forwarded = d.response
+	}
+
+	return
+}
+
+func (s *InterceptService) shouldIntercept(req *domain.HTTPRequest, response bool) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.settings.Enabled || (response && !s.settings.InterceptResponses) {
+		return false
+	}
+
+	return s.settings.MatchesHost(req.Host)
+}
+
+func (s *InterceptService) hold(ctx context.Context, msg *domain.InterceptedMessage) (d decision, err error) {
+	p := &pendingMessage{
+		msg:      msg,
+		decision: make(chan decision, 1),
+	}
+
+	s.mu.Lock()
+	s.lastID++
+	msg.ID = strconv.Itoa(s.lastID)
+	msg.CreatedAt = time.Now()
+	s.pending[msg.ID] = p
+	s.mu.Unlock()
+
+	select {
+	case d = <-p.decision:
+	case <-ctx.Done():
+		s.release(msg.ID)
+		err = ctx.Err()
+		return
+	}
+
+	if d.drop {
+		err = customerrors.ErrRequestDropped
+		return
+	}
+
+	return
+}
+
+func (s *InterceptService) release(id string) (p *pendingMessage, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.pending[id]
+	if !ok {
+		err = customerrors.ErrNotFound
+		return
+	}
+
+	delete(s.pending, id)
+
+	return
+}
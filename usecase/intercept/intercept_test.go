@@ -0,0 +1,205 @@
+package intercept
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+)
+
+// waitHeld returns the ID of the only held message once there is one
+func waitHeld(t *testing.T, s *InterceptService) string {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		msgs, _ := s.GetInterceptedList(context.Background())
+		if len(msgs) == 1 {
+			return msgs[0].ID
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatal("no message was held")
+	return ""
+}
+
+func TestInterceptRequest(t *testing.T) {
+	edited := &domain.HTTPRequest{Host: "example.com", Path: "/edited"}
+
+	tests := []struct {
+		name            string
+		settings        domain.InterceptSettings
+		release         func(s *InterceptService, id string, cancel context.CancelFunc)
+		want            *domain.HTTPRequest
+		wantIntercepted bool
+		wantErr         error
+	}{
+		{
+			name:     "disabled intercept passes requests through",
+			settings: domain.InterceptSettings{},
+			want:     &domain.HTTPRequest{Host: "example.com", Path: "/"},
+		},
+		{
+			name:     "hosts out of the patterns pass through",
+			settings: domain.InterceptSettings{Enabled: true, HostPatterns: []string{"*.test"}},
+			want:     &domain.HTTPRequest{Host: "example.com", Path: "/"},
+		},
+		{
+			name:     "forwarded unchanged",
+			settings: domain.InterceptSettings{Enabled: true, HostPatterns: []string{"*.com"}},
+			release: func(s *InterceptService, id string, cancel context.CancelFunc) {
+				s.ForwardIntercepted(context.Background(), id, nil)
+			},
+			want:            &domain.HTTPRequest{Host: "example.com", Path: "/"},
+			wantIntercepted: true,
+		},
+		{
+			name:     "forwarded edited",
+			settings: domain.InterceptSettings{Enabled: true},
+			release: func(s *InterceptService, id string, cancel context.CancelFunc) {
+				s.ForwardIntercepted(context.Background(), id, &domain.InterceptedMessage{Request: edited})
+			},
+			want:            edited,
+			wantIntercepted: true,
+		},
+		{
+			name:     "dropped",
+			settings: domain.InterceptSettings{Enabled: true},
+			release: func(s *InterceptService, id string, cancel context.CancelFunc) {
+				s.DropIntercepted(context.Background(), id)
+			},
+			want:    &domain.HTTPRequest{Host: "example.com", Path: "/"},
+			wantErr: customerrors.ErrRequestDropped,
+		},
+		{
+			name:     "switching intercept off releases it unchanged",
+			settings: domain.InterceptSettings{Enabled: true},
+			release: func(s *InterceptService, id string, cancel context.CancelFunc) {
+				s.SetInterceptSettings(context.Background(), &domain.InterceptSettings{})
+			},
+			want:            &domain.HTTPRequest{Host: "example.com", Path: "/"},
+			wantIntercepted: true,
+		},
+		{
+			name:     "released on shutdown",
+			settings: domain.InterceptSettings{Enabled: true},
+			release: func(s *InterceptService, id string, cancel context.CancelFunc) {
+				cancel()
+			},
+			want:    &domain.HTTPRequest{Host: "example.com", Path: "/"},
+			wantErr: context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewInterceptService()
+			err := s.SetInterceptSettings(context.Background(), &tt.settings)
+			if err != nil {
+				t.Fatalf("SetInterceptSettings() error = %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			type result struct {
+				forwarded   *domain.HTTPRequest
+				intercepted bool
+				err         error
+			}
+			results := make(chan result, 1)
+			go func() {
+				forwarded, intercepted, err := s.InterceptRequest(ctx, &domain.HTTPRequest{Host: "example.com", Path: "/"})
+				results <- result{forwarded, intercepted, err}
+			}()
+
+			if tt.release != nil {
+				id := waitHeld(t, s)
+				tt.release(s, id, cancel)
+			}
+
+			var got result
+			select {
+			case got = <-results:
+			case <-time.After(time.Second):
+				t.Fatal("the request is still held")
+			}
+
+			if !errors.Is(got.err, tt.wantErr) {
+				t.Fatalf("InterceptRequest() error = %v, want %v", got.err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && (got.forwarded.Path != tt.want.Path || got.intercepted != tt.wantIntercepted) {
+				t.Errorf("InterceptRequest() = %+v, %v, want %+v, %v", got.forwarded, got.intercepted, tt.want, tt.wantIntercepted)
+			}
+
+			// Nothing is left held once the request goes on
+			if msgs, _ := s.GetInterceptedList(context.Background()); len(msgs) != 0 {
+				t.Errorf("%d messages are still held", len(msgs))
+			}
+		})
+	}
+}
+
+func TestInterceptResponse(t *testing.T) {
+	req := &domain.HTTPRequest{Host: "example.com"}
+	res := &domain.HTTPResponse{Code: 200}
+
+	s := NewInterceptService()
+	s.SetInterceptSettings(context.Background(), &domain.InterceptSettings{Enabled: true})
+
+	// Responses are only held when asked for
+	forwarded, intercepted, err := s.InterceptResponse(context.Background(), req, res)
+	if err != nil || intercepted || forwarded != res {
+		t.Fatalf("InterceptResponse() = %+v, %v, %v, want the response passed through", forwarded, intercepted, err)
+	}
+
+	s.SetInterceptSettings(context.Background(), &domain.InterceptSettings{Enabled: true, InterceptResponses: true})
+
+	type result struct {
+		forwarded   *domain.HTTPResponse
+		intercepted bool
+		err         error
+	}
+	results := make(chan result, 1)
+	go func() {
+		forwarded, intercepted, err := s.InterceptResponse(context.Background(), req, res)
+		results <- result{forwarded, intercepted, err}
+	}()
+
+	id := waitHeld(t, s)
+
+	msg, err := s.GetInterceptedByID(context.Background(), id)
+	if err != nil || msg.Stage != domain.InterceptStageResponse || msg.Request != req || msg.Response != res {
+		t.Errorf("GetInterceptedByID() = %+v, %v", msg, err)
+	}
+
+	edited := &domain.HTTPResponse{Code: 404}
+	s.ForwardIntercepted(context.Background(), id, &domain.InterceptedMessage{Response: edited})
+
+	got := <-results
+	if got.err != nil || !got.intercepted || got.forwarded != edited {
+		t.Errorf("InterceptResponse() = %+v, %v, %v, want the edited response", got.forwarded, got.intercepted, got.err)
+	}
+}
+
+func TestInterceptErrors(t *testing.T) {
+	s := NewInterceptService()
+
+	if err := s.ForwardIntercepted(context.Background(), "1", nil); !errors.Is(err, customerrors.ErrNotFound) {
+		t.Errorf("ForwardIntercepted() error = %v, want %v", err, customerrors.ErrNotFound)
+	}
+
+	if err := s.DropIntercepted(context.Background(), "1"); !errors.Is(err, customerrors.ErrNotFound) {
+		t.Errorf("DropIntercepted() error = %v, want %v", err, customerrors.ErrNotFound)
+	}
+
+	err := s.SetInterceptSettings(context.Background(), &domain.InterceptSettings{HostPatterns: []string{"["}})
+	if !errors.Is(err, customerrors.ErrInvalidRequest) {
+		t.Errorf("SetInterceptSettings() error = %v, want %v", err, customerrors.ErrInvalidRequest)
+	}
+}
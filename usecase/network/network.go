@@ -0,0 +1,125 @@
+package network
+
+import (
+	"context"
+	"math/rand/v2"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+)
+
+type NetworkProfileStorage interface {
+	GetNetworkProfileSettings(ctx context.Context) (settings *domain.NetworkProfileSettings, err error)
+	SaveNetworkProfileSettings(ctx context.Context, settings *domain.NetworkProfileSettings) (err error)
+}
+
+// NetworkService picks the network conditions simulated for proxied hosts
+type NetworkService struct {
+	mu       *sync.RWMutex
+	profileS NetworkProfileStorage
+	settings *domain.NetworkProfileSettings
+}
+
+func NewNetworkService(ctx context.Context, profileS NetworkProfileStorage) (s *NetworkService, err error) {
+	s = &NetworkService{
+		mu:       &sync.RWMutex{},
+		profileS: profileS,
+	}
+
+	s.settings, err = profileS.GetNetworkProfileSettings(ctx)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func validateSettings(settings *domain.NetworkProfileSettings) (err error) {
+	for _, p := range settings.Profiles {
+		if _, err = path.Match(p.HostPattern, ""); err != nil {
+			return customerrors.ErrInvalidRequest
+		}
+
+		if p.Bandwidth < 0 || p.Latency < 0 {
+			return customerrors.ErrInvalidRequest
+		}
+
+		for _, rate := range []float64{p.DropRate, p.ResetRate, p.ErrorRate} {
+			if rate < 0 || rate > 1 {
+				return customerrors.ErrInvalidRequest
+			}
+		}
+
+		if p.DropRate+p.ResetRate+p.ErrorRate > 1 {
+			return customerrors.ErrInvalidRequest
+		}
+
+		if p.ErrorCode != 0 && (p.ErrorCode < 500 || p.ErrorCode > 599) {
+			return customerrors.ErrInvalidRequest
+		}
+	}
+
+	return
+}
+
+func (s *NetworkService) GetNetworkProfileSettings(ctx context.Context) (settings *domain.NetworkProfileSettings, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	settings = s.settings
+
+	return
+}
+
+func (s *NetworkService) SetNetworkProfileSettings(ctx context.Context, settings *domain.NetworkProfileSettings) (err error) {
+	err = validateSettings(settings)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.profileS.SaveNetworkProfileSettings(ctx, settings)
+	if err != nil {
+		return
+	}
+
+	s.settings = settings
+
+	return
+}
+
+// GetNetworkConditions returns the profile matching host, nil if conditions are not simulated for it,
+// and the fault drawn for the next request to host
+func (s *NetworkService) GetNetworkConditions(ctx context.Context, host string) (profile *domain.NetworkProfile, fault domain.NetworkFault) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	host = strings.ToLower(host)
+	for i := range s.settings.Profiles {
+		if ok, _ := path.Match(strings.ToLower(s.settings.Profiles[i].HostPattern), host); s.settings.Profiles[i].HostPattern == "" || ok {
+			profile = &s.settings.Profiles[i]
+			break
+		}
+	}
+
+	if profile == nil {
+		return
+	}
+
+	roll := rand.Float64()
+	switch {
+	case roll < profile.DropRate:
+		fault = domain.NetworkFaultDrop
+	case roll < profile.DropRate+profile.ResetRate:
+		fault = domain.NetworkFaultReset
+	case roll < profile.DropRate+profile.ResetRate+profile.ErrorRate:
+		fault = domain.NetworkFaultError
+	}
+
+	return
+}
@@ -0,0 +1,191 @@
+package passthrough
+
+import (
+	"context"
+	"log"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+)
+
+// defaultAutoFailures is used when auto passthrough is enabled without a threshold
+const defaultAutoFailures = 3
+
+type PassthroughSettingsStorage interface {
+	GetPassthroughSettings(ctx context.Context) (settings *domain.PassthroughSettings, err error)
+	SavePassthroughSettings(ctx context.Context, settings *domain.PassthroughSettings) (err error)
+}
+
+type PassthroughTunnelsStorage interface {
+	SavePassthroughTunnel(ctx context.Context, tunnel *domain.PassthroughTunnel) (savedTunnel *domain.PassthroughTunnel, err error)
+	GetPassthroughTunnelsList(ctx context.Context) (tunnels []*domain.PassthroughTunnel, err error)
+}
+
+// PassthroughService decides which TLS tunnels are relayed without interception
+// and learns hosts that keep rejecting forged certificates. mu guards the settings
+// in memory, saveMu orders their saving, which is done without holding mu.
+type PassthroughService struct {
+	mu        *sync.Mutex
+	saveMu    *sync.Mutex
+	settingsS PassthroughSettingsStorage
+	tunnelsS  PassthroughTunnelsStorage
+	settings  *domain.PassthroughSettings
+	failures  map[string]int
+}
+
+func NewPassthroughService(ctx context.Context, settingsS PassthroughSettingsStorage, tunnelsS PassthroughTunnelsStorage) (s *PassthroughService, err error) {
+	s = &PassthroughService{
+		mu:        &sync.Mutex{},
+		saveMu:    &sync.Mutex{},
+		settingsS: settingsS,
+		tunnelsS:  tunnelsS,
+		failures:  make(map[string]int),
+	}
+
+	s.settings, err = settingsS.GetPassthroughSettings(ctx)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func validateSettings(settings *domain.PassthroughSettings) (err error) {
+	if settings.AutoFailures < 0 {
+		return customerrors.ErrInvalidRequest
+	}
+
+	for _, pattern := range settings.HostPatterns {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return customerrors.ErrInvalidRequest
+		}
+	}
+
+	return
+}
+
+func (s *PassthroughService) GetPassthroughSettings(ctx context.Context) (settings *domain.PassthroughSettings, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings = s.settings
+
+	return
+}
+
+func (s *PassthroughService) SetPassthroughSettings(ctx context.Context, settings *domain.PassthroughSettings) (err error) {
+	err = validateSettings(settings)
+	if err != nil {
+		return
+	}
+
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	err = s.settingsS.SavePassthroughSettings(ctx, settings)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settings = settings
+	s.failures = make(map[string]int)
+
+	return
+}
+
+// IsPassthrough reports whether TLS to host must be relayed without interception
+func (s *PassthroughService) IsPassthrough(ctx context.Context, host string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	host = strings.ToLower(host)
+	if slices.Contains(s.settings.AutoHosts, host) {
+		return true
+	}
+
+	for _, pattern := range s.settings.HostPatterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReportHandshakeFailure counts a client rejecting the forged certificate of host.
+// In auto mode the host is switched to passthrough once the threshold is reached.
+func (s *PassthroughService) ReportHandshakeFailure(ctx context.Context, host string) {
+	if !s.countHandshakeFailure(host) {
+		return
+	}
+
+	log.Println("host switched to tls passthrough:", host)
+
+	// Settings are saved outside of mu, so tunnels are not held up by storage.
+	// The latest settings are saved, so saves finishing out of order lose nothing.
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.Lock()
+	settings := s.settings
+	s.mu.Unlock()
+
+	err := s.settingsS.SavePassthroughSettings(ctx, settings)
+	if err != nil {
+		log.Println("error saving passthrough settings: ", err)
+		return
+	}
+}
+
+// countHandshakeFailure counts a failure of host and reports whether it was switched to passthrough
+func (s *PassthroughService) countHandshakeFailure(host string) (switched bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.settings.Auto {
+		return
+	}
+
+	host = strings.ToLower(host)
+	s.failures[host]++
+
+	threshold := s.settings.AutoFailures
+	if threshold == 0 {
+		threshold = defaultAutoFailures
+	}
+
+	if s.failures[host] < threshold || slices.Contains(s.settings.AutoHosts, host) {
+		return
+	}
+
+	settings := *s.settings
+	settings.AutoHosts = append(slices.Clone(s.settings.AutoHosts), host)
+
+	s.settings = &settings
+	delete(s.failures, host)
+
+	return true
+}
+
+// ReportHandshakeSuccess resets the failure count of host, only consecutive failures are counted
+func (s *PassthroughService) ReportHandshakeSuccess(ctx context.Context, host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, strings.ToLower(host))
+}
+
+func (s *PassthroughService) SavePassthroughTunnel(ctx context.Context, tunnel *domain.PassthroughTunnel) (savedTunnel *domain.PassthroughTunnel, err error) {
+	return s.tunnelsS.SavePassthroughTunnel(ctx, tunnel)
+}
+
+func (s *PassthroughService) GetPassthroughTunnelsList(ctx context.Context) (tunnels []*domain.PassthroughTunnel, err error) {
+	return s.tunnelsS.GetPassthroughTunnelsList(ctx)
+}
@@ -0,0 +1,143 @@
+package passthrough
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/burp_junior/domain"
+)
+
+type testSettingsStorage struct {
+	settings *domain.PassthroughSettings
+	saves    int
+}
+
+func (m *testSettingsStorage) GetPassthroughSettings(ctx context.Context) (settings *domain.PassthroughSettings, err error) {
+	return m.settings, nil
+}
+
+func (m *testSettingsStorage) SavePassthroughSettings(ctx context.Context, settings *domain.PassthroughSettings) (err error) {
+	m.settings = settings
+	m.saves++
+	return nil
+}
+
+// handshake results reported for a host, true is a certificate rejection
+type report struct {
+	host     string
+	rejected bool
+}
+
+func TestAutoPassthrough(t *testing.T) {
+	tests := []struct {
+		name      string
+		settings  domain.PassthroughSettings
+		reports   []report
+		wantHosts []string
+	}{
+		{
+			name:     "auto disabled",
+			settings: domain.PassthroughSettings{AutoFailures: 1},
+			reports:  []report{{"example.com", true}, {"example.com", true}},
+		},
+		{
+			name:      "threshold reached",
+			settings:  domain.PassthroughSettings{Auto: true, AutoFailures: 2},
+			reports:   []report{{"example.com", true}, {"Example.com", true}},
+			wantHosts: []string{"example.com"},
+		},
+		{
+			name:     "below the default threshold",
+			settings: domain.PassthroughSettings{Auto: true},
+			reports:  []report{{"example.com", true}, {"example.com", true}},
+		},
+		{
+			name:      "default threshold",
+			settings:  domain.PassthroughSettings{Auto: true},
+			reports:   []report{{"example.com", true}, {"example.com", true}, {"example.com", true}},
+			wantHosts: []string{"example.com"},
+		},
+		{
+			name:     "success resets the count",
+			settings: domain.PassthroughSettings{Auto: true, AutoFailures: 2},
+			reports:  []report{{"example.com", true}, {"example.com", false}, {"example.com", true}},
+		},
+		{
+			name:      "hosts are counted separately",
+			settings:  domain.PassthroughSettings{Auto: true, AutoFailures: 2},
+			reports:   []report{{"a.com", true}, {"b.com", true}, {"b.com", true}},
+			wantHosts: []string{"b.com"},
+		},
+		{
+			name:      "host already added is not added again",
+			settings:  domain.PassthroughSettings{Auto: true, AutoFailures: 1, AutoHosts: []string{"example.com"}},
+			reports:   []report{{"example.com", true}},
+			wantHosts: []string{"example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := &testSettingsStorage{settings: &tt.settings}
+
+			s, err := NewPassthroughService(ctx, storage, nil)
+			if err != nil {
+				t.Fatalf("NewPassthroughService() error = %v", err)
+			}
+
+			for _, r := range tt.reports {
+				if r.rejected {
+					s.ReportHandshakeFailure(ctx, r.host)
+				} else {
+					s.ReportHandshakeSuccess(ctx, r.host)
+				}
+			}
+
+			wantSaves := len(tt.wantHosts) - len(tt.settings.AutoHosts)
+			if storage.saves != wantSaves {
+				t.Errorf("settings saved %d times, want %d", storage.saves, wantSaves)
+			}
+
+			if !slices.Equal(storage.settings.AutoHosts, tt.wantHosts) {
+				t.Errorf("saved AutoHosts = %v, want %v", storage.settings.AutoHosts, tt.wantHosts)
+			}
+
+			for _, host := range tt.wantHosts {
+				if !s.IsPassthrough(ctx, host) {
+					t.Errorf("IsPassthrough(%q) = false, want true", host)
+				}
+			}
+		})
+	}
+}
+
+func TestIsPassthrough(t *testing.T) {
+	settings := &domain.PassthroughSettings{
+		HostPatterns: []string{"*.Bank.com"},
+		AutoHosts:    []string{"pinned.app"},
+	}
+
+	s, err := NewPassthroughService(context.Background(), &testSettingsStorage{settings: settings}, nil)
+	if err != nil {
+		t.Fatalf("NewPassthroughService() error = %v", err)
+	}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"api.bank.com", true},
+		{"API.BANK.COM", true},
+		{"bank.com", false},
+		{"Pinned.app", true},
+		{"example.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := s.IsPassthrough(context.Background(), tt.host); got != tt.want {
+			t.Errorf("IsPassthrough(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
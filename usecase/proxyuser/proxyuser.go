@@ -0,0 +1,176 @@
+package proxyuser
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+)
+
+const saltSize = 16
+
+type ProxyUsersStorage interface {
+	SaveProxyUser(ctx context.Context, user *domain.ProxyUser) (savedUser *domain.ProxyUser, err error)
+	GetProxyUsersList(ctx context.Context) (users []*domain.ProxyUser, err error)
+	DeleteProxyUser(ctx context.Context, id string) (err error)
+}
+
+// ProxyUserService manages the credentials accepted by the proxy. Once there is at least
+// one user, proxy clients have to authenticate. Users are kept in memory and reloaded
+// after every change.
+type ProxyUserService struct {
+	mu    *sync.RWMutex
+	userS ProxyUsersStorage
+	users map[string]*domain.ProxyUser
+}
+
+func NewProxyUserService(ctx context.Context, userS ProxyUsersStorage) (s *ProxyUserService, err error) {
+	s = &ProxyUserService{
+		mu:    &sync.RWMutex{},
+		userS: userS,
+	}
+
+	err = s.reload(ctx)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (s *ProxyUserService) reload(ctx context.Context) (err error) {
+	list, err := s.userS.GetProxyUsersList(ctx)
+	if err != nil {
+		return
+	}
+
+	users := make(map[string]*domain.ProxyUser, len(list))
+	for _, user := range list {
+		users[user.Username] = user
+	}
+
+	s.mu.Lock()
+	s.users = users
+	s.mu.Unlock()
+
+	return
+}
+
+// hashPassword returns the hex encoded salt and SHA-256 of the salted password, separated by ':'
+func hashPassword(password string, salt []byte) string {
+	sum := sha256.Sum256(append(salt, password...))
+	return hex.EncodeToString(salt) + ":" + hex.EncodeToString(sum[:])
+}
+
+func checkPassword(password string, passwordHash string) bool {
+	saltHex, _, _ := strings.Cut(passwordHash, ":")
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(hashPassword(password, salt)), []byte(passwordHash)) == 1
+}
+
+// GetProxyUsersList returns the users without their password hashes
+func (s *ProxyUserService) GetProxyUsersList(ctx context.Context) (users []*domain.ProxyUser, err error) {
+	users, err = s.userS.GetProxyUsersList(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, user := range users {
+		user.PasswordHash = ""
+	}
+
+	return
+}
+
+func (s *ProxyUserService) CreateProxyUser(ctx context.Context, upload *domain.ProxyUserUpload) (savedUser *domain.ProxyUser, err error) {
+	// Basic credentials are split at the first colon
+	if upload.Username == "" || strings.Contains(upload.Username, ":") || upload.Password == "" {
+		err = customerrors.ErrInvalidRequest
+		return
+	}
+
+	s.mu.RLock()
+	_, exists := s.users[upload.Username]
+	s.mu.RUnlock()
+	if exists {
+		err = customerrors.ErrInvalidRequest
+		return
+	}
+
+	salt := make([]byte, saltSize)
+	_, err = rand.Read(salt)
+	if err != nil {
+		err = customerrors.ErrInternal
+		return
+	}
+
+	user := &domain.ProxyUser{
+		Username:     upload.Username,
+		PasswordHash: hashPassword(upload.Password, salt),
+		Tester:       upload.Tester,
+		Project:      upload.Project,
+	}
+
+	if user.Tester == "" {
+		user.Tester = user.Username
+	}
+
+	savedUser, err = s.userS.SaveProxyUser(ctx, user)
+	if err != nil {
+		return
+	}
+
+	err = s.reload(ctx)
+	if err != nil {
+		return
+	}
+
+	savedUser.PasswordHash = ""
+
+	return
+}
+
+func (s *ProxyUserService) DeleteProxyUser(ctx context.Context, id string) (err error) {
+	err = s.userS.DeleteProxyUser(ctx, id)
+	if err != nil {
+		return
+	}
+
+	err = s.reload(ctx)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// AuthRequired reports whether proxy clients have to authenticate
+func (s *ProxyUserService) AuthRequired(ctx context.Context) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.users) > 0
+}
+
+// Authenticate returns the user with the given credentials, or nil if they are not valid
+func (s *ProxyUserService) Authenticate(ctx context.Context, username string, password string) *domain.ProxyUser {
+	s.mu.RLock()
+	user, ok := s.users[username]
+	s.mu.RUnlock()
+
+	if !ok || !checkPassword(password, user.PasswordHash) {
+		return nil
+	}
+
+	return user
+}
@@ -53,7 +53,7 @@ func (r *RequestService) sendCookieScan(ctx context.Context, wg *sync.WaitGroup,
 	dirty.Sm[key] = fmt.Sprintf("%s=%s", key, scan)
 	safeReq.Cookies = dirty
 
-	res, err := r.SendHTTPRequest(ctx, domain.MakeHTTPRequestFromSafe(&safeReq))
+	res, err := r.sendScanRequest(ctx, domain.MakeHTTPRequestFromSafe(&safeReq))
 	if err != nil {
 		return
 	}
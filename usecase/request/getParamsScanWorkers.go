@@ -49,7 +49,7 @@ func (r *RequestService) sendGetParamScan(ctx context.Context, wg *sync.WaitGrou
 	safeReq.GetParams.Mu.RUnlock()
 	dirty.Sam[key] = []string{scan}
 	safeReq.GetParams = dirty
-	res, err := r.SendHTTPRequest(ctx, domain.MakeHTTPRequestFromSafe(&safeReq))
+	res, err := r.sendScanRequest(ctx, domain.MakeHTTPRequestFromSafe(&safeReq))
 	if err != nil {
 		return
 	}
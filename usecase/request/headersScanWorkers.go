@@ -50,7 +50,7 @@ func (r *RequestService) sendHeaderScan(ctx context.Context, wg *sync.WaitGroup,
 	dirty.Sam[key] = []string{scan}
 	safeReq.Headers = dirty
 
-	res, err := r.SendHTTPRequest(ctx, domain.MakeHTTPRequestFromSafe(&safeReq))
+	res, err := r.sendScanRequest(ctx, domain.MakeHTTPRequestFromSafe(&safeReq))
 	if err != nil {
 		return
 	}
@@ -49,7 +49,7 @@ func (r *RequestService) sendPostParamScan(ctx context.Context, wg *sync.WaitGro
 	safeReq.PostParams.Mu.RUnlock()
 	dirty.Sam[key] = []string{scan}
 	safeReq.PostParams = dirty
-	res, err := r.SendHTTPRequest(ctx, domain.MakeHTTPRequestFromSafe(&safeReq))
+	res, err := r.sendScanRequest(ctx, domain.MakeHTTPRequestFromSafe(&safeReq))
 	if err != nil {
 		return
 	}
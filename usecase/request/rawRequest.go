@@ -0,0 +1,332 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/timing"
+)
+
+// Headers the parsed model does not carry in Headers, they are kept from the raw head
+var unmodeledHeaders = []string{"Host", "Transfer-Encoding", "Content-Length", "Cookie"}
+
+// Headers meant for the proxy, raw requests go straight to the target without them
+var proxyHeaders = []string{"Proxy-Connection", "Proxy-Authorization"}
+
+type rawHeader struct {
+	name  string
+	value string
+	line  string
+}
+
+func parseRawHeaders(lines []string) (headers []rawHeader) {
+	for _, line := range lines {
+		name, value, _ := strings.Cut(line, ":")
+		headers = append(headers, rawHeader{
+			name:  name,
+			value: strings.TrimSpace(value),
+			line:  line,
+		})
+	}
+
+	return
+}
+
+// requestBody returns the body to send for req. Form bodies are kept as received unless PostParams were changed.
+func requestBody(req *domain.HTTPRequest) []byte {
+	if len(req.PostParams) == 0 {
+		return req.Body
+	}
+
+	received, err := url.ParseQuery(string(req.Body))
+	if err == nil && valuesEqual(received, req.PostParams) {
+		return req.Body
+	}
+
+	form := url.Values{}
+	for key, values := range req.PostParams {
+		for _, value := range values {
+			form.Add(key, value)
+		}
+	}
+
+	return []byte(form.Encode())
+}
+
+func valuesEqual(a, b map[string][]string) bool {
+	return maps.EqualFunc(a, b, slices.Equal)
+}
+
+// buildRawRequest reproduces the request from its raw head. Lines stay as received unless
+// the parsed fields they correspond to were changed, e.g. by rules, intercept or scans.
+func buildRawRequest(req *domain.HTTPRequest) (head []byte, body []byte, err error) {
+	method, rest, ok := strings.Cut(req.RequestLine, " ")
+	target, proto, ok2 := strings.Cut(rest, " ")
+	if !ok || !ok2 {
+		err = fmt.Errorf("malformed request line %q", req.RequestLine)
+		return
+	}
+
+	u, err := url.ParseRequestURI(target)
+	if err != nil {
+		return
+	}
+
+	if u.IsAbs() {
+		target = originForm(target, u.Scheme)
+	}
+
+	if method != req.Method || u.Path != req.Path || !valuesEqual(u.Query(), req.GetParams) {
+		rebuilt := &url.URL{Path: req.Path, RawQuery: url.Values(req.GetParams).Encode()}
+		method, target = req.Method, rebuilt.RequestURI()
+	}
+
+	body = requestBody(req)
+	raw := parseRawHeaders(req.RawHeaders)
+
+	rawValues := make(map[string][]string)
+	for _, h := range raw {
+		key := textproto.CanonicalMIMEHeaderKey(h.name)
+		rawValues[key] = append(rawValues[key], h.value)
+	}
+
+	chunked := false
+	for _, value := range rawValues["Transfer-Encoding"] {
+		chunked = chunked || strings.Contains(strings.ToLower(value), "chunked")
+	}
+
+	cookieChanged := !maps.Equal(parseCookies(rawValues["Cookie"]), req.Cookies)
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s %s %s\r\n", method, target, proto)
+
+	seen := make(map[string]bool)
+	replaced := make(map[string]bool)
+	for _, h := range raw {
+		key := textproto.CanonicalMIMEHeaderKey(h.name)
+		if slices.Contains(proxyHeaders, key) {
+			continue
+		}
+		seen[key] = true
+
+		var keep bool
+		var values []string
+		switch {
+		case key == "Host":
+			keep = strings.EqualFold(hostname(h.value), req.Host)
+			values = []string{req.Host}
+			if req.Port != "80" && req.Port != "443" {
+				values = []string{req.GetFullHost()}
+			}
+		case key == "Content-Length":
+			keep = chunked || h.value == strconv.Itoa(len(body))
+			values = []string{strconv.Itoa(len(body))}
+		case key == "Cookie":
+			keep = !cookieChanged
+			if len(req.Cookies) > 0 {
+				values = []string{joinCookies(req.Cookies)}
+			}
+		case slices.Contains(unmodeledHeaders, key):
+			keep = true
+		default:
+			keep = slices.Equal(rawValues[key], req.Headers[key])
+			values = req.Headers[key]
+		}
+
+		if keep {
+			buf.WriteString(h.line + "\r\n")
+			continue
+		}
+
+		// Changed headers take the place of their first line, keeping its casing
+		if replaced[key] {
+			continue
+		}
+		replaced[key] = true
+
+		for _, value := range values {
+			buf.WriteString(h.name + ": " + value + "\r\n")
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(req.Headers)) {
+		if seen[key] || slices.Contains(unmodeledHeaders, key) || slices.Contains(proxyHeaders, key) {
+			continue
+		}
+
+		for _, value := range req.Headers[key] {
+			buf.WriteString(key + ": " + value + "\r\n")
+		}
+	}
+
+	if !seen["Cookie"] && len(req.Cookies) > 0 {
+		buf.WriteString("Cookie: " + joinCookies(req.Cookies) + "\r\n")
+	}
+
+	if !seen["Content-Length"] && !chunked && len(body) > 0 {
+		buf.WriteString("Content-Length: " + strconv.Itoa(len(body)) + "\r\n")
+	}
+
+	buf.WriteString("\r\n")
+	head = buf.Bytes()
+
+	if chunked {
+		body = chunk(body)
+	}
+
+	return
+}
+
+// originForm cuts the scheme and authority off an absolute-form target, keeping the rest as received
+func originForm(target, scheme string) string {
+	rest := target[len(scheme)+len("://"):]
+
+	i := strings.IndexAny(rest, "/?")
+	if i < 0 {
+		return "/"
+	}
+	if rest[i] == '?' {
+		return "/" + rest[i:]
+	}
+
+	return rest[i:]
+}
+
+// parseCookies parses Cookie header values the way ParseHTTPRequest does
+func parseCookies(values []string) (cookies map[string]string) {
+	cookies = make(map[string]string)
+
+	r := &http.Request{Header: http.Header{"Cookie": values}}
+	for _, cookie := range r.Cookies() {
+		if cookie.Name != "" {
+			cookies[cookie.Name] = cookie.String()
+		}
+	}
+
+	return
+}
+
+func joinCookies(cookies map[string]string) string {
+	pairs := make([]string, 0, len(cookies))
+	for _, name := range slices.Sorted(maps.Keys(cookies)) {
+		pairs = append(pairs, cookies[name])
+	}
+
+	return strings.Join(pairs, "; ")
+}
+
+func hostname(hostport string) string {
+	return (&url.URL{Host: hostport}).Hostname()
+}
+
+// chunk encodes body as a single chunk followed by the last one
+func chunk(body []byte) []byte {
+	buf := &bytes.Buffer{}
+	if len(body) > 0 {
+		fmt.Fprintf(buf, "%x\r\n%s\r\n", len(body), body)
+	}
+	buf.WriteString("0\r\n\r\n")
+
+	return buf.Bytes()
+}
+
+// doRawHTTPRequest writes req to its own connection exactly as built by buildRawRequest,
+// bypassing http.Transport, which would reorder and canonicalize headers
+func (r *RequestService) doRawHTTPRequest(ctx context.Context, req *domain.HTTPRequest) (res *domain.HTTPResponse, err error) {
+	head, body, err := buildRawRequest(req)
+	if err != nil {
+		return
+	}
+
+	recorder := timing.NewRecorder()
+	conn, err := r.DialUpstream(recorder.WithContext(ctx), req)
+	if err != nil {
+		return
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+
+	// The connection is left open for bodies over the capture limit until they are closed
+	closeConn := func() {
+		stop()
+		conn.Close()
+	}
+
+	recorder.Start()
+	_, err = conn.Write(append(head, body...))
+	if err != nil {
+		closeConn()
+		return
+	}
+
+	reader := bufio.NewReader(conn)
+	if _, err = reader.Peek(1); err == nil {
+		recorder.GotFirstResponseByte()
+	}
+
+	httpResp, err := readFinalResponse(reader, req.Method)
+	if err != nil {
+		closeConn()
+		return
+	}
+	httpResp.Body = &connBody{ReadCloser: httpResp.Body, close: closeConn}
+
+	res, err = r.ParseHTTPResponse(ctx, httpResp)
+	if err != nil {
+		return
+	}
+
+	var state *tls.ConnectionState
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		connState := tlsConn.ConnectionState()
+		state = &connState
+	}
+
+	res.Connection = domain.NewConnectionInfo(conn.RemoteAddr().String(), state)
+	afterBody(res, func() {
+		res.Timing = recorder.Finish(int64(len(body)), res.BodyLength)
+	})
+
+	return
+}
+
+// readFinalResponse reads a response from reader, skipping interim 1xx responses such as
+// 100 Continue the way http.Transport does. 101 Switching Protocols is final.
+func readFinalResponse(reader *bufio.Reader, method string) (res *http.Response, err error) {
+	for {
+		res, err = http.ReadResponse(reader, &http.Request{Method: method})
+		if err != nil {
+			return
+		}
+
+		if res.StatusCode < 100 || res.StatusCode >= 200 || res.StatusCode == http.StatusSwitchingProtocols {
+			return
+		}
+	}
+}
+
+// connBody closes the connection of a response together with its body
+type connBody struct {
+	io.ReadCloser
+	close func()
+}
+
+func (b *connBody) Close() (err error) {
+	err = b.ReadCloser.Close()
+	b.close()
+	return
+}
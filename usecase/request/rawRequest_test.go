@@ -0,0 +1,298 @@
+package request
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/burp_junior/domain"
+)
+
+// parseRawRequest parses raw the way the proxy does, keeping its head as received
+func parseRawRequest(t *testing.T, raw string) *domain.HTTPRequest {
+	t.Helper()
+
+	httpReq, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("reading request: %v", err)
+	}
+
+	req, err := (&RequestService{captureLimit: 1 << 20}).ParseHTTPRequest(context.Background(), httpReq)
+	if err != nil {
+		t.Fatalf("parsing request: %v", err)
+	}
+
+	head, _, _ := strings.Cut(raw, "\r\n\r\n")
+	req.SetRawHead([]byte(head + "\r\n\r\n"))
+
+	return req
+}
+
+func TestBuildRawRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		modify   func(req *domain.HTTPRequest)
+		wantHead string
+		wantBody string
+	}{
+		{
+			name: "unchanged request keeps order, casing and duplicates",
+			raw: "GET /a?x=1&y=2 HTTP/1.1\r\n" +
+				"host: example.com\r\n" +
+				"X-B: 1\r\n" +
+				"x-a: 2\r\n" +
+				"X-Dup: 1\r\n" +
+				"X-Dup: 2\r\n" +
+				"Cookie: a=1; b=2\r\n\r\n",
+			wantHead: "GET /a?x=1&y=2 HTTP/1.1\r\n" +
+				"host: example.com\r\n" +
+				"X-B: 1\r\n" +
+				"x-a: 2\r\n" +
+				"X-Dup: 1\r\n" +
+				"X-Dup: 2\r\n" +
+				"Cookie: a=1; b=2\r\n\r\n",
+		},
+		{
+			name: "absolute-form target is sent in origin-form",
+			raw: "GET http://example.com/a%2Fb?x=1 HTTP/1.1\r\n" +
+				"Host: example.com\r\n\r\n",
+			wantHead: "GET /a%2Fb?x=1 HTTP/1.1\r\n" +
+				"Host: example.com\r\n\r\n",
+		},
+		{
+			name: "absolute-form target without a path",
+			raw: "GET http://example.com:8080 HTTP/1.1\r\n" +
+				"Host: example.com:8080\r\n\r\n",
+			wantHead: "GET / HTTP/1.1\r\n" +
+				"Host: example.com:8080\r\n\r\n",
+		},
+		{
+			name: "proxy headers are dropped",
+			raw: "GET http://example.com/ HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"Proxy-Connection: keep-alive\r\n" +
+				"proxy-authorization: Basic dTpw\r\n" +
+				"Accept: */*\r\n\r\n",
+			modify: func(req *domain.HTTPRequest) {
+				req.Headers["Proxy-Authorization"] = []string{"Basic dTpw"}
+			},
+			wantHead: "GET / HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"Accept: */*\r\n\r\n",
+		},
+		{
+			name: "changed header takes the place of its first line",
+			raw: "GET / HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"x-dup: 1\r\n" +
+				"X-Other: o\r\n" +
+				"X-Dup: 2\r\n\r\n",
+			modify: func(req *domain.HTTPRequest) {
+				req.Headers["X-Dup"] = []string{"3"}
+			},
+			wantHead: "GET / HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"x-dup: 3\r\n" +
+				"X-Other: o\r\n\r\n",
+		},
+		{
+			name: "added header goes after the received ones",
+			raw: "GET / HTTP/1.1\r\n" +
+				"Host: example.com\r\n\r\n",
+			modify: func(req *domain.HTTPRequest) {
+				req.Headers["X-New"] = []string{"n"}
+			},
+			wantHead: "GET / HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"X-New: n\r\n\r\n",
+		},
+		{
+			name: "changed host is rewritten with its port",
+			raw: "GET / HTTP/1.1\r\n" +
+				"HOST: example.com\r\n" +
+				"Accept: */*\r\n\r\n",
+			modify: func(req *domain.HTTPRequest) {
+				req.Host, req.Port = "other.test", "8443"
+			},
+			wantHead: "GET / HTTP/1.1\r\n" +
+				"HOST: other.test:8443\r\n" +
+				"Accept: */*\r\n\r\n",
+		},
+		{
+			name: "host on a default port stays as received",
+			raw: "GET / HTTP/1.1\r\n" +
+				"Host: example.com:443\r\n\r\n",
+			modify: func(req *domain.HTTPRequest) {
+				req.Scheme = "https"
+			},
+			wantHead: "GET / HTTP/1.1\r\n" +
+				"Host: example.com:443\r\n\r\n",
+		},
+		{
+			name: "content length follows a changed body",
+			raw: "POST /u HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"content-length: 3\r\n" +
+				"Accept: */*\r\n\r\n" +
+				"abc",
+			modify: func(req *domain.HTTPRequest) {
+				req.Body = []byte("abcdef")
+			},
+			wantHead: "POST /u HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"content-length: 6\r\n" +
+				"Accept: */*\r\n\r\n",
+			wantBody: "abcdef",
+		},
+		{
+			name: "content length is added for a new body",
+			raw: "POST /u HTTP/1.1\r\n" +
+				"Host: example.com\r\n\r\n",
+			modify: func(req *domain.HTTPRequest) {
+				req.Body = []byte("abc")
+			},
+			wantHead: "POST /u HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"Content-Length: 3\r\n\r\n",
+			wantBody: "abc",
+		},
+		{
+			name: "chunked body is sent chunked",
+			raw: "POST /u HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"Transfer-Encoding: chunked\r\n\r\n" +
+				"3\r\nabc\r\n2\r\nde\r\n0\r\n\r\n",
+			wantHead: "POST /u HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"Transfer-Encoding: chunked\r\n\r\n",
+			wantBody: "5\r\nabcde\r\n0\r\n\r\n",
+		},
+		{
+			name: "changed chunked body gets no content length",
+			raw: "POST /u HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"Transfer-Encoding: chunked\r\n\r\n" +
+				"3\r\nabc\r\n0\r\n\r\n",
+			modify: func(req *domain.HTTPRequest) {
+				req.Body = []byte("hello")
+			},
+			wantHead: "POST /u HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"Transfer-Encoding: chunked\r\n\r\n",
+			wantBody: "5\r\nhello\r\n0\r\n\r\n",
+		},
+		{
+			name: "changed path rebuilds the request line",
+			raw: "GET /a?x=1 HTTP/1.1\r\n" +
+				"Host: example.com\r\n\r\n",
+			modify: func(req *domain.HTTPRequest) {
+				req.Path = "/b"
+				req.GetParams["x"] = []string{"2"}
+			},
+			wantHead: "GET /b?x=2 HTTP/1.1\r\n" +
+				"Host: example.com\r\n\r\n",
+		},
+		{
+			name: "changed cookie replaces the cookie line",
+			raw: "GET / HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"cookie: b=2; a=1\r\n" +
+				"Accept: */*\r\n\r\n",
+			modify: func(req *domain.HTTPRequest) {
+				req.Cookies["a"] = "a=3"
+			},
+			wantHead: "GET / HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"cookie: a=3; b=2\r\n" +
+				"Accept: */*\r\n\r\n",
+		},
+		{
+			name: "changed form body is rebuilt from post params",
+			raw: "POST /f HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"Content-Type: application/x-www-form-urlencoded\r\n" +
+				"Content-Length: 11\r\n\r\n" +
+				"b=2&a=1%20x",
+			modify: func(req *domain.HTTPRequest) {
+				req.PostParams["a"] = []string{"y"}
+			},
+			wantHead: "POST /f HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"Content-Type: application/x-www-form-urlencoded\r\n" +
+				"Content-Length: 7\r\n\r\n",
+			wantBody: "a=y&b=2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := parseRawRequest(t, tt.raw)
+			if tt.modify != nil {
+				tt.modify(req)
+			}
+
+			head, body, err := buildRawRequest(req)
+			if err != nil {
+				t.Fatalf("buildRawRequest() error = %v", err)
+			}
+
+			if string(head) != tt.wantHead {
+				t.Errorf("head = %q, want %q", head, tt.wantHead)
+			}
+
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestBuildRawRequestMalformedLine(t *testing.T) {
+	req := &domain.HTTPRequest{RequestLine: "GET /"}
+
+	_, _, err := buildRawRequest(req)
+	if err == nil {
+		t.Fatal("buildRawRequest() error = nil, want malformed request line")
+	}
+}
+
+func TestRequestBody(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *domain.HTTPRequest
+		want string
+	}{
+		{
+			name: "body without post params is sent as is",
+			req:  &domain.HTTPRequest{Body: []byte(`{"a":1}`)},
+			want: `{"a":1}`,
+		},
+		{
+			name: "unchanged form keeps its order and encoding",
+			req: &domain.HTTPRequest{
+				Body:       []byte("b=2&a=1%20x&a=z"),
+				PostParams: map[string][]string{"a": {"1 x", "z"}, "b": {"2"}},
+			},
+			want: "b=2&a=1%20x&a=z",
+		},
+		{
+			name: "changed post params are encoded",
+			req: &domain.HTTPRequest{
+				Body:       []byte("b=2&a=1"),
+				PostParams: map[string][]string{"a": {"1"}, "b": {"3"}, "c": {"&"}},
+			},
+			want: "a=1&b=3&c=%26",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requestBody(tt.req); string(got) != tt.want {
+				t.Errorf("requestBody() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
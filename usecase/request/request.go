@@ -1,454 +1,811 @@
-package request
-
-import (
-	"bufio"
-	"bytes"
-	"compress/gzip"
-	"context"
-	"crypto/tls"
-	"errors"
-	"io"
-	"log"
-	"net/http"
-	"net/url"
-	"strings"
-	"sync"
-	"time"
-
-	"github.com/burp_junior/domain"
-	"github.com/burp_junior/pkg/certs"
-)
-
-var (
-	commandInjectionScans = []string{
-		";cat /etc/passwd;",
-		"|cat /etc/passwd|",
-		"`cat /etc/passwd`",
-	}
-	commandInjectionCheckString = "root:"
-)
-
-type RequestService struct {
-	ca   *tls.Certificate
-	reqS RequestsStorage
-	resS ResponseStorage
-}
-
-type SafeInjections struct {
-	mu *sync.RWMutex
-	ci []string
-}
-
-type RequestsStorage interface {
-	SaveRequest(ctx context.Context, r *domain.HTTPRequest) (insertedReq *domain.HTTPRequest, err error)
-	GetRequestsList(ctx context.Context) (reqs []*domain.HTTPRequest, err error)
-	GetRequestByID(ctx context.Context, id string) (req *domain.HTTPRequest, err error)
-}
-
-type ResponseStorage interface {
-	SaveResponse(ctx context.Context, resp *domain.HTTPResponse) (savedResp *domain.HTTPResponse, err error)
-}
-
-func NewRequestService(reqS RequestsStorage, resS ResponseStorage) (p *RequestService, err error) {
-	p = &RequestService{
-		reqS: reqS,
-		resS: resS,
-	}
-
-	p.ca, err = certs.GetCA("ca.crt", "ca.key")
-	if err != nil {
-		return
-	}
-
-	return
-}
-
-func (p *RequestService) parseCookie(cookieStr string) (*http.Cookie, error) {
-	// Create a dummy HTTP response string with the cookie
-	responseStr := "HTTP/1.1 200 OK\r\n" +
-		"Set-Cookie: " + cookieStr + "\r\n" +
-		"\r\n"
-
-	// Read the response using http.ReadResponse
-	reader := bufio.NewReader(strings.NewReader(responseStr))
-	resp, err := http.ReadResponse(reader, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Extract the cookie from the response
-	if len(resp.Cookies()) > 0 {
-		return resp.Cookies()[0], nil
-	}
-
-	return nil, errors.New("no cookies found")
-}
-
-func (p *RequestService) parseHTTPBody(r *http.Request) (body []byte, err error) {
-	body = nil
-
-	if r.Body == nil || r.ContentLength == 0 {
-		return
-	}
-
-	// Handle the case where ContentLength is not set
-	if r.ContentLength == -1 {
-		body, err = io.ReadAll(r.Body)
-		if err != nil && err != io.EOF {
-			return
-		}
-
-		err = nil
-	} else {
-		body = make([]byte, r.ContentLength)
-		_, err = r.Body.Read(body)
-		if err != nil && err != io.EOF {
-			return
-		}
-
-		err = nil
-	}
-
-	return
-}
-
-func (p *RequestService) parseHTTPHeaders(r *http.Request) (headers map[string][]string, err error) {
-	headers = make(map[string][]string)
-	for key, values := range r.Header {
-		if key == "Proxy-Connection" || key == "Cookie" {
-			continue
-		}
-
-		headers[key] = values
-	}
-
-	return
-}
-
-func (p *RequestService) ParseHTTPRequest(ctx context.Context, r *http.Request) (hr *domain.HTTPRequest, err error) {
-	hr = &domain.HTTPRequest{}
-
-	err = r.ParseForm()
-	if err != nil {
-		log.Println("error parsing form data: ", err)
-		return
-	}
-	hr.PostParams = r.PostForm
-
-	hr.Method = r.Method
-
-	if colonIdx := strings.Index(r.Host, ":"); colonIdx == -1 {
-		hr.Host = r.Host
-		hr.Port = "80"
-	} else {
-		hr.Host = r.Host[:colonIdx]
-		hr.Port = r.Host[colonIdx+1:]
-	}
-
-	hr.Scheme = r.URL.Scheme
-	if hr.Scheme == "" {
-		hr.Scheme = "http"
-		if r.TLS != nil || hr.Port == "443" {
-			hr.Scheme = "https"
-		}
-	}
-
-	hr.Proto = r.Proto
-
-	// Parse path
-	hr.Path = r.URL.Path
-
-	hr.Headers, err = p.parseHTTPHeaders(r)
-	if err != nil {
-		log.Println("error parsing headers: ", err)
-		return
-	}
-
-	hr.Body, err = p.parseHTTPBody(r)
-	if err != nil {
-		log.Println("error parsing body: ", err)
-		return
-	}
-
-	hr.GetParams = r.URL.Query()
-
-	hr.Cookies = make(map[string]string)
-
-	for _, cookie := range r.Cookies() {
-		if cookie.Name != "" {
-			hr.Cookies[cookie.Name] = cookie.String()
-		}
-	}
-
-	return
-}
-
-func (r *RequestService) SendHTTPRequest(ctx context.Context, req *domain.HTTPRequest) (res *domain.HTTPResponse, err error) {
-	var tlsCfg *tls.Config
-
-	if req.Scheme == "https" {
-		tlsCfg, _, err = r.GetTLSConfig(ctx, req)
-		if err != nil {
-			return
-		}
-	}
-
-	tr := &http.Transport{
-		MaxIdleConns:    10,
-		IdleConnTimeout: 30 * time.Second,
-		TLSClientConfig: tlsCfg,
-	}
-	client := &http.Client{Transport: tr}
-
-	var bodyReader io.Reader
-
-	if len(req.PostParams) > 0 {
-		form := url.Values{}
-
-		for key, values := range req.PostParams {
-			for _, value := range values {
-				form.Add(key, value)
-			}
-		}
-
-		bodyReader = strings.NewReader(form.Encode())
-	} else {
-		bodyReader = bytes.NewReader(req.Body)
-	}
-
-	httpReq, err := http.NewRequest(req.Method, req.Scheme+"://"+req.GetFullHost()+req.Path, bodyReader)
-	if err != nil {
-		return
-	}
-
-	for key, values := range req.Headers {
-		for _, value := range values {
-			httpReq.Header.Add(key, value)
-		}
-	}
-
-	q := httpReq.URL.Query()
-	for key, values := range req.GetParams {
-		for _, value := range values {
-			q.Add(key, value)
-		}
-	}
-	httpReq.URL.RawQuery = q.Encode()
-
-	for _, value := range req.Cookies {
-		cookie, err := r.parseCookie(value)
-		if err != nil {
-			return nil, err
-		}
-
-		httpReq.AddCookie(cookie)
-	}
-
-	httpResp, err := client.Do(httpReq)
-	if err != nil {
-		return
-	}
-
-	res, err = r.ParseHTTPResponse(ctx, httpResp)
-	if err != nil {
-		return
-	}
-
-	res, err = r.SaveHTTPResponse(ctx, res, req)
-	if err != nil {
-		return
-	}
-
-	return
-}
-
-func (p *RequestService) GetTLSConfig(ctx context.Context, pr *domain.HTTPRequest) (tlsCfg *tls.Config, sconn *tls.Conn, err error) {
-	provisionalCert, err := p.GetTLSCert(ctx, pr.Host)
-	if err != nil {
-		return
-	}
-
-	tlsCfg = &tls.Config{
-		MinVersion: tls.VersionTLS12,
-	}
-	tlsCfg.Certificates = []tls.Certificate{*provisionalCert}
-
-	tlsCfg.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
-		cConfig := &tls.Config{
-			MinVersion: tls.VersionTLS12,
-		}
-		cConfig.ServerName = hello.ServerName
-		sconn, err = tls.Dial("tcp", pr.GetFullHost(), cConfig)
-		if err != nil {
-			return nil, err
-		}
-		return p.GetTLSCert(ctx, hello.ServerName)
-	}
-
-	return
-}
-
-func (p *RequestService) GetTLSCert(ctx context.Context, host string) (cert *tls.Certificate, err error) {
-	cert, err = certs.SignTLSCert(host, p.ca)
-	if err != nil {
-		return
-	}
-
-	return
-}
-
-func (p *RequestService) SaveRequest(ctx context.Context, r *domain.HTTPRequest) (newReq *domain.HTTPRequest, err error) {
-	newReq, err = p.reqS.SaveRequest(ctx, r)
-	if err != nil {
-		log.Println("error saving request: ", err)
-		return
-	}
-
-	return
-}
-
-func (p *RequestService) GetRequestsList(ctx context.Context) (reqs []*domain.HTTPRequest, err error) {
-	reqs, err = p.reqS.GetRequestsList(ctx)
-	if err != nil {
-		log.Println("error getting requests list: ", err)
-		return
-	}
-
-	return
-}
-
-func (r *RequestService) ParseHTTPResponse(ctx context.Context, resp *http.Response) (*domain.HTTPResponse, error) {
-	var bodyReader io.ReadCloser
-	var err error
-
-	// Check if the response body is gzip-encoded
-	if resp.Header.Get("Content-Encoding") == "gzip" {
-		bodyReader, err = gzip.NewReader(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		bodyReader = resp.Body
-	}
-
-	body, err := io.ReadAll(bodyReader)
-	if err != nil {
-		return nil, err
-	}
-	defer bodyReader.Close()
-
-	// Create the HTTPResponse struct
-	httpResponse := &domain.HTTPResponse{
-		Code:    resp.StatusCode,
-		Message: resp.Status,
-		Headers: make(map[string][]string),
-		Body:    string(body),
-	}
-
-	// Copy headers
-	for key, values := range resp.Header {
-		httpResponse.Headers[key] = values
-	}
-
-	return httpResponse, nil
-}
-
-func (r *RequestService) SaveHTTPResponse(ctx context.Context, resp *domain.HTTPResponse, req *domain.HTTPRequest) (savedResp *domain.HTTPResponse, err error) {
-	resp.RequestID = req.ID
-
-	savedResp, err = r.resS.SaveResponse(ctx, resp)
-	if err != nil {
-		return
-	}
-
-	return
-}
-
-func (r *RequestService) GetRequestByID(ctx context.Context, reqID string) (req *domain.HTTPRequest, err error) {
-	req, err = r.reqS.GetRequestByID(ctx, reqID)
-	if err != nil {
-		return
-	}
-
-	return
-}
-
-func (r *RequestService) RepeatRequestByID(ctx context.Context, reqID string) (res *domain.HTTPResponse, err error) {
-	req, err := r.GetRequestByID(ctx, reqID)
-	if err != nil {
-		return
-	}
-
-	res, err = r.SendHTTPRequest(ctx, req)
-	if err != nil {
-		return
-	}
-
-	return
-}
-
-func (r *RequestService) isCommandInjectionVulnerable(resp *domain.HTTPResponse) bool {
-	return strings.Contains(resp.Body, commandInjectionCheckString)
-}
-
-func copySyncMapIntoStringArrMap(sm *sync.Map) (rm map[string][]string) {
-	rm = make(map[string][]string, 0)
-	sm.Range(func(key any, value any) bool {
-		rm[key.(string)] = value.([]string)
-		return true
-	})
-
-	return
-}
-
-func copySyncMapIntoStringMap(sm *sync.Map) (rm map[string]string) {
-	rm = make(map[string]string, 0)
-	sm.Range(func(key any, value any) bool {
-		rm[key.(string)] = value.(string)
-		return true
-	})
-
-	return
-}
-
-// ScanRequestWithCommandInjection scans request with ID=reqID, sequentially pasting Command Injection
-// variations into every Header, Cookie, Get param and FormData field.
-// It returns unsafeReq of type *domain.HTTPRequest, fields of which contain only values that are penetrated by injection.
-func (r *RequestService) ScanRequestWithCommandInjection(ctx context.Context, reqID string) (unsafeReq *domain.HTTPRequest, err error) {
-	req, err := r.reqS.GetRequestByID(ctx, reqID)
-	if err != nil {
-		return
-	}
-
-	unsafeR := *req
-	ci := SafeInjections{
-		mu: &sync.RWMutex{},
-		ci: commandInjectionScans,
-	}
-
-	headers := &sync.Map{}
-	cookies := &sync.Map{}
-	getParams := &sync.Map{}
-	postParams := &sync.Map{}
-
-	safeR := domain.MakeSafeHTTPRequest(&unsafeR)
-
-	globalWg := &sync.WaitGroup{}
-	globalWg.Add(4)
-
-	go r.scanHeadersWorker(ctx, globalWg, safeR, ci, headers)
-	go r.scanCookiesWorker(ctx, globalWg, safeR, ci, cookies)
-	go r.scanGetParamsWorker(ctx, globalWg, safeR, ci, getParams)
-	go r.scanPostParamsWorker(ctx, globalWg, safeR, ci, postParams)
-
-	globalWg.Wait()
-
-	unsafeReq = &unsafeR
-
-	unsafeReq.Headers = copySyncMapIntoStringArrMap(headers)
-	unsafeReq.GetParams = copySyncMapIntoStringArrMap(getParams)
-	unsafeReq.PostParams = copySyncMapIntoStringArrMap(postParams)
-	unsafeReq.Cookies = copySyncMapIntoStringMap(cookies)
-
-	return
-}
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/certs"
+	"github.com/burp_junior/pkg/contentcoding"
+	"github.com/burp_junior/pkg/timing"
+)
+
+var (
+	commandInjectionScans = []string{
+		";cat /etc/passwd;",
+		"|cat /etc/passwd|",
+		"`cat /etc/passwd`",
+	}
+	commandInjectionCheckString = "root:"
+
+	// certCacheTTL is how long a forged certificate is reused for its host
+	certCacheTTL = 24 * time.Hour
+)
+
+// Config holds the settings of RequestService. With WildcardCerts a single forged certificate
+// is issued for all sibling subdomains instead of one per host. Only the first CaptureLimit
+// bytes of request and response bodies are kept. Scans send at most ScanConcurrency requests at once,
+// each bounded by ScanRequestTimeout unless it is zero.
+type Config struct {
+	WildcardCerts      bool
+	CaptureLimit       int64
+	ScanConcurrency    int
+	ScanRequestTimeout time.Duration
+}
+
+type RequestService struct {
+	ca            CAProvider
+	clientCerts   ClientCertProvider
+	certCache     *certs.CertCache
+	wildcardCerts bool
+	captureLimit  int64
+	scanSlots     chan struct{}
+	scanTimeout   time.Duration
+	reqS          RequestsStorage
+	resS          ResponseStorage
+	scope         ScopeChecker
+	upstream      UpstreamDialer
+	// transports are shared by requests sent with the same client certificate and protocol,
+	// so that their connections are pooled
+	transports   map[transportKey]*http.Transport
+	transportsMu *sync.Mutex
+}
+
+type transportKey struct {
+	clientCert *tls.Certificate
+	http2      bool
+}
+
+type SafeInjections struct {
+	mu *sync.RWMutex
+	ci []string
+}
+
+type RequestsStorage interface {
+	SaveRequest(ctx context.Context, r *domain.HTTPRequest) (insertedReq *domain.HTTPRequest, err error)
+	GetRequestsList(ctx context.Context, filter *domain.RequestsFilter) (page *domain.RequestsPage, err error)
+	GetRequestByID(ctx context.Context, id string) (req *domain.HTTPRequest, err error)
+	SetRequestResponse(ctx context.Context, id string, resp *domain.HTTPResponse) (err error)
+}
+
+type ResponseStorage interface {
+	SaveResponse(ctx context.Context, resp *domain.HTTPResponse) (savedResp *domain.HTTPResponse, err error)
+	GetResponseByRequestID(ctx context.Context, reqID string) (resp *domain.HTTPResponse, err error)
+}
+
+type ScopeChecker interface {
+	InScope(ctx context.Context, req *domain.HTTPRequest) bool
+	GetScope(ctx context.Context) (scope *domain.Scope, err error)
+}
+
+type CAProvider interface {
+	GetCA() *tls.Certificate
+}
+
+type ClientCertProvider interface {
+	GetClientCertificate(host string) *tls.Certificate
+}
+
+type UpstreamDialer interface {
+	ProxyURL(host string) *url.URL
+	DialContext(ctx context.Context, network, addr string) (conn net.Conn, err error)
+}
+
+func NewRequestService(reqS RequestsStorage, resS ResponseStorage, scope ScopeChecker, upstream UpstreamDialer, ca CAProvider, clientCerts ClientCertProvider, cfg Config) (p *RequestService, err error) {
+	p = &RequestService{
+		captureLimit:  cfg.CaptureLimit,
+		ca:            ca,
+		clientCerts:   clientCerts,
+		certCache:     certs.NewCertCache(certCacheTTL),
+		wildcardCerts: cfg.WildcardCerts,
+		scanSlots:     make(chan struct{}, max(cfg.ScanConcurrency, 1)),
+		scanTimeout:   cfg.ScanRequestTimeout,
+		reqS:          reqS,
+		resS:          resS,
+		scope:         scope,
+		upstream:      upstream,
+		transports:    make(map[transportKey]*http.Transport),
+		transportsMu:  &sync.Mutex{},
+	}
+
+	return
+}
+
+func (p *RequestService) parseCookie(cookieStr string) (*http.Cookie, error) {
+	// Create a dummy HTTP response string with the cookie
+	responseStr := "HTTP/1.1 200 OK\r\n" +
+		"Set-Cookie: " + cookieStr + "\r\n" +
+		"\r\n"
+
+	// Read the response using http.ReadResponse
+	reader := bufio.NewReader(strings.NewReader(responseStr))
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Extract the cookie from the response
+	if len(resp.Cookies()) > 0 {
+		return resp.Cookies()[0], nil
+	}
+
+	return nil, errors.New("no cookies found")
+}
+
+// parseHTTPBody reads the body of r up to one byte over the capture limit, the rest is left in r.Body
+func (p *RequestService) parseHTTPBody(r *http.Request) (body []byte, err error) {
+	if r.Body == nil || r.ContentLength == 0 {
+		return
+	}
+
+	body, err = io.ReadAll(io.LimitReader(r.Body, p.captureLimit+1))
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (p *RequestService) parseHTTPHeaders(r *http.Request) (headers map[string][]string, err error) {
+	headers = make(map[string][]string)
+	for key, values := range r.Header {
+		if key == "Proxy-Connection" || key == "Cookie" {
+			continue
+		}
+
+		headers[key] = values
+	}
+
+	return
+}
+
+func (p *RequestService) ParseHTTPRequest(ctx context.Context, r *http.Request) (hr *domain.HTTPRequest, err error) {
+	hr = &domain.HTTPRequest{}
+
+	// The body is read before the form, which would consume it, so that it is kept as received
+	hr.Body, err = p.parseHTTPBody(r)
+	if err != nil {
+		log.Println("error parsing body: ", err)
+		return
+	}
+	hr.BodyLength = int64(len(hr.Body))
+
+	if hr.BodyLength > p.captureLimit {
+		// A truncated body is not parsed as a form. It is passed on as a stream, the length
+		// of chunked bodies is known once the stream has been read.
+		read := hr.Body
+		hr.Body = read[:p.captureLimit]
+		hr.Truncated = true
+		hr.BodyLength = r.ContentLength
+		hr.BodyStream = newStreamedBody(&hr.BodyLength, read, r.Body)
+		r.Body = hr.BodyStream
+	} else {
+		r.Body = io.NopCloser(bytes.NewReader(hr.Body))
+
+		err = r.ParseForm()
+		if err != nil {
+			log.Println("error parsing form data: ", err)
+			return
+		}
+		hr.PostParams = r.PostForm
+
+		r.Body = io.NopCloser(bytes.NewReader(hr.Body))
+	}
+
+	hr.Method = r.Method
+
+	// Clients of the transparent proxy send origin-form requests,
+	// so the Host header is the only source of the target
+	if r.Host == "" {
+		err = customerrors.ErrParsingRequest
+		return
+	}
+
+	if colonIdx := strings.Index(r.Host, ":"); colonIdx == -1 {
+		hr.Host = r.Host
+		hr.Port = "80"
+	} else {
+		hr.Host = r.Host[:colonIdx]
+		hr.Port = r.Host[colonIdx+1:]
+	}
+
+	hr.Scheme = r.URL.Scheme
+	if hr.Scheme == "" {
+		hr.Scheme = "http"
+		if r.TLS != nil || hr.Port == "443" {
+			hr.Scheme = "https"
+		}
+	}
+
+	hr.Proto = r.Proto
+
+	hr.Connection = domain.NewConnectionInfo(r.RemoteAddr, r.TLS)
+
+	// Parse path
+	hr.Path = r.URL.Path
+
+	hr.Headers, err = p.parseHTTPHeaders(r)
+	if err != nil {
+		log.Println("error parsing headers: ", err)
+		return
+	}
+
+	hr.GetParams = r.URL.Query()
+
+	hr.Cookies = make(map[string]string)
+
+	for _, cookie := range r.Cookies() {
+		if cookie.Name != "" {
+			hr.Cookies[cookie.Name] = cookie.String()
+		}
+	}
+
+	return
+}
+
+// sendScanRequest sends a request of a scan once one of the scan slots is free
+func (r *RequestService) sendScanRequest(ctx context.Context, req *domain.HTTPRequest) (res *domain.HTTPResponse, err error) {
+	select {
+	case r.scanSlots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-r.scanSlots }()
+
+	if r.scanTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.scanTimeout)
+		defer cancel()
+	}
+
+	return r.SendHTTPRequest(ctx, req)
+}
+
+// SendHTTPRequest sends req upstream and saves the response linked to req.
+func (r *RequestService) SendHTTPRequest(ctx context.Context, req *domain.HTTPRequest) (res *domain.HTTPResponse, err error) {
+	res, err = r.DoHTTPRequest(ctx, req)
+	if err != nil {
+		return
+	}
+
+	res, err = r.SaveHTTPResponse(ctx, res, req)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// DoHTTPRequest sends req upstream as it was received and parses the response without saving it,
+// as repeat and scan do. HTTP/1.x requests with a raw head are replayed byte for byte on a
+// connection of their own, see doRawHTTPRequest. Bodies over the capture limit are read to
+// the end and truncated.
+func (r *RequestService) DoHTTPRequest(ctx context.Context, req *domain.HTTPRequest) (res *domain.HTTPResponse, err error) {
+	if req.RequestLine != "" && req.Proto != domain.ProtoHTTP2 {
+		res, err = r.doRawHTTPRequest(ctx, req)
+	} else {
+		res, err = r.OpenHTTPRequest(ctx, req)
+	}
+	if err != nil {
+		return
+	}
+
+	if res.BodyStream != nil {
+		_, err = io.Copy(io.Discard, res.BodyStream)
+		res.BodyStream.Close()
+		res.BodyStream = nil
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// OpenHTTPRequest sends req upstream over pooled connections, as the proxy does for the
+// traffic it forwards, and parses the response without saving it. Bodies over the capture
+// limit are left in BodyStream for the caller to pass on.
+func (r *RequestService) OpenHTTPRequest(ctx context.Context, req *domain.HTTPRequest) (res *domain.HTTPResponse, err error) {
+	client := &http.Client{Transport: r.transport(req)}
+
+	httpReq, err := r.BuildHTTPRequest(ctx, req)
+	if err != nil {
+		return
+	}
+
+	// The transport hides the connection it picked, so its address is taken from the trace.
+	// Behind an upstream proxy this is the address of the proxy.
+	var remoteAddr string
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			remoteAddr = info.Conn.RemoteAddr().String()
+		},
+	}
+	recorder := timing.NewRecorder()
+	httpReq = httpReq.WithContext(httptrace.WithClientTrace(recorder.WithContext(httpReq.Context()), trace))
+
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return
+	}
+
+	res, err = r.ParseHTTPResponse(ctx, httpResp)
+	if err != nil {
+		return
+	}
+
+	res.Connection = domain.NewConnectionInfo(remoteAddr, httpResp.TLS)
+	afterBody(res, func() {
+		res.Timing = recorder.Finish(max(httpReq.ContentLength, 0), res.BodyLength)
+	})
+
+	return
+}
+
+// transport returns the transport req is sent with
+func (r *RequestService) transport(req *domain.HTTPRequest) *http.Transport {
+	key := transportKey{
+		clientCert: r.clientCerts.GetClientCertificate(req.Host),
+		// Requests captured over HTTP/2 are sent over HTTP/2 whenever the target negotiates it,
+		// others stay on HTTP/1.1 to be sent as they were seen
+		http2: req.Proto == domain.ProtoHTTP2,
+	}
+
+	r.transportsMu.Lock()
+	defer r.transportsMu.Unlock()
+
+	tr, ok := r.transports[key]
+	if ok {
+		return tr
+	}
+
+	tr = &http.Transport{
+		MaxIdleConns:    100,
+		IdleConnTimeout: 30 * time.Second,
+		TLSClientConfig: presentingCertificate(&tls.Config{MinVersion: tls.VersionTLS12}, key.clientCert),
+		// Bodies are stored as received, so the transport must not decode them itself
+		DisableCompression: true,
+		ForceAttemptHTTP2:  key.http2,
+		Proxy: func(httpReq *http.Request) (*url.URL, error) {
+			return r.upstream.ProxyURL(httpReq.URL.Hostname()), nil
+		},
+	}
+	r.transports[key] = tr
+
+	return tr
+}
+
+// BuildHTTPRequest turns a stored request back into *http.Request ready to be sent upstream.
+func (r *RequestService) BuildHTTPRequest(ctx context.Context, req *domain.HTTPRequest) (httpReq *http.Request, err error) {
+	var body io.Reader = bytes.NewReader(requestBody(req))
+	if req.BodyStream != nil {
+		body = req.BodyStream
+	}
+
+	httpReq, err = http.NewRequestWithContext(ctx, req.Method, req.Scheme+"://"+req.GetFullHost()+req.Path, body)
+	if err != nil {
+		return
+	}
+
+	if req.BodyStream != nil {
+		// Chunked bodies have no length yet, -1 sends them chunked as well
+		httpReq.ContentLength = req.BodyLength
+	}
+
+	for key, values := range req.Headers {
+		for _, value := range values {
+			httpReq.Header.Add(key, value)
+		}
+	}
+
+	q := httpReq.URL.Query()
+	for key, values := range req.GetParams {
+		for _, value := range values {
+			q.Add(key, value)
+		}
+	}
+	httpReq.URL.RawQuery = q.Encode()
+
+	for _, value := range req.Cookies {
+		cookie, err := r.parseCookie(value)
+		if err != nil {
+			return nil, err
+		}
+
+		httpReq.AddCookie(cookie)
+	}
+
+	return
+}
+
+// GetTLSConfig returns the server config for terminating client TLS of a tunnel to pr.
+// On ClientHello the target is dialed with the SNI of the client and the forged certificate
+// mimics the certificate of the target. The dialed connection is sent to upstream
+// for reuse; it may be missing if the handshake did not ask for a certificate.
+func (p *RequestService) GetTLSConfig(ctx context.Context, pr *domain.HTTPRequest) (tlsCfg *tls.Config, upstream <-chan *tls.Conn, err error) {
+	provisionalCert, err := p.GetTLSCert(ctx, pr.Host)
+	if err != nil {
+		return
+	}
+
+	tlsCfg = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	tlsCfg.Certificates = []tls.Certificate{*provisionalCert}
+
+	upstreamCh := make(chan *tls.Conn, 1)
+	upstream = upstreamCh
+
+	tlsCfg.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		serverName := hello.ServerName
+		if serverName == "" {
+			// Clients connecting by IP address send no SNI
+			serverName = pr.Host
+		}
+
+		cConfig := &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+		cConfig.ServerName = serverName
+		sconn, err := p.DialUpstreamTLS(ctx, pr, cConfig)
+		if err != nil {
+			// The client still gets a certificate, the tunnel fails on the next dial
+			log.Println("error dialing target for certificate: ", err)
+			return p.GetTLSCert(ctx, serverName)
+		}
+
+		select {
+		case upstreamCh <- sconn:
+		default:
+			sconn.Close()
+		}
+
+		return p.GetMimicTLSCert(ctx, sconn.ConnectionState().PeerCertificates[0])
+	}
+
+	return
+}
+
+// GetMimicTLSCert returns a certificate signed by the CA that copies the subject, SANs
+// and validity of the target certificate, reusing cached ones
+func (p *RequestService) GetMimicTLSCert(ctx context.Context, target *x509.Certificate) (cert *tls.Certificate, err error) {
+	ca := p.ca.GetCA()
+	fingerprint := sha256.Sum256(target.Raw)
+	cert, err = p.certCache.Get(ca.Leaf.SerialNumber.Text(16)+"/"+hex.EncodeToString(fingerprint[:]), func() (*tls.Certificate, error) {
+		return certs.MimicTLSCert(target, ca)
+	})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// DialUpstream connects to the target of pr, through an upstream proxy if one is configured for it.
+// https targets are dialed over TLS.
+func (p *RequestService) DialUpstream(ctx context.Context, pr *domain.HTTPRequest) (conn net.Conn, err error) {
+	if pr.Scheme == "https" {
+		return p.DialUpstreamTLS(ctx, pr, &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ServerName: pr.Host,
+		})
+	}
+
+	return p.DialUpstreamTCP(ctx, pr)
+}
+
+// DialUpstreamTCP is like DialUpstream, but never performs a TLS handshake
+func (p *RequestService) DialUpstreamTCP(ctx context.Context, pr *domain.HTTPRequest) (conn net.Conn, err error) {
+	return p.upstream.DialContext(ctx, "tcp", pr.GetFullHost())
+}
+
+// DialUpstreamTLS is like DialUpstream, but always performs a TLS handshake with tlsCfg
+func (p *RequestService) DialUpstreamTLS(ctx context.Context, pr *domain.HTTPRequest, tlsCfg *tls.Config) (sconn *tls.Conn, err error) {
+	conn, err := p.DialUpstreamTCP(ctx, pr)
+	if err != nil {
+		return
+	}
+
+	if tlsCfg.ServerName == "" {
+		tlsCfg = tlsCfg.Clone()
+		tlsCfg.ServerName = pr.Host
+	}
+
+	// The handshake is reported like http.Transport does, so dials are timed the same way
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+
+	sconn = tls.Client(conn, p.withClientCertificate(tlsCfg, tlsCfg.ServerName))
+	err = sconn.HandshakeContext(ctx)
+
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(sconn.ConnectionState(), err)
+	}
+
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	return
+}
+
+// withClientCertificate makes cfg present the client certificate configured for host, if there is one
+func (p *RequestService) withClientCertificate(cfg *tls.Config, host string) *tls.Config {
+	return presentingCertificate(cfg, p.clientCerts.GetClientCertificate(host))
+}
+
+// presentingCertificate makes cfg present cert as the client certificate, if it is set
+func presentingCertificate(cfg *tls.Config, cert *tls.Certificate) *tls.Config {
+	if cert == nil {
+		return cfg
+	}
+
+	// Unlike Certificates, the callback sends the certificate even if its issuer
+	// is not among the CAs accepted by the server
+	cfg = cfg.Clone()
+	cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return cert, nil
+	}
+
+	return cfg
+}
+
+// GetTLSCert returns a certificate for host signed by the CA, reusing cached ones
+func (p *RequestService) GetTLSCert(ctx context.Context, host string) (cert *tls.Certificate, err error) {
+	name := strings.ToLower(host)
+	if p.wildcardCerts {
+		name = certs.WildcardName(name)
+	}
+
+	// Certificates signed by a rotated CA are not reused
+	ca := p.ca.GetCA()
+	cert, err = p.certCache.Get(ca.Leaf.SerialNumber.Text(16)+"/"+name, func() (*tls.Certificate, error) {
+		return certs.SignTLSCert(name, ca)
+	})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (p *RequestService) SaveRequest(ctx context.Context, r *domain.HTTPRequest) (newReq *domain.HTTPRequest, err error) {
+	newReq, err = p.reqS.SaveRequest(ctx, r)
+	if err != nil {
+		log.Println("error saving request: ", err)
+		return
+	}
+
+	return
+}
+
+// GetRequestsList returns a page of the requests matching filter. With InScope set
+// only requests in the current scope are listed.
+func (p *RequestService) GetRequestsList(ctx context.Context, filter *domain.RequestsFilter) (page *domain.RequestsPage, err error) {
+	if filter.InScope {
+		filter.Scope, err = p.scope.GetScope(ctx)
+		if err != nil {
+			return
+		}
+	}
+
+	page, err = p.reqS.GetRequestsList(ctx, filter)
+	if err != nil {
+		log.Println("error getting requests list: ", err)
+		return
+	}
+
+	return
+}
+
+func (p *RequestService) InScope(ctx context.Context, req *domain.HTTPRequest) bool {
+	return p.scope.InScope(ctx, req)
+}
+
+// ParseHTTPResponse reads the response keeping its body as received and decoding it from
+// Content-Encoding. Bodies in unsupported codings are kept encoded. Bodies over the capture
+// limit, as received or decoded, are truncated and passed on in BodyStream.
+func (r *RequestService) ParseHTTPResponse(ctx context.Context, resp *http.Response) (*domain.HTTPResponse, error) {
+	rawBody, err := io.ReadAll(io.LimitReader(resp.Body, r.captureLimit+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	// Create the HTTPResponse struct
+	httpResponse := &domain.HTTPResponse{
+		Proto:      resp.Proto,
+		Code:       resp.StatusCode,
+		Message:    resp.Status,
+		Headers:    make(map[string][]string),
+		Body:       rawBody,
+		RawBody:    rawBody,
+		BodyLength: int64(len(rawBody)),
+	}
+
+	// Copy headers
+	for key, values := range resp.Header {
+		httpResponse.Headers[key] = values
+	}
+
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		httpResponse.Charset = strings.ToLower(params["charset"])
+	}
+
+	if int64(len(rawBody)) > r.captureLimit {
+		// A truncated body cannot be decoded, so it is kept as received
+		httpResponse.RawBody = rawBody[:r.captureLimit]
+		httpResponse.Body = httpResponse.RawBody
+		httpResponse.Truncated = true
+		httpResponse.BodyStream = newStreamedBody(&httpResponse.BodyLength, rawBody, resp.Body)
+
+		return httpResponse, nil
+	}
+	resp.Body.Close()
+
+	if contentEncoding := strings.Join(resp.Header.Values("Content-Encoding"), ","); contentEncoding != "" {
+		body, truncated, err := contentcoding.Decode(contentEncoding, rawBody, r.captureLimit)
+		if err != nil {
+			log.Println("error decoding response body: ", err)
+		} else {
+			httpResponse.Body = body
+			httpResponse.ContentEncoding = contentEncoding
+		}
+
+		// The decoded body is cut short, so the client gets the body as received
+		if truncated {
+			httpResponse.Truncated = true
+			httpResponse.BodyStream = io.NopCloser(bytes.NewReader(rawBody))
+		}
+	}
+
+	return httpResponse, nil
+}
+
+func (r *RequestService) SaveHTTPResponse(ctx context.Context, resp *domain.HTTPResponse, req *domain.HTTPRequest) (savedResp *domain.HTTPResponse, err error) {
+	resp.RequestID = req.ID
+
+	savedResp, err = r.resS.SaveResponse(ctx, resp)
+	if err != nil {
+		return
+	}
+
+	err = r.reqS.SetRequestResponse(ctx, req.ID, resp)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (r *RequestService) GetRequestByID(ctx context.Context, reqID string) (req *domain.HTTPRequest, err error) {
+	req, err = r.reqS.GetRequestByID(ctx, reqID)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// GetRequestWithResponse returns the request together with the first response saved for it, if any
+func (r *RequestService) GetRequestWithResponse(ctx context.Context, reqID string) (req *domain.HTTPRequest, err error) {
+	req, err = r.GetRequestByID(ctx, reqID)
+	if err != nil {
+		return
+	}
+
+	req.Response, err = r.resS.GetResponseByRequestID(ctx, reqID)
+	if errors.Is(err, customerrors.ErrNotFound) {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (r *RequestService) RepeatRequestByID(ctx context.Context, reqID string) (res *domain.HTTPResponse, err error) {
+	req, err := r.GetRequestByID(ctx, reqID)
+	if err != nil {
+		return
+	}
+
+	res, err = r.SendHTTPRequest(ctx, req)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (r *RequestService) isCommandInjectionVulnerable(resp *domain.HTTPResponse) bool {
+	return bytes.Contains(resp.Body, []byte(commandInjectionCheckString))
+}
+
+func copySyncMapIntoStringArrMap(sm *sync.Map) (rm map[string][]string) {
+	rm = make(map[string][]string, 0)
+	sm.Range(func(key any, value any) bool {
+		rm[key.(string)] = value.([]string)
+		return true
+	})
+
+	return
+}
+
+func copySyncMapIntoStringMap(sm *sync.Map) (rm map[string]string) {
+	rm = make(map[string]string, 0)
+	sm.Range(func(key any, value any) bool {
+		rm[key.(string)] = value.(string)
+		return true
+	})
+
+	return
+}
+
+// ScanRequestWithCommandInjection scans request with ID=reqID, sequentially pasting Command Injection
+// variations into every Header, Cookie, Get param and FormData field.
+// It returns unsafeReq of type *domain.HTTPRequest, fields of which contain only values that are penetrated by injection.
+func (r *RequestService) ScanRequestWithCommandInjection(ctx context.Context, reqID string) (unsafeReq *domain.HTTPRequest, err error) {
+	req, err := r.reqS.GetRequestByID(ctx, reqID)
+	if err != nil {
+		return
+	}
+
+	if !r.scope.InScope(ctx, req) {
+		err = customerrors.ErrOutOfScope
+		return
+	}
+
+	unsafeR := *req
+	ci := SafeInjections{
+		mu: &sync.RWMutex{},
+		ci: commandInjectionScans,
+	}
+
+	headers := &sync.Map{}
+	cookies := &sync.Map{}
+	getParams := &sync.Map{}
+	postParams := &sync.Map{}
+
+	safeR := domain.MakeSafeHTTPRequest(&unsafeR)
+
+	globalWg := &sync.WaitGroup{}
+	globalWg.Add(4)
+
+	go r.scanHeadersWorker(ctx, globalWg, safeR, ci, headers)
+	go r.scanCookiesWorker(ctx, globalWg, safeR, ci, cookies)
+	go r.scanGetParamsWorker(ctx, globalWg, safeR, ci, getParams)
+	go r.scanPostParamsWorker(ctx, globalWg, safeR, ci, postParams)
+
+	globalWg.Wait()
+
+	unsafeReq = &unsafeR
+
+	unsafeReq.Headers = copySyncMapIntoStringArrMap(headers)
+	unsafeReq.GetParams = copySyncMapIntoStringArrMap(getParams)
+	unsafeReq.PostParams = copySyncMapIntoStringArrMap(postParams)
+	unsafeReq.Cookies = copySyncMapIntoStringMap(cookies)
+
+	return
+}
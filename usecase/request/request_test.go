@@ -0,0 +1,109 @@
+package request
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseHTTPRequestBody(t *testing.T) {
+	tests := []struct {
+		name            string
+		raw             string
+		wantBody        string
+		wantSent        string
+		wantTruncated   bool
+		wantLength      int64
+		wantFinalLength int64
+		wantPostParams  map[string][]string
+	}{
+		{
+			name: "body within the limit is kept and parsed as a form",
+			raw: "POST /f HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"Content-Type: application/x-www-form-urlencoded\r\n" +
+				"Content-Length: 7\r\n\r\n" +
+				"a=1&b=2",
+			wantBody:        "a=1&b=2",
+			wantSent:        "a=1&b=2",
+			wantLength:      7,
+			wantFinalLength: 7,
+			wantPostParams:  map[string][]string{"a": {"1"}, "b": {"2"}},
+		},
+		{
+			name: "body over the limit is truncated and not parsed",
+			raw: "POST /f HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"Content-Type: application/x-www-form-urlencoded\r\n" +
+				"Content-Length: 15\r\n\r\n" +
+				"a=1&b=2&c=3&d=4",
+			wantBody:        "a=1&b=2&c=",
+			wantSent:        "a=1&b=2&c=3&d=4",
+			wantTruncated:   true,
+			wantLength:      15,
+			wantFinalLength: 15,
+		},
+		{
+			name: "chunked body over the limit gets its length once streamed",
+			raw: "POST /u HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"Transfer-Encoding: chunked\r\n\r\n" +
+				"8\r\n01234567\r\n6\r\n89abcd\r\n0\r\n\r\n",
+			wantBody:        "0123456789",
+			wantSent:        "0123456789abcd",
+			wantTruncated:   true,
+			wantLength:      -1,
+			wantFinalLength: 14,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpReq, err := http.ReadRequest(bufio.NewReader(strings.NewReader(tt.raw)))
+			if err != nil {
+				t.Fatalf("reading request: %v", err)
+			}
+			req, err := (&RequestService{captureLimit: 10}).ParseHTTPRequest(context.Background(), httpReq)
+			if err != nil {
+				t.Fatalf("ParseHTTPRequest() error = %v", err)
+			}
+
+			if string(req.Body) != tt.wantBody || req.Truncated != tt.wantTruncated || req.BodyLength != tt.wantLength {
+				t.Errorf("body = %q truncated %v length %d, want %q truncated %v length %d",
+					req.Body, req.Truncated, req.BodyLength, tt.wantBody, tt.wantTruncated, tt.wantLength)
+			}
+
+			if len(req.PostParams) != len(tt.wantPostParams) {
+				t.Errorf("PostParams = %v, want %v", req.PostParams, tt.wantPostParams)
+			}
+			for key, values := range tt.wantPostParams {
+				if !slices.Equal(req.PostParams[key], values) {
+					t.Errorf("PostParams = %v, want %v", req.PostParams, tt.wantPostParams)
+				}
+			}
+
+			if (req.BodyStream != nil) != tt.wantTruncated {
+				t.Fatalf("BodyStream set = %v, want %v", req.BodyStream != nil, tt.wantTruncated)
+			}
+
+			// The request is sent on with the whole body either way
+			sent, err := io.ReadAll(httpReq.Body)
+			if err != nil {
+				t.Fatalf("reading body: %v", err)
+			}
+			httpReq.Body.Close()
+
+			if string(sent) != tt.wantSent {
+				t.Errorf("sent body = %q, want %q", sent, tt.wantSent)
+			}
+
+			if req.BodyLength != tt.wantFinalLength {
+				t.Errorf("BodyLength after sending = %d, want %d", req.BodyLength, tt.wantFinalLength)
+			}
+		})
+	}
+}
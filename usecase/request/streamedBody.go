@@ -0,0 +1,59 @@
+package request
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/burp_junior/domain"
+)
+
+// streamedBody passes on a body over the capture limit. The bytes read while capturing
+// are replayed first, and the full length is recorded in length once it is closed.
+type streamedBody struct {
+	r       io.Reader
+	body    io.ReadCloser
+	length  *int64
+	n       int64
+	once    *sync.Once
+	onClose []func()
+}
+
+func newStreamedBody(length *int64, read []byte, body io.ReadCloser) *streamedBody {
+	return &streamedBody{
+		r:      io.MultiReader(bytes.NewReader(read), body),
+		body:   body,
+		length: length,
+		once:   &sync.Once{},
+	}
+}
+
+func (s *streamedBody) Read(p []byte) (n int, err error) {
+	n, err = s.r.Read(p)
+	s.n += int64(n)
+	return
+}
+
+func (s *streamedBody) Close() (err error) {
+	err = s.body.Close()
+
+	s.once.Do(func() {
+		*s.length = s.n
+		for _, fn := range s.onClose {
+			fn()
+		}
+	})
+
+	return
+}
+
+// afterBody calls fn once the body of res has been received in full: right away,
+// or when BodyStream is closed for bodies over the capture limit
+func afterBody(res *domain.HTTPResponse, fn func()) {
+	if stream, ok := res.BodyStream.(*streamedBody); ok {
+		stream.onClose = append(stream.onClose, fn)
+		return
+	}
+
+	fn()
+}
@@ -0,0 +1,359 @@
+package rules
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+)
+
+type RulesStorage interface {
+	SaveRule(ctx context.Context, rule *domain.ReplaceRule) (savedRule *domain.ReplaceRule, err error)
+	GetRulesList(ctx context.Context) (rules []*domain.ReplaceRule, err error)
+	GetRuleByID(ctx context.Context, id string) (rule *domain.ReplaceRule, err error)
+	UpdateRule(ctx context.Context, rule *domain.ReplaceRule) (updatedRule *domain.ReplaceRule, err error)
+	DeleteRule(ctx context.Context, id string) (err error)
+}
+
+type compiledRule struct {
+	rule *domain.ReplaceRule
+	re   *regexp.Regexp
+}
+
+// RulesService manages match-and-replace rules and applies them to proxied traffic.
+// Enabled rules are kept compiled in memory and reloaded after every change.
+type RulesService struct {
+	mu    *sync.RWMutex
+	ruleS RulesStorage
+	rules []*compiledRule
+}
+
+func NewRulesService(ctx context.Context, ruleS RulesStorage) (s *RulesService, err error) {
+	s = &RulesService{
+		mu:    &sync.RWMutex{},
+		ruleS: ruleS,
+	}
+
+	err = s.reload(ctx)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func compileRule(rule *domain.ReplaceRule) (c *compiledRule, err error) {
+	if !rule.IsRequestRule() && !rule.IsResponseRule() {
+		err = customerrors.ErrInvalidRequest
+		return
+	}
+
+	c = &compiledRule{
+		rule: rule,
+	}
+
+	if rule.IsRegex {
+		c.re, err = regexp.Compile(rule.Match)
+		if err != nil {
+			err = customerrors.ErrInvalidRequest
+			return
+		}
+	}
+
+	return
+}
+
+func (s *RulesService) reload(ctx context.Context) (err error) {
+	rules, err := s.ruleS.GetRulesList(ctx)
+	if err != nil {
+		return
+	}
+
+	compiled := make([]*compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+
+		c, err := compileRule(rule)
+		if err != nil {
+			log.Println("skipping invalid rule ", rule.ID, ": ", err)
+			continue
+		}
+
+		compiled = append(compiled, c)
+	}
+
+	s.mu.Lock()
+	s.rules = compiled
+	s.mu.Unlock()
+
+	return
+}
+
+func (s *RulesService) GetRulesList(ctx context.Context) (rules []*domain.ReplaceRule, err error) {
+	return s.ruleS.GetRulesList(ctx)
+}
+
+func (s *RulesService) GetRuleByID(ctx context.Context, id string) (rule *domain.ReplaceRule, err error) {
+	return s.ruleS.GetRuleByID(ctx, id)
+}
+
+func (s *RulesService) CreateRule(ctx context.Context, rule *domain.ReplaceRule) (savedRule *domain.ReplaceRule, err error) {
+	_, err = compileRule(rule)
+	if err != nil {
+		return
+	}
+
+	rule.ID = ""
+	savedRule, err = s.ruleS.SaveRule(ctx, rule)
+	if err != nil {
+		return
+	}
+
+	err = s.reload(ctx)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (s *RulesService) UpdateRule(ctx context.Context, rule *domain.ReplaceRule) (updatedRule *domain.ReplaceRule, err error) {
+	_, err = compileRule(rule)
+	if err != nil {
+		return
+	}
+
+	updatedRule, err = s.ruleS.UpdateRule(ctx, rule)
+	if err != nil {
+		return
+	}
+
+	err = s.reload(ctx)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (s *RulesService) DeleteRule(ctx context.Context, id string) (err error) {
+	err = s.ruleS.DeleteRule(ctx, id)
+	if err != nil {
+		return
+	}
+
+	err = s.reload(ctx)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// ApplyRequestRules rewrites req in place. modified reports whether any rule changed it.
+func (s *RulesService) ApplyRequestRules(ctx context.Context, req *domain.HTTPRequest) (modified bool, err error) {
+	for _, c := range s.matchingRules(true) {
+		switch c.rule.Target {
+		case domain.RuleTargetRequestHeader:
+			req.Headers, modified = applyToHeaders(c, req.Headers, modified)
+		case domain.RuleTargetRequestCookie:
+			req.Cookies, modified = applyToCookies(c, req.Cookies, modified)
+		case domain.RuleTargetRequestParam:
+			req.GetParams, modified = applyToParams(c, req.GetParams, modified)
+			// New params are only added to the query string
+			if c.rule.Match != "" {
+				req.PostParams, modified = applyToParams(c, req.PostParams, modified)
+			}
+		case domain.RuleTargetRequestBody:
+			body := c.replace(string(req.Body))
+			if body != string(req.Body) {
+				req.Body = []byte(body)
+				req.PostParams = reparseForm(req.PostParams, body)
+				modified = true
+			}
+		}
+	}
+
+	return
+}
+
+// reparseForm returns the post params of a rewritten form body. Requests are sent with
+// a body rebuilt from post params that no longer match it, so they have to follow the body.
+// A body that is no longer a form has no params and is sent as rewritten.
+func reparseForm(params map[string][]string, body string) map[string][]string {
+	if len(params) == 0 {
+		return params
+	}
+
+	form, err := url.ParseQuery(body)
+	if err != nil {
+		return nil
+	}
+
+	return form
+}
+
+// ApplyResponseRules rewrites res in place. modified reports whether any rule changed it.
+func (s *RulesService) ApplyResponseRules(ctx context.Context, res *domain.HTTPResponse) (modified bool, err error) {
+	for _, c := range s.matchingRules(false) {
+		switch c.rule.Target {
+		case domain.RuleTargetResponseHeader:
+			res.Headers, modified = applyToHeaders(c, res.Headers, modified)
+		case domain.RuleTargetResponseStatus:
+			status := c.replace(res.Message)
+			if status == res.Message {
+				continue
+			}
+
+			res.Message = status
+			if code, err := strconv.Atoi(strings.Fields(status + " ")[0]); err == nil {
+				res.Code = code
+			}
+			modified = true
+		case domain.RuleTargetResponseBody:
+			body := c.replace(string(res.Body))
+			if body != string(res.Body) {
+				res.Body = []byte(body)
+				modified = true
+			}
+		}
+	}
+
+	return
+}
+
+func (s *RulesService) matchingRules(request bool) (rules []*compiledRule) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, c := range s.rules {
+		if c.rule.IsRequestRule() == request {
+			rules = append(rules, c)
+		}
+	}
+
+	return
+}
+
+func (c *compiledRule) replace(s string) string {
+	if c.re != nil {
+		return c.re.ReplaceAllString(s, c.rule.Replace)
+	}
+
+	if c.rule.Match == "" {
+		return s
+	}
+
+	return strings.ReplaceAll(s, c.rule.Match, c.rule.Replace)
+}
+
+// applyToEntries runs the rule over every entry. Empty Match appends Replace as a new entry,
+// entries replaced with an empty string are removed.
+func (c *compiledRule) applyToEntries(entries []string) (result []string, modified bool) {
+	if c.rule.Match == "" {
+		if c.rule.Replace == "" {
+			return entries, false
+		}
+
+		return append(entries, c.rule.Replace), true
+	}
+
+	result = make([]string, 0, len(entries))
+	for _, entry := range entries {
+		replaced := c.replace(entry)
+		if replaced != entry {
+			modified = true
+		}
+
+		if replaced != "" {
+			result = append(result, replaced)
+		}
+	}
+
+	return
+}
+
+func applyToHeaders(c *compiledRule, headers map[string][]string, modified bool) (map[string][]string, bool) {
+	lines := make([]string, 0, len(headers))
+	for _, key := range sortedKeys(headers) {
+		for _, value := range headers[key] {
+			lines = append(lines, key+": "+value)
+		}
+	}
+
+	lines, changed := c.applyToEntries(lines)
+	if !changed {
+		return headers, modified
+	}
+
+	result := make(map[string][]string, len(lines))
+	for _, line := range lines {
+		key, value, _ := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		result[key] = append(result[key], strings.TrimSpace(value))
+	}
+
+	return result, true
+}
+
+func applyToCookies(c *compiledRule, cookies map[string]string, modified bool) (map[string]string, bool) {
+	pairs := make([]string, 0, len(cookies))
+	for _, name := range sortedKeys(cookies) {
+		pairs = append(pairs, cookies[name])
+	}
+
+	pairs, changed := c.applyToEntries(pairs)
+	if !changed {
+		return cookies, modified
+	}
+
+	result := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		name, _, _ := strings.Cut(pair, "=")
+		result[strings.TrimSpace(name)] = pair
+	}
+
+	return result, true
+}
+
+func applyToParams(c *compiledRule, params map[string][]string, modified bool) (map[string][]string, bool) {
+	pairs := make([]string, 0, len(params))
+	for _, key := range sortedKeys(params) {
+		for _, value := range params[key] {
+			pairs = append(pairs, key+"="+value)
+		}
+	}
+
+	pairs, changed := c.applyToEntries(pairs)
+	if !changed {
+		return params, modified
+	}
+
+	result := make(map[string][]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, _ := strings.Cut(pair, "=")
+		result[key] = append(result[key], value)
+	}
+
+	return result, true
+}
+
+func sortedKeys[V any](m map[string]V) (keys []string) {
+	keys = make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return
+}
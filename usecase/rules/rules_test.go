@@ -0,0 +1,415 @@
+package rules
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/burp_junior/domain"
+)
+
+func mustCompile(t *testing.T, rule *domain.ReplaceRule) *compiledRule {
+	t.Helper()
+
+	c, err := compileRule(rule)
+	if err != nil {
+		t.Fatalf("compileRule() error = %v", err)
+	}
+
+	return c
+}
+
+func TestApplyToHeaders(t *testing.T) {
+	headers := map[string][]string{
+		"Accept":     {"*/*"},
+		"User-Agent": {"curl/8.0"},
+		"X-Dup":      {"1", "2"},
+	}
+
+	tests := []struct {
+		name         string
+		rule         *domain.ReplaceRule
+		want         map[string][]string
+		wantModified bool
+	}{
+		{
+			name: "value is replaced",
+			rule: &domain.ReplaceRule{Match: "curl/8.0", Replace: "Mozilla/5.0"},
+			want: map[string][]string{
+				"Accept":     {"*/*"},
+				"User-Agent": {"Mozilla/5.0"},
+				"X-Dup":      {"1", "2"},
+			},
+			wantModified: true,
+		},
+		{
+			name: "regex with groups over whole lines",
+			rule: &domain.ReplaceRule{Match: `^X-Dup: (\d)$`, Replace: "X-Dup: n$1", IsRegex: true},
+			want: map[string][]string{
+				"Accept":     {"*/*"},
+				"User-Agent": {"curl/8.0"},
+				"X-Dup":      {"n1", "n2"},
+			},
+			wantModified: true,
+		},
+		{
+			name: "header replaced with nothing is removed",
+			rule: &domain.ReplaceRule{Match: `^User-Agent: .*$`, IsRegex: true},
+			want: map[string][]string{
+				"Accept": {"*/*"},
+				"X-Dup":  {"1", "2"},
+			},
+			wantModified: true,
+		},
+		{
+			name: "empty match adds a header",
+			rule: &domain.ReplaceRule{Replace: "X-Added: yes"},
+			want: map[string][]string{
+				"Accept":     {"*/*"},
+				"User-Agent": {"curl/8.0"},
+				"X-Dup":      {"1", "2"},
+				"X-Added":    {"yes"},
+			},
+			wantModified: true,
+		},
+		{
+			name: "empty match and replace do nothing",
+			rule: &domain.ReplaceRule{},
+			want: headers,
+		},
+		{
+			name: "no match",
+			rule: &domain.ReplaceRule{Match: "missing", Replace: "x"},
+			want: headers,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Target = domain.RuleTargetRequestHeader
+
+			got, modified := applyToHeaders(mustCompile(t, tt.rule), headers, false)
+			if !reflect.DeepEqual(got, tt.want) || modified != tt.wantModified {
+				t.Errorf("applyToHeaders() = %v, %v, want %v, %v", got, modified, tt.want, tt.wantModified)
+			}
+
+			// An earlier change is kept even if this rule changes nothing
+			if _, modified = applyToHeaders(mustCompile(t, tt.rule), headers, true); !modified {
+				t.Error("applyToHeaders() dropped an earlier change")
+			}
+		})
+	}
+}
+
+func TestApplyToCookies(t *testing.T) {
+	cookies := map[string]string{
+		"sid":   "sid=abc",
+		"theme": "theme=dark",
+	}
+
+	tests := []struct {
+		name         string
+		rule         *domain.ReplaceRule
+		want         map[string]string
+		wantModified bool
+	}{
+		{
+			name:         "value is replaced",
+			rule:         &domain.ReplaceRule{Match: "sid=abc", Replace: "sid=xyz"},
+			want:         map[string]string{"sid": "sid=xyz", "theme": "theme=dark"},
+			wantModified: true,
+		},
+		{
+			name:         "renamed cookie moves to its new name",
+			rule:         &domain.ReplaceRule{Match: `^theme=`, Replace: "mode=", IsRegex: true},
+			want:         map[string]string{"sid": "sid=abc", "mode": "mode=dark"},
+			wantModified: true,
+		},
+		{
+			name:         "cookie replaced with nothing is removed",
+			rule:         &domain.ReplaceRule{Match: "theme=dark"},
+			want:         map[string]string{"sid": "sid=abc"},
+			wantModified: true,
+		},
+		{
+			name:         "empty match adds a cookie",
+			rule:         &domain.ReplaceRule{Replace: "debug=1"},
+			want:         map[string]string{"sid": "sid=abc", "theme": "theme=dark", "debug": "debug=1"},
+			wantModified: true,
+		},
+		{
+			name: "no match",
+			rule: &domain.ReplaceRule{Match: "missing", Replace: "x"},
+			want: cookies,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Target = domain.RuleTargetRequestCookie
+
+			got, modified := applyToCookies(mustCompile(t, tt.rule), cookies, false)
+			if !reflect.DeepEqual(got, tt.want) || modified != tt.wantModified {
+				t.Errorf("applyToCookies() = %v, %v, want %v, %v", got, modified, tt.want, tt.wantModified)
+			}
+		})
+	}
+}
+
+func TestApplyToParams(t *testing.T) {
+	params := map[string][]string{
+		"id":  {"1", "2"},
+		"tag": {"a"},
+	}
+
+	tests := []struct {
+		name         string
+		rule         *domain.ReplaceRule
+		want         map[string][]string
+		wantModified bool
+	}{
+		{
+			name:         "one of repeated values is replaced",
+			rule:         &domain.ReplaceRule{Match: "id=2", Replace: "id=3"},
+			want:         map[string][]string{"id": {"1", "3"}, "tag": {"a"}},
+			wantModified: true,
+		},
+		{
+			name:         "regex over every pair",
+			rule:         &domain.ReplaceRule{Match: `=(\w+)$`, Replace: "=${1}0", IsRegex: true},
+			want:         map[string][]string{"id": {"10", "20"}, "tag": {"a0"}},
+			wantModified: true,
+		},
+		{
+			name:         "param replaced with nothing is removed",
+			rule:         &domain.ReplaceRule{Match: `^tag=.*$`, IsRegex: true},
+			want:         map[string][]string{"id": {"1", "2"}},
+			wantModified: true,
+		},
+		{
+			name:         "empty match adds a param",
+			rule:         &domain.ReplaceRule{Replace: "debug=1"},
+			want:         map[string][]string{"id": {"1", "2"}, "tag": {"a"}, "debug": {"1"}},
+			wantModified: true,
+		},
+		{
+			name: "no match",
+			rule: &domain.ReplaceRule{Match: "missing", Replace: "x"},
+			want: params,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Target = domain.RuleTargetRequestParam
+
+			got, modified := applyToParams(mustCompile(t, tt.rule), params, false)
+			if !reflect.DeepEqual(got, tt.want) || modified != tt.wantModified {
+				t.Errorf("applyToParams() = %v, %v, want %v, %v", got, modified, tt.want, tt.wantModified)
+			}
+		})
+	}
+}
+
+func TestReparseForm(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string][]string
+		body   string
+		want   map[string][]string
+	}{
+		{
+			name:   "body that was not a form stays without params",
+			params: nil,
+			body:   "a=1",
+			want:   nil,
+		},
+		{
+			name:   "params follow the rewritten form",
+			params: map[string][]string{"a": {"1"}},
+			body:   "a=2&b=x%20y",
+			want:   map[string][]string{"a": {"2"}, "b": {"x y"}},
+		},
+		{
+			name:   "body that is no longer a form has no params",
+			params: map[string][]string{"a": {"1"}},
+			body:   "a=%zz",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := reparseForm(tt.params, tt.body)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reparseForm() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestService returns a service applying rules, without a storage
+func newTestService(t *testing.T, rules ...*domain.ReplaceRule) *RulesService {
+	t.Helper()
+
+	s := &RulesService{mu: &sync.RWMutex{}}
+	for _, rule := range rules {
+		s.rules = append(s.rules, mustCompile(t, rule))
+	}
+
+	return s
+}
+
+func TestApplyRequestRules(t *testing.T) {
+	tests := []struct {
+		name         string
+		rule         *domain.ReplaceRule
+		req          *domain.HTTPRequest
+		want         *domain.HTTPRequest
+		wantModified bool
+	}{
+		{
+			name: "form body rule rewrites post params",
+			rule: &domain.ReplaceRule{Target: domain.RuleTargetRequestBody, Match: "role=user", Replace: "role=admin"},
+			req: &domain.HTTPRequest{
+				Body:       []byte("name=a&role=user"),
+				PostParams: map[string][]string{"name": {"a"}, "role": {"user"}},
+			},
+			want: &domain.HTTPRequest{
+				Body:       []byte("name=a&role=admin"),
+				PostParams: map[string][]string{"name": {"a"}, "role": {"admin"}},
+			},
+			wantModified: true,
+		},
+		{
+			name: "new params go to the query string only",
+			rule: &domain.ReplaceRule{Target: domain.RuleTargetRequestParam, Replace: "debug=1"},
+			req: &domain.HTTPRequest{
+				GetParams:  map[string][]string{},
+				PostParams: map[string][]string{"a": {"1"}},
+			},
+			want: &domain.HTTPRequest{
+				GetParams:  map[string][]string{"debug": {"1"}},
+				PostParams: map[string][]string{"a": {"1"}},
+			},
+			wantModified: true,
+		},
+		{
+			name: "params are replaced in the query string and the form",
+			rule: &domain.ReplaceRule{Target: domain.RuleTargetRequestParam, Match: "id=1", Replace: "id=2"},
+			req: &domain.HTTPRequest{
+				GetParams:  map[string][]string{"id": {"1"}},
+				PostParams: map[string][]string{"id": {"1"}},
+			},
+			want: &domain.HTTPRequest{
+				GetParams:  map[string][]string{"id": {"2"}},
+				PostParams: map[string][]string{"id": {"2"}},
+			},
+			wantModified: true,
+		},
+		{
+			name: "response rules are not applied",
+			rule: &domain.ReplaceRule{Target: domain.RuleTargetResponseBody, Match: "a", Replace: "b"},
+			req:  &domain.HTTPRequest{Body: []byte("a")},
+			want: &domain.HTTPRequest{Body: []byte("a")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modified, err := newTestService(t, tt.rule).ApplyRequestRules(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("ApplyRequestRules() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(tt.req, tt.want) || modified != tt.wantModified {
+				t.Errorf("ApplyRequestRules() = %+v, %v, want %+v, %v", tt.req, modified, tt.want, tt.wantModified)
+			}
+		})
+	}
+}
+
+func TestApplyResponseRules(t *testing.T) {
+	tests := []struct {
+		name         string
+		rule         *domain.ReplaceRule
+		want         *domain.HTTPResponse
+		wantModified bool
+	}{
+		{
+			name: "status line sets the code",
+			rule: &domain.ReplaceRule{Target: domain.RuleTargetResponseStatus, Match: "403 Forbidden", Replace: "200 OK"},
+			want: &domain.HTTPResponse{
+				Code:    200,
+				Message: "200 OK",
+				Headers: map[string][]string{"X-Frame-Options": {"DENY"}},
+				Body:    []byte("denied"),
+			},
+			wantModified: true,
+		},
+		{
+			name: "status without a code keeps the old one",
+			rule: &domain.ReplaceRule{Target: domain.RuleTargetResponseStatus, Match: "403 ", Replace: ""},
+			want: &domain.HTTPResponse{
+				Code:    403,
+				Message: "Forbidden",
+				Headers: map[string][]string{"X-Frame-Options": {"DENY"}},
+				Body:    []byte("denied"),
+			},
+			wantModified: true,
+		},
+		{
+			name: "header",
+			rule: &domain.ReplaceRule{Target: domain.RuleTargetResponseHeader, Match: `^X-Frame-Options: .*$`, IsRegex: true},
+			want: &domain.HTTPResponse{
+				Code:    403,
+				Message: "403 Forbidden",
+				Headers: map[string][]string{},
+				Body:    []byte("denied"),
+			},
+			wantModified: true,
+		},
+		{
+			name: "body",
+			rule: &domain.ReplaceRule{Target: domain.RuleTargetResponseBody, Match: "denied", Replace: "allowed"},
+			want: &domain.HTTPResponse{
+				Code:    403,
+				Message: "403 Forbidden",
+				Headers: map[string][]string{"X-Frame-Options": {"DENY"}},
+				Body:    []byte("allowed"),
+			},
+			wantModified: true,
+		},
+		{
+			name: "request rules are not applied",
+			rule: &domain.ReplaceRule{Target: domain.RuleTargetRequestBody, Match: "denied", Replace: "allowed"},
+			want: &domain.HTTPResponse{
+				Code:    403,
+				Message: "403 Forbidden",
+				Headers: map[string][]string{"X-Frame-Options": {"DENY"}},
+				Body:    []byte("denied"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &domain.HTTPResponse{
+				Code:    403,
+				Message: "403 Forbidden",
+				Headers: map[string][]string{"X-Frame-Options": {"DENY"}},
+				Body:    []byte("denied"),
+			}
+
+			modified, err := newTestService(t, tt.rule).ApplyResponseRules(context.Background(), res)
+			if err != nil {
+				t.Fatalf("ApplyResponseRules() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(res, tt.want) || modified != tt.wantModified {
+				t.Errorf("ApplyResponseRules() = %+v, %v, want %+v, %v", res, modified, tt.want, tt.wantModified)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package scope
+
+import (
+	"context"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+)
+
+type ScopeStorage interface {
+	GetScope(ctx context.Context) (scope *domain.Scope, err error)
+	SaveScope(ctx context.Context, scope *domain.Scope) (err error)
+}
+
+type compiledScopeRule struct {
+	rule   domain.ScopeRule
+	pathRe *regexp.Regexp
+}
+
+// ScopeService decides which requests are recorded and may be scanned.
+// The current scope is kept compiled in memory and persisted on every change.
+type ScopeService struct {
+	mu      *sync.RWMutex
+	scopeS  ScopeStorage
+	scope   *domain.Scope
+	include []*compiledScopeRule
+	exclude []*compiledScopeRule
+}
+
+func NewScopeService(ctx context.Context, scopeS ScopeStorage) (s *ScopeService, err error) {
+	s = &ScopeService{
+		mu:     &sync.RWMutex{},
+		scopeS: scopeS,
+	}
+
+	scope, err := scopeS.GetScope(ctx)
+	if err != nil {
+		return
+	}
+
+	err = s.setScope(scope)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func compileScopeRules(rules []domain.ScopeRule) (compiled []*compiledScopeRule, err error) {
+	compiled = make([]*compiledScopeRule, 0, len(rules))
+	for _, rule := range rules {
+		c := &compiledScopeRule{
+			rule: rule,
+		}
+
+		if _, err = path.Match(rule.HostPattern, ""); err != nil {
+			err = customerrors.ErrInvalidRequest
+			return
+		}
+
+		if rule.PathRegex != "" {
+			c.pathRe, err = regexp.Compile(rule.PathRegex)
+			if err != nil {
+				err = customerrors.ErrInvalidRequest
+				return
+			}
+		}
+
+		compiled = append(compiled, c)
+	}
+
+	return
+}
+
+func (s *ScopeService) setScope(scope *domain.Scope) (err error) {
+	include, err := compileScopeRules(scope.Include)
+	if err != nil {
+		return
+	}
+
+	exclude, err := compileScopeRules(scope.Exclude)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.scope = scope
+	s.include = include
+	s.exclude = exclude
+	s.mu.Unlock()
+
+	return
+}
+
+func (s *ScopeService) GetScope(ctx context.Context) (scope *domain.Scope, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scope = s.scope
+
+	return
+}
+
+func (s *ScopeService) SetScope(ctx context.Context, scope *domain.Scope) (err error) {
+	_, err = compileScopeRules(scope.Include)
+	if err != nil {
+		return
+	}
+
+	_, err = compileScopeRules(scope.Exclude)
+	if err != nil {
+		return
+	}
+
+	err = s.scopeS.SaveScope(ctx, scope)
+	if err != nil {
+		return
+	}
+
+	err = s.setScope(scope)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// InScope reports whether req matches any include rule (or there are none) and no exclude rule.
+func (s *ScopeService) InScope(ctx context.Context, req *domain.HTTPRequest) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.include) > 0 && !matchesAny(s.include, req) {
+		return false
+	}
+
+	return !matchesAny(s.exclude, req)
+}
+
+func matchesAny(rules []*compiledScopeRule, req *domain.HTTPRequest) bool {
+	for _, c := range rules {
+		if c.matches(req) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *compiledScopeRule) matches(req *domain.HTTPRequest) bool {
+	if c.rule.Scheme != "" && !strings.EqualFold(c.rule.Scheme, req.Scheme) {
+		return false
+	}
+
+	if c.rule.HostPattern != "" {
+		if ok, _ := path.Match(strings.ToLower(c.rule.HostPattern), strings.ToLower(req.Host)); !ok {
+			return false
+		}
+	}
+
+	if c.rule.Port != "" && c.rule.Port != req.Port {
+		return false
+	}
+
+	if c.rule.PathPrefix != "" && !strings.HasPrefix(req.Path, c.rule.PathPrefix) {
+		return false
+	}
+
+	if c.pathRe != nil && !c.pathRe.MatchString(req.Path) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,165 @@
+package scope
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+)
+
+type testScopeStorage struct {
+	scope *domain.Scope
+}
+
+func (m *testScopeStorage) GetScope(ctx context.Context) (scope *domain.Scope, err error) {
+	return m.scope, nil
+}
+
+func (m *testScopeStorage) SaveScope(ctx context.Context, scope *domain.Scope) (err error) {
+	m.scope = scope
+	return nil
+}
+
+func TestInScope(t *testing.T) {
+	req := &domain.HTTPRequest{
+		Scheme: "https",
+		Host:   "api.Example.com",
+		Port:   "443",
+		Path:   "/v1/users",
+	}
+
+	tests := []struct {
+		name  string
+		scope domain.Scope
+		want  bool
+	}{
+		{
+			name: "empty scope takes everything",
+			want: true,
+		},
+		{
+			name:  "host glob is case insensitive",
+			scope: domain.Scope{Include: []domain.ScopeRule{{HostPattern: "*.example.COM"}}},
+			want:  true,
+		},
+		{
+			name:  "glob does not match the bare domain",
+			scope: domain.Scope{Include: []domain.ScopeRule{{HostPattern: "*.api.example.com"}}},
+			want:  false,
+		},
+		{
+			name:  "scheme is case insensitive",
+			scope: domain.Scope{Include: []domain.ScopeRule{{Scheme: "HTTPS"}}},
+			want:  true,
+		},
+		{
+			name:  "other scheme",
+			scope: domain.Scope{Include: []domain.ScopeRule{{Scheme: "http"}}},
+			want:  false,
+		},
+		{
+			name:  "other port",
+			scope: domain.Scope{Include: []domain.ScopeRule{{HostPattern: "*.example.com", Port: "8443"}}},
+			want:  false,
+		},
+		{
+			name:  "path prefix",
+			scope: domain.Scope{Include: []domain.ScopeRule{{PathPrefix: "/v1/"}}},
+			want:  true,
+		},
+		{
+			name:  "path regex",
+			scope: domain.Scope{Include: []domain.ScopeRule{{PathRegex: `^/v2/`}}},
+			want:  false,
+		},
+		{
+			name: "every field of a rule has to match",
+			scope: domain.Scope{Include: []domain.ScopeRule{
+				{Scheme: "https", HostPattern: "api.example.com", PathPrefix: "/admin"},
+			}},
+			want: false,
+		},
+		{
+			name: "any include rule is enough",
+			scope: domain.Scope{Include: []domain.ScopeRule{
+				{HostPattern: "other.com"},
+				{PathPrefix: "/v1"},
+			}},
+			want: true,
+		},
+		{
+			name: "exclude wins over include",
+			scope: domain.Scope{
+				Include: []domain.ScopeRule{{HostPattern: "*.example.com"}},
+				Exclude: []domain.ScopeRule{{PathRegex: `/users$`}},
+			},
+			want: false,
+		},
+		{
+			name:  "exclude alone keeps everything else",
+			scope: domain.Scope{Exclude: []domain.ScopeRule{{HostPattern: "ads.*"}}},
+			want:  true,
+		},
+		{
+			name:  "exclude alone drops its matches",
+			scope: domain.Scope{Exclude: []domain.ScopeRule{{Port: "443"}}},
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewScopeService(context.Background(), &testScopeStorage{scope: &tt.scope})
+			if err != nil {
+				t.Fatalf("NewScopeService() error = %v", err)
+			}
+
+			if got := s.InScope(context.Background(), req); got != tt.want {
+				t.Errorf("InScope() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetScope(t *testing.T) {
+	storage := &testScopeStorage{scope: &domain.Scope{}}
+	s, err := NewScopeService(context.Background(), storage)
+	if err != nil {
+		t.Fatalf("NewScopeService() error = %v", err)
+	}
+
+	req := &domain.HTTPRequest{Scheme: "http", Host: "example.com", Path: "/"}
+
+	invalid := []*domain.Scope{
+		{Include: []domain.ScopeRule{{HostPattern: "[example.com"}}},
+		{Exclude: []domain.ScopeRule{{PathRegex: "("}}},
+	}
+	for _, scope := range invalid {
+		if err := s.SetScope(context.Background(), scope); !errors.Is(err, customerrors.ErrInvalidRequest) {
+			t.Errorf("SetScope(%+v) error = %v, want %v", scope, err, customerrors.ErrInvalidRequest)
+		}
+	}
+
+	if storage.scope.Include != nil || storage.scope.Exclude != nil {
+		t.Errorf("invalid scope was saved: %+v", storage.scope)
+	}
+
+	if !s.InScope(context.Background(), req) {
+		t.Errorf("InScope() = false after rejected SetScope")
+	}
+
+	scope := &domain.Scope{Include: []domain.ScopeRule{{HostPattern: "*.test"}}}
+	if err := s.SetScope(context.Background(), scope); err != nil {
+		t.Fatalf("SetScope() error = %v", err)
+	}
+
+	if storage.scope != scope {
+		t.Errorf("saved scope = %+v, want %+v", storage.scope, scope)
+	}
+
+	if s.InScope(context.Background(), req) {
+		t.Errorf("InScope() = true, want false after the scope changed")
+	}
+}
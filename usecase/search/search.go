@@ -0,0 +1,350 @@
+package search
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/searchwords"
+)
+
+const (
+	// snippetContext is the number of bytes kept on each side of a match
+	snippetContext = 40
+	// maxSnippetsPerField bounds the snippets returned for a single part of an exchange
+	maxSnippetsPerField = 3
+)
+
+type ExchangeStorage interface {
+	EachExchange(ctx context.Context, query *domain.SearchQuery, fn func(req *domain.HTTPRequest) bool) (err error)
+}
+
+type ScopeProvider interface {
+	GetScope(ctx context.Context) (scope *domain.Scope, err error)
+}
+
+// SearchService finds exchanges containing a text in their requests or responses.
+// The storage looks exchanges up by the whole words the text contains in its index,
+// they are then matched here to check the text itself and to cut the snippets.
+type SearchService struct {
+	exchangeS ExchangeStorage
+	scope     ScopeProvider
+}
+
+func NewSearchService(exchangeS ExchangeStorage, scope ScopeProvider) *SearchService {
+	return &SearchService{
+		exchangeS: exchangeS,
+		scope:     scope,
+	}
+}
+
+// matcher finds the text of a query. Plain text is matched literally and only as whole
+// words: it neither starts nor ends inside a word, as it is looked up by whole words.
+type matcher struct {
+	re         *regexp.Regexp
+	wholeWords bool
+}
+
+// compileQuery returns the matcher of query
+func compileQuery(query *domain.SearchQuery) (m *matcher, err error) {
+	if query.Text == "" {
+		return nil, customerrors.ErrInvalidRequest
+	}
+
+	pattern := query.Text
+	if !query.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+
+	if !query.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, customerrors.ErrInvalidRequest
+	}
+
+	return &matcher{re: re, wholeWords: !query.Regex}, nil
+}
+
+// findAll returns the locations of at most n non-empty matches in data
+func (m *matcher) findAll(data []byte, n int) (locs [][]int) {
+	if !m.wholeWords {
+		for _, loc := range m.re.FindAllIndex(data, n) {
+			// Empty matches of patterns such as "a*" highlight nothing
+			if loc[0] != loc[1] {
+				locs = append(locs, loc)
+			}
+		}
+
+		return
+	}
+
+	for pos := 0; pos < len(data) && len(locs) < n; {
+		loc := m.re.FindIndex(data[pos:])
+		if loc == nil {
+			return
+		}
+
+		start, end := pos+loc[0], pos+loc[1]
+		if !wordEdges(data, start, end) {
+			// A match inside a word can still be followed by one starting in it
+			_, size := utf8.DecodeRune(data[start:])
+			pos = start + size
+			continue
+		}
+
+		locs = append(locs, []int{start, end})
+		pos = end
+	}
+
+	return
+}
+
+// wordEdges reports whether data[start:end] neither starts nor ends inside a word
+func wordEdges(data []byte, start int, end int) bool {
+	before, _ := utf8.DecodeLastRune(data[:start])
+	first, _ := utf8.DecodeRune(data[start:])
+	last, _ := utf8.DecodeLastRune(data[:end])
+	after, _ := utf8.DecodeRune(data[end:])
+
+	if searchwords.IsWordRune(before) && searchwords.IsWordRune(first) {
+		return false
+	}
+
+	return !(searchwords.IsWordRune(last) && searchwords.IsWordRune(after))
+}
+
+// queryWords returns the whole words every match of query contains. These are all words of
+// plain text, and the words of a regular expression in literal parts every match goes through,
+// with non-word characters of the literal, a word boundary or a line edge on both sides.
+func queryWords(query *domain.SearchQuery) (words []string, err error) {
+	if !query.Regex {
+		return searchwords.Words(query.Text), nil
+	}
+
+	re, err := syntax.Parse(query.Text, syntax.Perl)
+	if err != nil {
+		return nil, customerrors.ErrInvalidRequest
+	}
+
+	return regexWords(re.Simplify()), nil
+}
+
+func regexWords(re *syntax.Regexp) (words []string) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return literalWords(string(re.Rune), false, false)
+	case syntax.OpCapture, syntax.OpPlus:
+		return regexWords(re.Sub[0])
+	case syntax.OpConcat:
+		for i, sub := range re.Sub {
+			if sub.Op != syntax.OpLiteral {
+				words = append(words, regexWords(sub)...)
+				continue
+			}
+
+			before := i > 0 && boundsWord(re.Sub[i-1])
+			after := i < len(re.Sub)-1 && boundsWord(re.Sub[i+1])
+			words = append(words, literalWords(string(sub.Rune), before, after)...)
+		}
+	}
+
+	return
+}
+
+// boundsWord reports whether no word continues across where re matches. \b only knows
+// ASCII word characters, so a word running on into letters of other scripts is not found.
+func boundsWord(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpWordBoundary, syntax.OpBeginText, syntax.OpEndText, syntax.OpBeginLine, syntax.OpEndLine:
+		return true
+	}
+
+	return false
+}
+
+// literalWords returns the words of text that are whole wherever it matches, the ends
+// of text are word edges if before and after are set
+func literalWords(text string, before bool, after bool) (words []string) {
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if !searchwords.IsWordRune(r) {
+			i += size
+			continue
+		}
+
+		start := i
+		for i < len(text) {
+			r, size = utf8.DecodeRuneInString(text[i:])
+			if !searchwords.IsWordRune(r) {
+				break
+			}
+			i += size
+		}
+
+		if (start > 0 || before) && (i < len(text) || after) {
+			words = append(words, searchwords.Words(text[start:i])...)
+		}
+	}
+
+	return
+}
+
+func (s *SearchService) Search(ctx context.Context, query *domain.SearchQuery) (page *domain.SearchPage, err error) {
+	if query.Limit < 1 {
+		return nil, customerrors.ErrInvalidRequest
+	}
+
+	m, err := compileQuery(query)
+	if err != nil {
+		return
+	}
+
+	query.Words, err = queryWords(query)
+	if err != nil {
+		return
+	}
+
+	// Exchanges can only be looked up by words
+	if len(query.Words) == 0 {
+		return nil, customerrors.ErrInvalidRequest
+	}
+
+	fields := query.Fields
+	if len(fields) == 0 {
+		fields = domain.SearchFields
+	}
+
+	for _, field := range fields {
+		if !slices.Contains(domain.SearchFields, field) {
+			return nil, customerrors.ErrInvalidRequest
+		}
+	}
+
+	filter := query.Filter
+	if filter == nil {
+		filter = &domain.RequestsFilter{}
+	}
+
+	if filter.InScope {
+		filter.Scope, err = s.scope.GetScope(ctx)
+		if err != nil {
+			return
+		}
+	}
+
+	page = &domain.SearchPage{
+		Results: make([]*domain.SearchResult, 0),
+	}
+
+	// The storage loads only the parts of exchanges that are searched
+	query.Fields = fields
+	query.Filter = filter
+
+	err = s.exchangeS.EachExchange(ctx, query, func(req *domain.HTTPRequest) bool {
+		result := matchExchange(m, fields, req)
+		if result == nil {
+			return true
+		}
+
+		if len(page.Results) == query.Limit {
+			page.NextCursor = page.Results[len(page.Results)-1].RequestID
+			return false
+		}
+
+		page.Results = append(page.Results, result)
+		return true
+	})
+	if err != nil {
+		log.Println("error searching exchanges: ", err)
+		return
+	}
+
+	return
+}
+
+// matchExchange returns the snippets of the matches of m in fields of req, nil if there are none
+func matchExchange(m *matcher, fields []string, req *domain.HTTPRequest) (result *domain.SearchResult) {
+	for _, field := range fields {
+		data := fieldData(req, field)
+		if len(data) == 0 {
+			continue
+		}
+
+		for _, loc := range m.findAll(data, maxSnippetsPerField) {
+			if result == nil {
+				result = &domain.SearchResult{
+					RequestID: req.ID,
+				}
+
+				if req.Response != nil {
+					result.ResponseID = req.Response.ID
+				}
+			}
+
+			result.Snippets = append(result.Snippets, snippet(field, data, loc[0], loc[1]))
+		}
+	}
+
+	return
+}
+
+// fieldData returns the searchable contents of a part of the exchange
+func fieldData(req *domain.HTTPRequest, field string) []byte {
+	switch field {
+	case domain.SearchFieldPath:
+		return []byte(req.Path)
+	case domain.SearchFieldRequestHeaders:
+		return []byte(strings.Join(req.HeaderLines(), "\n"))
+	case domain.SearchFieldParams:
+		return []byte(strings.Join(req.ParamLines(), "\n"))
+	case domain.SearchFieldRequestBody:
+		return req.Body
+	case domain.SearchFieldResponseHeaders:
+		if req.Response == nil {
+			return nil
+		}
+		return []byte(strings.Join(domain.HeaderLines(req.Response.Headers), "\n"))
+	case domain.SearchFieldResponseBody:
+		if req.Response == nil {
+			return nil
+		}
+		return req.Response.Body
+	}
+
+	return nil
+}
+
+// snippet cuts the match data[start:end] out of data with up to snippetContext bytes
+// on each side, not splitting UTF-8 characters. Invalid UTF-8, e.g. of binary bodies,
+// is replaced, so the offsets refer to the snippet text rather than to data.
+func snippet(field string, data []byte, start int, end int) *domain.SearchSnippet {
+	from := max(start-snippetContext, 0)
+	for from > 0 && from < start && !utf8.RuneStart(data[from]) {
+		from++
+	}
+
+	to := min(end+snippetContext, len(data))
+	for to < len(data) && to > end && !utf8.RuneStart(data[to]) {
+		to--
+	}
+
+	before := strings.ToValidUTF8(string(data[from:start]), "�")
+	match := strings.ToValidUTF8(string(data[start:end]), "�")
+	after := strings.ToValidUTF8(string(data[end:to]), "�")
+
+	return &domain.SearchSnippet{
+		Field: field,
+		Text:  before + match + after,
+		Start: len(before),
+		End:   len(before) + len(match),
+	}
+}
@@ -0,0 +1,344 @@
+package search
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+)
+
+func TestCompileQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   *domain.SearchQuery
+		data    string
+		want    [][]int
+		wantErr bool
+	}{
+		{
+			name:  "plain text is case insensitive",
+			query: &domain.SearchQuery{Text: "Token"},
+			data:  "a TOKEN b token",
+			want:  [][]int{{2, 7}, {10, 15}},
+		},
+		{
+			name:  "case sensitive plain text",
+			query: &domain.SearchQuery{Text: "Token", CaseSensitive: true},
+			data:  "token Token",
+			want:  [][]int{{6, 11}},
+		},
+		{
+			name:  "plain text is literal",
+			query: &domain.SearchQuery{Text: "a.b"},
+			data:  "axb a.b",
+			want:  [][]int{{4, 7}},
+		},
+		{
+			name:  "plain text matches whole words only",
+			query: &domain.SearchQuery{Text: "token"},
+			data:  "tokens xtoken token_ token=1",
+			want:  [][]int{{21, 26}},
+		},
+		{
+			name:  "a match inside a word does not hide the next one",
+			query: &domain.SearchQuery{Text: "aa"},
+			data:  "aaa aa",
+			want:  [][]int{{4, 6}},
+		},
+		{
+			name:  "plain text edges that are not word characters bound nothing",
+			query: &domain.SearchQuery{Text: "=1"},
+			data:  "a=1&b=12",
+			want:  [][]int{{1, 3}},
+		},
+		{
+			name:  "words of other scripts",
+			query: &domain.SearchQuery{Text: "мир"},
+			data:  "мирный мир",
+			want:  [][]int{{13, 19}},
+		},
+		{
+			name:  "multi-line text",
+			query: &domain.SearchQuery{Text: "a: 1\nb"},
+			data:  "a: 1\nb: 2",
+			want:  [][]int{{0, 6}},
+		},
+		{
+			name:  "regex matches inside words",
+			query: &domain.SearchQuery{Text: "tok.n", Regex: true},
+			data:  "tokens",
+			want:  [][]int{{0, 5}},
+		},
+		{
+			name:  "empty regex matches are left out",
+			query: &domain.SearchQuery{Text: "x*", Regex: true},
+			data:  "ab xx",
+			want:  [][]int{{3, 5}},
+		},
+		{
+			name:    "empty text",
+			query:   &domain.SearchQuery{},
+			wantErr: true,
+		},
+		{
+			name:    "invalid regex",
+			query:   &domain.SearchQuery{Text: "a(", Regex: true},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := compileQuery(tt.query)
+			if tt.wantErr {
+				if !errors.Is(err, customerrors.ErrInvalidRequest) {
+					t.Fatalf("compileQuery() error = %v, want %v", err, customerrors.ErrInvalidRequest)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compileQuery() error = %v", err)
+			}
+
+			got := m.findAll([]byte(tt.data), 10)
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("findAll() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryWords(t *testing.T) {
+	tests := []struct {
+		name  string
+		query *domain.SearchQuery
+		want  []string
+	}{
+		{
+			name:  "all words of plain text",
+			query: &domain.SearchQuery{Text: "Set-Cookie: sid"},
+			want:  []string{"set", "cookie", "sid"},
+		},
+		{
+			name:  "plain text without words",
+			query: &domain.SearchQuery{Text: "=="},
+			want:  nil,
+		},
+		{
+			name:  "regex literal words between non-word characters",
+			query: &domain.SearchQuery{Text: "a=token&b=\\d+", Regex: true},
+			want:  []string{"token", "b"},
+		},
+		{
+			name:  "regex word boundaries and line edges",
+			query: &domain.SearchQuery{Text: "^id=\\d+ \\bName\\b", Regex: true},
+			want:  []string{"id", "name"},
+		},
+		{
+			name:  "regex literal edges can be inside words",
+			query: &domain.SearchQuery{Text: "token=\\d+", Regex: true},
+			want:  nil,
+		},
+		{
+			name:  "regex repeats and groups that always match",
+			query: &domain.SearchQuery{Text: "(\\bfoo\\b)+ (\\bbar\\b){2}", Regex: true},
+			want:  []string{"foo", "bar", "bar"},
+		},
+		{
+			name:  "regex alternatives and optional parts",
+			query: &domain.SearchQuery{Text: "\\bfoo\\b|\\bbar\\b (\\bbaz\\b)?", Regex: true},
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := queryWords(tt.query)
+			if err != nil {
+				t.Fatalf("queryWords() error = %v", err)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("queryWords() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchExchange(t *testing.T) {
+	req := &domain.HTTPRequest{
+		ID:         "r1",
+		Path:       "/login",
+		RawHeaders: []string{"Host: example.com", "X-Token: abc"},
+		GetParams:  map[string][]string{"next": {"/home"}},
+		PostParams: map[string][]string{"token": {"abc"}},
+		Body:       []byte("token=abc"),
+		Response: &domain.HTTPResponse{
+			ID:      "s1",
+			Headers: map[string][]string{"Set-Cookie": {"token=abc"}},
+			Body:    []byte(`{"token":"abc","again":"abc","more":"abc","last":"abc"}`),
+		},
+	}
+
+	tests := []struct {
+		name   string
+		text   string
+		fields []string
+		req    *domain.HTTPRequest
+		want   []string
+	}{
+		{
+			name:   "every searched part",
+			text:   "abc",
+			fields: domain.SearchFields,
+			req:    req,
+			want: []string{
+				domain.SearchFieldRequestHeaders,
+				domain.SearchFieldParams,
+				domain.SearchFieldRequestBody,
+				domain.SearchFieldResponseHeaders,
+				domain.SearchFieldResponseBody,
+				domain.SearchFieldResponseBody,
+				domain.SearchFieldResponseBody,
+			},
+		},
+		{
+			name:   "only the fields asked for",
+			text:   "abc",
+			fields: []string{domain.SearchFieldParams},
+			req:    req,
+			want:   []string{domain.SearchFieldParams},
+		},
+		{
+			name:   "path",
+			text:   "login",
+			fields: domain.SearchFields,
+			req:    req,
+			want:   []string{domain.SearchFieldPath},
+		},
+		{
+			name:   "parsed headers and cookies without a raw head",
+			text:   "sid",
+			fields: []string{domain.SearchFieldRequestHeaders},
+			req:    &domain.HTTPRequest{Headers: map[string][]string{"Accept": {"*/*"}}, Cookies: map[string]string{"sid": "sid=1"}},
+			want:   []string{domain.SearchFieldRequestHeaders},
+		},
+		{
+			name:   "request without response",
+			text:   "x",
+			fields: []string{domain.SearchFieldResponseBody, domain.SearchFieldResponseHeaders},
+			req:    &domain.HTTPRequest{},
+			want:   nil,
+		},
+		{
+			name:   "no match",
+			text:   "missing",
+			fields: domain.SearchFields,
+			req:    req,
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := compileQuery(&domain.SearchQuery{Text: tt.text})
+			if err != nil {
+				t.Fatalf("compileQuery() error = %v", err)
+			}
+
+			result := matchExchange(m, tt.fields, tt.req)
+			if tt.want == nil {
+				if result != nil {
+					t.Fatalf("matchExchange() = %+v, want nil", result)
+				}
+				return
+			}
+			if result == nil {
+				t.Fatal("matchExchange() = nil, want a result")
+			}
+
+			var got []string
+			for _, snippet := range result.Snippets {
+				got = append(got, snippet.Field)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("snippet fields = %q, want %q", got, tt.want)
+			}
+
+			if result.RequestID != tt.req.ID {
+				t.Errorf("RequestID = %q, want %q", result.RequestID, tt.req.ID)
+			}
+
+			if tt.req.Response != nil && result.ResponseID != tt.req.Response.ID {
+				t.Errorf("ResponseID = %q, want %q", result.ResponseID, tt.req.Response.ID)
+			}
+		})
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("a", snippetContext+10)
+
+	tests := []struct {
+		name       string
+		data       string
+		start, end int
+		want       string
+		wantStart  int
+		wantEnd    int
+	}{
+		{
+			name:  "match at the start",
+			data:  "token=1",
+			start: 0, end: 5,
+			want:      "token=1",
+			wantStart: 0, wantEnd: 5,
+		},
+		{
+			name:  "match at the end",
+			data:  "a=token",
+			start: 2, end: 7,
+			want:      "a=token",
+			wantStart: 2, wantEnd: 7,
+		},
+		{
+			name:  "context is cut on both sides",
+			data:  long + "X" + long,
+			start: len(long), end: len(long) + 1,
+			want:      long[:snippetContext] + "X" + long[:snippetContext],
+			wantStart: snippetContext, wantEnd: snippetContext + 1,
+		},
+		{
+			name:  "characters are not split at the cut",
+			data:  "я" + strings.Repeat("b", snippetContext-1) + "X" + strings.Repeat("b", snippetContext-1) + "я",
+			start: snippetContext + 1, end: snippetContext + 2,
+			want:      strings.Repeat("b", snippetContext-1) + "X" + strings.Repeat("b", snippetContext-1),
+			wantStart: snippetContext - 1, wantEnd: snippetContext,
+		},
+		{
+			name:  "invalid UTF-8 is replaced and offsets follow the text",
+			data:  "\xff\xfeX",
+			start: 2, end: 3,
+			want:      "\uFFFDX",
+			wantStart: 3, wantEnd: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := snippet(domain.SearchFieldRequestBody, []byte(tt.data), tt.start, tt.end)
+
+			if got.Text != tt.want || got.Start != tt.wantStart || got.End != tt.wantEnd {
+				t.Errorf("snippet() = %q [%d:%d], want %q [%d:%d]", got.Text, got.Start, got.End, tt.want, tt.wantStart, tt.wantEnd)
+			}
+
+			if got.Field != domain.SearchFieldRequestBody {
+				t.Errorf("Field = %q, want %q", got.Field, domain.SearchFieldRequestBody)
+			}
+		})
+	}
+}
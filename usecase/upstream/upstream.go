@@ -0,0 +1,248 @@
+package upstream
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"golang.org/x/net/proxy"
+)
+
+type UpstreamProxyStorage interface {
+	GetUpstreamProxySettings(ctx context.Context) (settings *domain.UpstreamProxySettings, err error)
+	SaveUpstreamProxySettings(ctx context.Context, settings *domain.UpstreamProxySettings) (err error)
+}
+
+type upstreamProxy struct {
+	hostPattern string
+	url         *url.URL
+}
+
+// UpstreamService opens outgoing connections, chaining them through
+// an upstream HTTP or SOCKS5 proxy when one matches the target host.
+type UpstreamService struct {
+	mu        *sync.RWMutex
+	upstreamS UpstreamProxyStorage
+	settings  *domain.UpstreamProxySettings
+	proxies   []*upstreamProxy
+	// dialTimeout bounds connecting to targets and upstream proxies
+	dialTimeout time.Duration
+}
+
+func NewUpstreamService(ctx context.Context, upstreamS UpstreamProxyStorage, dialTimeout time.Duration) (s *UpstreamService, err error) {
+	s = &UpstreamService{
+		mu:          &sync.RWMutex{},
+		upstreamS:   upstreamS,
+		dialTimeout: dialTimeout,
+	}
+
+	settings, err := upstreamS.GetUpstreamProxySettings(ctx)
+	if err != nil {
+		return
+	}
+
+	err = s.setSettings(settings)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func parseUpstreamProxies(settings *domain.UpstreamProxySettings) (proxies []*upstreamProxy, err error) {
+	proxies = make([]*upstreamProxy, 0, len(settings.Proxies))
+	for _, p := range settings.Proxies {
+		if _, err = path.Match(p.HostPattern, ""); err != nil {
+			err = customerrors.ErrInvalidRequest
+			return
+		}
+
+		var u *url.URL
+		u, err = url.Parse(p.URL)
+		if err != nil || u.Host == "" {
+			err = customerrors.ErrInvalidRequest
+			return
+		}
+
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			err = customerrors.ErrInvalidRequest
+			return
+		}
+
+		proxies = append(proxies, &upstreamProxy{
+			hostPattern: strings.ToLower(p.HostPattern),
+			url:         u,
+		})
+	}
+
+	return
+}
+
+func (s *UpstreamService) setSettings(settings *domain.UpstreamProxySettings) (err error) {
+	proxies, err := parseUpstreamProxies(settings)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.settings = settings
+	s.proxies = proxies
+	s.mu.Unlock()
+
+	return
+}
+
+func (s *UpstreamService) GetUpstreamProxySettings(ctx context.Context) (settings *domain.UpstreamProxySettings, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	settings = s.settings
+
+	return
+}
+
+func (s *UpstreamService) SetUpstreamProxySettings(ctx context.Context, settings *domain.UpstreamProxySettings) (err error) {
+	_, err = parseUpstreamProxies(settings)
+	if err != nil {
+		return
+	}
+
+	err = s.upstreamS.SaveUpstreamProxySettings(ctx, settings)
+	if err != nil {
+		return
+	}
+
+	err = s.setSettings(settings)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// ProxyURL returns the upstream proxy for host, or nil if the host is reached directly
+func (s *UpstreamService) ProxyURL(host string) *url.URL {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	host = strings.ToLower(host)
+	for _, p := range s.proxies {
+		if p.hostPattern == "" {
+			return p.url
+		}
+
+		if ok, _ := path.Match(p.hostPattern, host); ok {
+			return p.url
+		}
+	}
+
+	return nil
+}
+
+// DialContext connects to addr directly or through the upstream proxy matching its host
+func (s *UpstreamService) DialContext(ctx context.Context, network, addr string) (conn net.Conn, err error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+
+	dialer := &net.Dialer{Timeout: s.dialTimeout}
+
+	proxyURL := s.ProxyURL(host)
+	if proxyURL == nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	if proxyURL.Scheme == "socks5" {
+		var auth *proxy.Auth
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{
+				User:     proxyURL.User.Username(),
+				Password: password,
+			}
+		}
+
+		var socks proxy.Dialer
+		socks, err = proxy.SOCKS5("tcp", proxyURL.Host, auth, dialer)
+		if err != nil {
+			return
+		}
+
+		return socks.(proxy.ContextDialer).DialContext(ctx, network, addr)
+	}
+
+	return dialHTTPProxy(ctx, dialer, proxyURL, addr)
+}
+
+// dialHTTPProxy opens a tunnel to addr with CONNECT through an HTTP(S) proxy
+func dialHTTPProxy(ctx context.Context, dialer *net.Dialer, proxyURL *url.URL, addr string) (conn net.Conn, err error) {
+	conn, err = dialer.DialContext(ctx, "tcp", proxyURL.Host)
+	if err != nil {
+		return
+	}
+
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ServerName: proxyURL.Hostname(),
+		})
+
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			conn.Close()
+			return
+		}
+
+		conn = tlsConn
+	}
+
+	connectReq := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := proxyURL.User.Username() + ":" + password
+		connectReq.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+
+	err = connectReq.Write(conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	// The proxy must not send anything past its response before the tunnel is used,
+	// so reading it through a buffer does not lose tunnel bytes
+	res, err := http.ReadResponse(bufio.NewReader(conn), connectReq)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		conn.Close()
+		err = fmt.Errorf("upstream proxy %s refused CONNECT to %s: %s", proxyURL.Host, addr, res.Status)
+		return
+	}
+
+	return
+}
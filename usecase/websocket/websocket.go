@@ -0,0 +1,257 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/burp_junior/customerrors"
+	"github.com/burp_junior/domain"
+	"github.com/burp_junior/pkg/wsframe"
+)
+
+// resendTimeout is how long a resent message waits for server replies
+var resendTimeout = 3 * time.Second
+
+type WebSocketStorage interface {
+	SaveWebSocketMessage(ctx context.Context, msg *domain.WebSocketMessage) (savedMsg *domain.WebSocketMessage, err error)
+	GetWebSocketMessages(ctx context.Context, reqID string) (msgs []*domain.WebSocketMessage, err error)
+}
+
+type RequestService interface {
+	GetRequestByID(ctx context.Context, reqID string) (req *domain.HTTPRequest, err error)
+	BuildHTTPRequest(ctx context.Context, pr *domain.HTTPRequest) (req *http.Request, err error)
+	DialUpstream(ctx context.Context, pr *domain.HTTPRequest) (conn net.Conn, err error)
+}
+
+// WebSocketService relays WebSocket frames between client and server and records their messages.
+type WebSocketService struct {
+	rs  RequestService
+	wsS WebSocketStorage
+}
+
+func NewWebSocketService(rs RequestService, wsS WebSocketStorage) *WebSocketService {
+	return &WebSocketService{
+		rs:  rs,
+		wsS: wsS,
+	}
+}
+
+// Relay forwards frames in both directions until either side closes the connection.
+// Messages are saved linked to handshake unless record is false.
+func (s *WebSocketService) Relay(ctx context.Context, handshake *domain.HTTPRequest, record bool, client io.ReadWriteCloser, server io.ReadWriteCloser) {
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+
+	once := &sync.Once{}
+	closeBoth := func() {
+		client.Close()
+		server.Close()
+	}
+
+	relay := func(direction string, src io.Reader, dst io.Writer) {
+		defer wg.Done()
+		defer once.Do(closeBoth)
+
+		err := s.relayFrames(ctx, handshake, record, direction, src, dst)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+			log.Println("websocket relay err: ", err)
+		}
+	}
+
+	go relay(domain.WebSocketDirectionClient, client, server)
+	go relay(domain.WebSocketDirectionServer, server, client)
+
+	wg.Wait()
+}
+
+func (s *WebSocketService) relayFrames(ctx context.Context, handshake *domain.HTTPRequest, record bool, direction string, src io.Reader, dst io.Writer) (err error) {
+	var opcode byte
+	var payload []byte
+
+	for {
+		var f *wsframe.Frame
+		f, err = wsframe.ReadFrame(src)
+		if err != nil {
+			return
+		}
+
+		err = wsframe.WriteFrame(dst, f)
+		if err != nil {
+			return
+		}
+
+		if !record {
+			continue
+		}
+
+		// Control frames may be interleaved with fragments of a data message
+		switch {
+		case f.IsControl():
+			s.saveMessage(ctx, handshake, direction, f.Opcode, f.Payload)
+			continue
+		case f.Opcode == wsframe.OpContinuation:
+			payload = append(payload, f.Payload...)
+		default:
+			opcode = f.Opcode
+			payload = f.Payload
+		}
+
+		if f.Fin {
+			s.saveMessage(ctx, handshake, direction, opcode, payload)
+			payload = nil
+		}
+	}
+}
+
+func (s *WebSocketService) saveMessage(ctx context.Context, handshake *domain.HTTPRequest, direction string, opcode byte, payload []byte) {
+	_, err := s.wsS.SaveWebSocketMessage(ctx, &domain.WebSocketMessage{
+		RequestID: handshake.ID,
+		Direction: direction,
+		Opcode:    int(opcode),
+		Payload:   payload,
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		log.Println("error saving websocket message: ", err)
+	}
+}
+
+func (s *WebSocketService) GetWebSocketMessages(ctx context.Context, reqID string) (msgs []*domain.WebSocketMessage, err error) {
+	_, err = s.rs.GetRequestByID(ctx, reqID)
+	if err != nil {
+		return
+	}
+
+	msgs, err = s.wsS.GetWebSocketMessages(ctx, reqID)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// ResendWebSocketMessage repeats the handshake of request reqID over a new connection,
+// sends msg and collects server messages received within resendTimeout.
+// Both the sent and the received messages are saved and returned.
+func (s *WebSocketService) ResendWebSocketMessage(ctx context.Context, reqID string, msg *domain.WebSocketMessage) (msgs []*domain.WebSocketMessage, err error) {
+	handshake, err := s.rs.GetRequestByID(ctx, reqID)
+	if err != nil {
+		return
+	}
+
+	if !handshake.IsWebSocketUpgrade() {
+		err = customerrors.ErrInvalidRequest
+		return
+	}
+
+	conn, reader, err := s.dialWebSocket(ctx, handshake)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	opcode := byte(msg.Opcode)
+	if opcode == wsframe.OpContinuation {
+		opcode = wsframe.OpText
+	}
+
+	f, err := wsframe.NewMaskedFrame(opcode, msg.Payload)
+	if err != nil {
+		return
+	}
+
+	err = wsframe.WriteFrame(conn, f)
+	if err != nil {
+		err = customerrors.ErrSendingRequest
+		return
+	}
+
+	msgs = make([]*domain.WebSocketMessage, 0)
+	msgs = append(msgs, s.saveResent(ctx, handshake, domain.WebSocketDirectionClient, opcode, msg.Payload))
+
+	err = conn.SetReadDeadline(time.Now().Add(resendTimeout))
+	if err != nil {
+		return
+	}
+
+	for {
+		f, err = wsframe.ReadFrame(reader)
+		if err != nil {
+			break
+		}
+
+		msgs = append(msgs, s.saveResent(ctx, handshake, domain.WebSocketDirectionServer, f.Opcode, f.Payload))
+
+		if f.Opcode == wsframe.OpClose {
+			break
+		}
+	}
+
+	if !errors.Is(err, os.ErrDeadlineExceeded) && !errors.Is(err, io.EOF) && err != nil {
+		log.Println("error reading resent websocket replies: ", err)
+	}
+	err = nil
+
+	return
+}
+
+func (s *WebSocketService) saveResent(ctx context.Context, handshake *domain.HTTPRequest, direction string, opcode byte, payload []byte) (msg *domain.WebSocketMessage) {
+	msg = &domain.WebSocketMessage{
+		RequestID: handshake.ID,
+		Direction: direction,
+		Opcode:    int(opcode),
+		Payload:   payload,
+		Timestamp: time.Now(),
+	}
+
+	saved, err := s.wsS.SaveWebSocketMessage(ctx, msg)
+	if err != nil {
+		log.Println("error saving websocket message: ", err)
+		return
+	}
+
+	msg = saved
+
+	return
+}
+
+func (s *WebSocketService) dialWebSocket(ctx context.Context, handshake *domain.HTTPRequest) (conn net.Conn, reader *bufio.Reader, err error) {
+	httpReq, err := s.rs.BuildHTTPRequest(ctx, handshake)
+	if err != nil {
+		return
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, resendTimeout)
+	defer cancel()
+
+	conn, err = s.rs.DialUpstream(dialCtx, handshake)
+	if err != nil {
+		err = customerrors.ErrSendingRequest
+		return
+	}
+
+	err = httpReq.Write(conn)
+	if err != nil {
+		conn.Close()
+		err = customerrors.ErrSendingRequest
+		return
+	}
+
+	reader = bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, httpReq)
+	if err != nil || res.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		err = customerrors.ErrSendingRequest
+		return
+	}
+
+	return
+}